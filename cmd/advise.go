@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// adviseCmd prints the capacity planning behind phpfpm_recommended_max_children
+var adviseCmd = &cobra.Command{
+	Use:   "advise",
+	Short: "Recommend pm.max_children for each pool",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(Config.PHPFpm.Pools) == 0 {
+			return fmt.Errorf("no PHP-FPM pools configured or discovered")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		results, err := phpfpm.GetMetrics(ctx, Config)
+		if err != nil {
+			return fmt.Errorf("failed to scrape PHP-FPM: %w", err)
+		}
+
+		system := server.DetectSystem()
+		var memoryLimitMB int64
+		if system.SystemInfo != nil {
+			memoryLimitMB = system.SystemInfo.MemoryLimitMB
+		}
+
+		printCapacityPlans(cmd.OutOrStdout(), phpfpm.PlanCapacity(memoryLimitMB, results))
+		return nil
+	},
+}
+
+func printCapacityPlans(w io.Writer, plans []phpfpm.CapacityPlan) {
+	if len(plans) == 0 {
+		fmt.Fprintln(w, "No pools could be scraped.")
+		return
+	}
+
+	for i, plan := range plans {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintf(w, "Pool %s (%s)\n", plan.Pool, plan.Socket)
+		for _, line := range plan.Reasoning {
+			fmt.Fprintf(w, "  - %s\n", line)
+		}
+
+		if plan.Recommended > 0 {
+			fmt.Fprintf(w, "  => pm.max_children = %d", plan.Recommended)
+			if plan.MaxChildren > 0 {
+				fmt.Fprintf(w, " (currently %d)", plan.MaxChildren)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(adviseCmd)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+func TestAdviseCommand_Initialization(t *testing.T) {
+	if adviseCmd.Use != "advise" {
+		t.Errorf("Expected advise command Use to be 'advise', got %s", adviseCmd.Use)
+	}
+
+	if adviseCmd.RunE == nil {
+		t.Errorf("Expected advise command RunE function to be set")
+	}
+
+	// Test that the command was added to root
+	if adviseCmd.Parent() != rootCmd {
+		t.Errorf("Expected advise command parent to be root command")
+	}
+}
+
+func TestPrintCapacityPlans(t *testing.T) {
+	plans := []phpfpm.CapacityPlan{
+		{
+			Pool:        "www",
+			Socket:      "unix:///run/php-fpm.sock",
+			MaxChildren: 50,
+			Recommended: 15,
+			Reasoning:   []string{"memory limit 2000.0 MiB", "recommended pm.max_children = 900.0 MiB / 60.0 MiB = 15"},
+		},
+		{
+			Pool:      "api",
+			Socket:    "tcp://127.0.0.1:9001",
+			Reasoning: []string{"memory limit unknown: no recommendation"},
+		},
+	}
+
+	var buf bytes.Buffer
+	printCapacityPlans(&buf, plans)
+	out := buf.String()
+
+	expected := []string{
+		"Pool www (unix:///run/php-fpm.sock)",
+		"  - memory limit 2000.0 MiB",
+		"  => pm.max_children = 15 (currently 50)",
+		"Pool api (tcp://127.0.0.1:9001)",
+		"  - memory limit unknown: no recommendation",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	// No recommendation means no summary line for that pool
+	if strings.Count(out, "=>") != 1 {
+		t.Errorf("Expected a single recommendation line, got:\n%s", out)
+	}
+}
+
+func TestPrintCapacityPlans_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	printCapacityPlans(&buf, nil)
+
+	if !strings.Contains(buf.String(), "No pools could be scraped") {
+		t.Errorf("Expected empty message, got %q", buf.String())
+	}
+}
@@ -67,6 +67,8 @@ var rootCmd = &cobra.Command{
 		logging.L().Debug("PHPeek Logging initialized", "level", Config.Logging.Level)
 		logging.L().Debug("PHPeek Loaded config", "config", Config)
 
+		phpfpm.ConfigureConnections(Config.PHPFpm.Connections)
+
 		// phpfpm autodiscover
 		if Config.PHPFpm.Enabled && Config.PHPFpm.Autodiscover {
 			var discovered []phpfpm.DiscoveredFPM
@@ -82,22 +84,16 @@ var rootCmd = &cobra.Command{
 				time.Sleep(time.Duration(Config.PHPFpm.RetryDelay) * time.Second)
 			}
 
+			// serve keeps looking every discovery_interval, so pools that
+			// start later are still picked up
 			if err != nil {
 				logging.L().Error("PHPeek PHP-FPM Autodiscover failed after retries", "error", err)
 			} else if len(discovered) == 0 {
 				logging.L().Error("PHPeek PHP-FPM Autodiscover succeeded but no FPM pools found")
 			} else {
 				logging.L().Debug("PHPeek Discovered PHP-FPM Processes", "pools", discovered)
-				for _, d := range discovered {
-					Config.PHPFpm.Pools = append(Config.PHPFpm.Pools, config.FPMPoolConfig{
-						Socket:       d.Socket,
-						StatusSocket: d.StatusSocket,
-						StatusPath:   d.StatusPath,
-						ConfigPath:   d.ConfigPath,
-						Binary:       d.Binary,
-						CliBinary:    d.CliBinary,
-					})
-				}
+				Config.PHPFpm.Pools = phpfpm.MergeDiscovered(Config.PHPFpm.Pools, discovered)
+				Config.PHPFpm.ApplyPoolDefaults()
 			}
 		}
 
@@ -27,24 +27,104 @@ type PHPConfig struct {
 }
 
 type FPMConfig struct {
-	Enabled      bool            `mapstructure:"enabled"`
-	Autodiscover bool            `mapstructure:"autodiscover"`
-	Retries      int             `mapstructure:"retries"`
-	RetryDelay   int             `mapstructure:"retry_delay"`
-	Pools        []FPMPoolConfig `mapstructure:"pools"`
-	PollInterval time.Duration   `mapstructure:"poll_interval"`
+	Enabled           bool              `mapstructure:"enabled"`
+	Autodiscover      bool              `mapstructure:"autodiscover"`
+	Retries           int               `mapstructure:"retries"`
+	RetryDelay        int               `mapstructure:"retry_delay"`
+	DiscoveryInterval time.Duration     `mapstructure:"discovery_interval"` // Rediscovery of added and removed pools, 0 disables
+	Pools             []FPMPoolConfig   `mapstructure:"pools"`
+	PollInterval      time.Duration     `mapstructure:"poll_interval"`
+	MaxConcurrency    int               `mapstructure:"max_concurrency"` // Pools scraped in parallel
+	Routes            RoutesConfig      `mapstructure:"routes"`
+	Logs              FPMLogsConfig     `mapstructure:"logs"`
+	ProcessDetail     bool              `mapstructure:"process_detail"` // Export /proc metrics per worker PID
+	Kubernetes        KubernetesConfig  `mapstructure:"kubernetes"`     // Discovery of pools in annotated pods
+	Connections       ConnectionsConfig `mapstructure:"connections"`    // FastCGI connections to the status sockets
+	// Defaults for pools without their own opcache_top_scripts, ini_directives and probe_dir
+	OpcacheTopScripts int      `mapstructure:"opcache_top_scripts"`
+	IniDirectives     []string `mapstructure:"ini_directives"`
+	ProbeDir          string   `mapstructure:"probe_dir"`
+}
+
+// DefaultIniDirectives are the php.ini settings exported for each pool
+// unless phpfpm.ini_directives is set.
+var DefaultIniDirectives = []string{
+	"memory_limit",
+	"max_execution_time",
+	"realpath_cache_size",
+	"opcache.enable",
+	"opcache.memory_consumption",
+	"opcache.interned_strings_buffer",
+	"opcache.max_accelerated_files",
+	"opcache.validate_timestamps",
+	"opcache.revalidate_freq",
+	"opcache.jit",
+	"opcache.jit_buffer_size",
+	"apc.enabled",
+	"apc.shm_size",
+}
+
+// ConnectionsConfig controls the FastCGI connections shared by status
+// requests and probe scripts.
+type ConnectionsConfig struct {
+	KeepAlive   bool          `mapstructure:"keep_alive"`   // Keep pm.status_listen connections open between requests (FCGI_KEEP_CONN), never those to listen
+	MaxIdle     int           `mapstructure:"max_idle"`     // Connections kept open per status socket
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // Kept connections unused this long are closed
+	MaxBackoff  time.Duration `mapstructure:"max_backoff"`  // Longest wait before dialing a failing status socket again, 0 disables
+}
+
+type KubernetesConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	APIServer     string `mapstructure:"api_server"`     // Defaults to the in-cluster service
+	Namespace     string `mapstructure:"namespace"`      // Empty for all namespaces
+	LabelSelector string `mapstructure:"label_selector"` // Narrows the pods listed, e.g. app=web
+	Annotation    string `mapstructure:"annotation"`     // Pod annotation holding the status URLs
+	TokenFile     string `mapstructure:"token_file"`     // Service account token, sent as a bearer token
+	CAFile        string `mapstructure:"ca_file"`        // CA bundle of the API server
+}
+
+type FPMLogsConfig struct {
+	Slowlog       bool `mapstructure:"slowlog"`        // Tail the slowlog of each pool
+	SlowlogRecent int  `mapstructure:"slowlog_recent"` // Entries kept for the /slowlog endpoint
+	ErrorLog      bool `mapstructure:"error_log"`      // Tail the global error_log of each master
+}
+
+type RoutesConfig struct {
+	Enabled     bool        `mapstructure:"enabled"`
+	MaxRoutes   int         `mapstructure:"max_routes"`   // Routes per pool before falling back to "other"
+	StripQuery  bool        `mapstructure:"strip_query"`  // Drop the query string before matching
+	CollapseIDs bool        `mapstructure:"collapse_ids"` // Replace numeric, UUID and hash path segments
+	Rules       []RouteRule `mapstructure:"rules"`
+}
+
+type RouteRule struct {
+	Match   string `mapstructure:"match"`   // Regular expression applied to the request URI
+	Replace string `mapstructure:"replace"` // Replacement, may reference capture groups as $1
 }
 
 type FPMPoolConfig struct {
+	Name              string        `mapstructure:"name"` // Optional, used to label the pool while it is down
 	Socket            string        `mapstructure:"socket"`
 	StatusSocket      string        `mapstructure:"status_socket"`
 	StatusPath        string        `mapstructure:"status_path"`
-	StatusPathEnabled bool          `mapstructure:"status_path_enabled"`
+	StatusPathEnabled bool          `mapstructure:"status_path_enabled"` // The pool sets pm.status_path, implied by status_path
+	PingPath          string        `mapstructure:"ping_path"`           // The pool's ping.path, read from its FPM config when empty
+	PingResponse      string        `mapstructure:"ping_response"`       // The pool's ping.response, "pong" when empty
 	ConfigPath        string        `mapstructure:"config_path"`
 	Binary            string        `mapstructure:"binary"`
 	CliBinary         string        `mapstructure:"cli_binary"`
 	PollInterval      time.Duration `mapstructure:"poll_interval"`
 	Timeout           time.Duration `mapstructure:"timeout"`
+	OpcacheTopScripts int           `mapstructure:"opcache_top_scripts"` // Scripts by memory on /json, 0 disables
+	IniDirectives     []string      `mapstructure:"ini_directives"`      // php.ini settings to export, empty disables
+	ProbeDir          string        `mapstructure:"probe_dir"`           // Where probe scripts are written, must be visible to the pool
+	Chroot            string        `mapstructure:"chroot"`              // Pool chroot, read from the FPM config when empty
+	Root              string        `mapstructure:"root"`                // Master's filesystem root as seen by the exporter, e.g. /proc/<pid>/root
+	Namespace         string        `mapstructure:"namespace"`           // Kubernetes namespace of the pool's pod, added as a label
+	Pod               string        `mapstructure:"pod"`                 // Kubernetes pod of the pool, added as a label
+	SkipProbes        bool          `mapstructure:"skip_probes"`         // Leave out opcache, APCu, ini and runtime metrics, which need probe scripts
+	Discovered        bool          `mapstructure:"-"`                   // Found by autodiscovery rather than configured
+	Transient         bool          `mapstructure:"-"`                   // Scraped once, e.g. by /probe: leaves no counters or kept connections behind
 }
 
 type LaravelConfig struct {
@@ -56,8 +136,23 @@ type LaravelConfig struct {
 }
 
 type MonitorConfig struct {
-	ListenAddr string `mapstructure:"listen_addr"`
-	EnableJson bool   `mapstructure:"enable_json"`
+	ListenAddr string      `mapstructure:"listen_addr"`
+	EnableJson bool        `mapstructure:"enable_json"`
+	Probe      ProbeConfig `mapstructure:"probe"` // The /probe endpoint, scraping a target given per request
+}
+
+type ProbeConfig struct {
+	Enabled        bool                   `mapstructure:"enabled"`
+	AllowedTargets []string               `mapstructure:"allowed_targets"` // CIDRs or target patterns, no entries allow no target
+	Modules        map[string]ProbeModule `mapstructure:"modules"`
+}
+
+// ProbeModule is a named set of options a /probe request selects with module=.
+type ProbeModule struct {
+	StatusPath         string        `mapstructure:"status_path"`          // Default for the status_path parameter
+	AllowedStatusPaths []string      `mapstructure:"allowed_status_paths"` // Other paths the status_path parameter may name
+	Timeout            time.Duration `mapstructure:"timeout"`
+	Probes             bool          `mapstructure:"probes"` // Run the probe scripts for opcache, APCu, ini and runtime metrics
 }
 
 func Load() (*Config, error) {
@@ -67,7 +162,28 @@ func Load() (*Config, error) {
 	viper.SetDefault("phpfpm.autodiscover", true)
 	viper.SetDefault("phpfpm.retries", 5)
 	viper.SetDefault("phpfpm.retry_delay", 2)
+	viper.SetDefault("phpfpm.discovery_interval", "30s")
 	viper.SetDefault("phpfpm.poll_interval", "1s")
+	viper.SetDefault("phpfpm.max_concurrency", 8)
+	viper.SetDefault("phpfpm.process_detail", false)
+	viper.SetDefault("phpfpm.opcache_top_scripts", 0)
+	viper.SetDefault("phpfpm.ini_directives", DefaultIniDirectives)
+	viper.SetDefault("phpfpm.probe_dir", "")
+	viper.SetDefault("phpfpm.kubernetes.enabled", false)
+	viper.SetDefault("phpfpm.kubernetes.annotation", "phpeek.io/fpm-status")
+	viper.SetDefault("phpfpm.kubernetes.token_file", "/var/run/secrets/kubernetes.io/serviceaccount/token")
+	viper.SetDefault("phpfpm.kubernetes.ca_file", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt")
+	viper.SetDefault("phpfpm.connections.keep_alive", true)
+	viper.SetDefault("phpfpm.connections.max_idle", 1)
+	viper.SetDefault("phpfpm.connections.idle_timeout", "30s")
+	viper.SetDefault("phpfpm.connections.max_backoff", "30s")
+	viper.SetDefault("phpfpm.routes.enabled", true)
+	viper.SetDefault("phpfpm.routes.max_routes", 100)
+	viper.SetDefault("phpfpm.routes.strip_query", true)
+	viper.SetDefault("phpfpm.routes.collapse_ids", true)
+	viper.SetDefault("phpfpm.logs.slowlog", true)
+	viper.SetDefault("phpfpm.logs.slowlog_recent", 100)
+	viper.SetDefault("phpfpm.logs.error_log", true)
 	viper.SetDefault("phpfpm.pools", []FPMPoolConfig{})
 
 	viper.SetDefault("php.enabled", true)
@@ -75,6 +191,11 @@ func Load() (*Config, error) {
 
 	viper.SetDefault("monitor.listen_addr", ":9114")
 	viper.SetDefault("monitor.enable_json", true)
+	viper.SetDefault("monitor.probe.enabled", false)
+	viper.SetDefault("monitor.probe.allowed_targets", []string{})
+	viper.SetDefault("monitor.probe.modules", map[string]any{
+		"fpm": map[string]any{"status_path": "/status", "timeout": "2s", "probes": false},
+	})
 
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
@@ -90,6 +211,26 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.PHPFpm.ApplyPoolDefaults()
 
 	return &cfg, nil
 }
+
+// ApplyPoolDefaults copies FPM-wide settings to pools that do not set them.
+// Call it again after adding pools, e.g. from autodiscovery.
+func (c *FPMConfig) ApplyPoolDefaults() {
+	for i := range c.Pools {
+		if c.Pools[i].StatusPath != "" {
+			c.Pools[i].StatusPathEnabled = true
+		}
+		if c.Pools[i].OpcacheTopScripts == 0 {
+			c.Pools[i].OpcacheTopScripts = c.OpcacheTopScripts
+		}
+		if c.Pools[i].IniDirectives == nil {
+			c.Pools[i].IniDirectives = c.IniDirectives
+		}
+		if c.Pools[i].ProbeDir == "" {
+			c.Pools[i].ProbeDir = c.ProbeDir
+		}
+	}
+}
@@ -176,11 +176,60 @@ func TestLoad_Defaults(t *testing.T) {
 	if config.PHPFpm.RetryDelay != 2 {
 		t.Errorf("Expected phpfpm.retry_delay default to be 2, got %v", config.PHPFpm.RetryDelay)
 	}
+	if config.PHPFpm.DiscoveryInterval != 30*time.Second {
+		t.Errorf("Expected phpfpm.discovery_interval default to be 30s, got %v", config.PHPFpm.DiscoveryInterval)
+	}
+
+	if config.PHPFpm.Kubernetes.Enabled || config.PHPFpm.Kubernetes.Annotation != "phpeek.io/fpm-status" {
+		t.Errorf("Expected kubernetes discovery disabled with the phpeek.io/fpm-status annotation, got %+v", config.PHPFpm.Kubernetes)
+	}
+	if config.PHPFpm.Kubernetes.TokenFile != "/var/run/secrets/kubernetes.io/serviceaccount/token" {
+		t.Errorf("Expected the service account token by default, got %v", config.PHPFpm.Kubernetes.TokenFile)
+	}
 
 	if config.PHPFpm.PollInterval != time.Second {
 		t.Errorf("Expected phpfpm.poll_interval default to be 1s, got %v", config.PHPFpm.PollInterval)
 	}
 
+	if config.PHPFpm.MaxConcurrency != 8 {
+		t.Errorf("Expected phpfpm.max_concurrency default to be 8, got %v", config.PHPFpm.MaxConcurrency)
+	}
+
+	if !config.PHPFpm.Routes.Enabled || config.PHPFpm.Routes.MaxRoutes != 100 {
+		t.Errorf("Expected phpfpm.routes to be enabled with max_routes 100, got %+v", config.PHPFpm.Routes)
+	}
+
+	if !config.PHPFpm.Routes.StripQuery || !config.PHPFpm.Routes.CollapseIDs {
+		t.Errorf("Expected phpfpm.routes strip_query and collapse_ids to default to true, got %+v", config.PHPFpm.Routes)
+	}
+
+	if !config.PHPFpm.Logs.Slowlog || config.PHPFpm.Logs.SlowlogRecent != 100 {
+		t.Errorf("Expected phpfpm.logs.slowlog to be enabled keeping 100 entries, got %+v", config.PHPFpm.Logs)
+	}
+
+	if !config.PHPFpm.Logs.ErrorLog {
+		t.Errorf("Expected phpfpm.logs.error_log default to be true")
+	}
+
+	if config.PHPFpm.ProcessDetail {
+		t.Errorf("Expected phpfpm.process_detail default to be false")
+	}
+
+	if config.PHPFpm.OpcacheTopScripts != 0 {
+		t.Errorf("Expected phpfpm.opcache_top_scripts default to be 0, got %d", config.PHPFpm.OpcacheTopScripts)
+	}
+
+	if len(config.PHPFpm.IniDirectives) != len(DefaultIniDirectives) {
+		t.Errorf("Expected phpfpm.ini_directives default to be %v, got %v", DefaultIniDirectives, config.PHPFpm.IniDirectives)
+	}
+	expectedConns := ConnectionsConfig{KeepAlive: true, MaxIdle: 1, IdleTimeout: 30 * time.Second, MaxBackoff: 30 * time.Second}
+	if config.PHPFpm.Connections != expectedConns {
+		t.Errorf("Expected phpfpm.connections defaults %+v, got %+v", expectedConns, config.PHPFpm.Connections)
+	}
+	if config.PHPFpm.ProbeDir != "" {
+		t.Errorf("Expected phpfpm.probe_dir default to be empty, got %s", config.PHPFpm.ProbeDir)
+	}
+
 	if config.PHP.Enabled != true {
 		t.Errorf("Expected php.enabled default to be true, got %v", config.PHP.Enabled)
 	}
@@ -197,6 +246,13 @@ func TestLoad_Defaults(t *testing.T) {
 		t.Errorf("Expected monitor.enable_json default to be true, got %v", config.Monitor.EnableJson)
 	}
 
+	if config.Monitor.Probe.Enabled || len(config.Monitor.Probe.AllowedTargets) != 0 {
+		t.Errorf("Expected /probe disabled with no allowed targets, got %+v", config.Monitor.Probe)
+	}
+	if module, ok := config.Monitor.Probe.Modules["fpm"]; !ok || module.StatusPath != "/status" || module.Timeout != 2*time.Second || module.Probes {
+		t.Errorf("Expected the default fpm probe module, got %+v", config.Monitor.Probe.Modules)
+	}
+
 	if config.Logging.Level != "info" {
 		t.Errorf("Expected logging.level default to be 'info', got %v", config.Logging.Level)
 	}
@@ -505,3 +561,42 @@ func TestMapstructureTags(t *testing.T) {
 		t.Errorf("Expected monitor.enable_json to be false")
 	}
 }
+
+func TestFPMConfig_ApplyPoolDefaults(t *testing.T) {
+	cfg := FPMConfig{
+		OpcacheTopScripts: 10,
+		IniDirectives:     []string{"memory_limit"},
+		ProbeDir:          "/var/lib/phpeek",
+		Pools: []FPMPoolConfig{
+			{Socket: "unix:///var/run/php1.sock"},
+			{Socket: "unix:///var/run/php2.sock", OpcacheTopScripts: 25, IniDirectives: []string{"apc.shm_size"}, ProbeDir: "/srv/jail/probes", StatusPath: "/status"},
+		},
+	}
+
+	cfg.ApplyPoolDefaults()
+
+	if cfg.Pools[0].OpcacheTopScripts != 10 {
+		t.Errorf("Expected pool without opcache_top_scripts to inherit 10, got %d", cfg.Pools[0].OpcacheTopScripts)
+	}
+	if cfg.Pools[1].OpcacheTopScripts != 25 {
+		t.Errorf("Expected pool opcache_top_scripts to be kept at 25, got %d", cfg.Pools[1].OpcacheTopScripts)
+	}
+	if len(cfg.Pools[0].IniDirectives) != 1 || cfg.Pools[0].IniDirectives[0] != "memory_limit" {
+		t.Errorf("Expected pool without ini_directives to inherit [memory_limit], got %v", cfg.Pools[0].IniDirectives)
+	}
+	if len(cfg.Pools[1].IniDirectives) != 1 || cfg.Pools[1].IniDirectives[0] != "apc.shm_size" {
+		t.Errorf("Expected pool ini_directives to be kept, got %v", cfg.Pools[1].IniDirectives)
+	}
+	if cfg.Pools[0].ProbeDir != "/var/lib/phpeek" {
+		t.Errorf("Expected pool without probe_dir to inherit /var/lib/phpeek, got %s", cfg.Pools[0].ProbeDir)
+	}
+	if cfg.Pools[1].ProbeDir != "/srv/jail/probes" {
+		t.Errorf("Expected pool probe_dir to be kept, got %s", cfg.Pools[1].ProbeDir)
+	}
+	if cfg.Pools[0].StatusPathEnabled {
+		t.Error("Expected pool without status_path to keep status_path_enabled false")
+	}
+	if !cfg.Pools[1].StatusPathEnabled {
+		t.Error("Expected pool with status_path to have status_path_enabled set")
+	}
+}
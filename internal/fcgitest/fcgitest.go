@@ -0,0 +1,178 @@
+// Package fcgitest provides a fake PHP-FPM pool for tests: a minimal FastCGI
+// responder on a unix socket or a local TCP port.
+package fcgitest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Handler receives the params of a request and returns the raw CGI output,
+// headers included, the way PHP writes it.
+type Handler func(params map[string]string) string
+
+// Server is a fake PHP-FPM pool. It honours FCGI_KEEP_CONN and closes the
+// connection after the request otherwise.
+type Server struct {
+	Socket string // unix:// or tcp:// address
+	Addr   string // Socket without the scheme
+
+	mu       sync.Mutex
+	requests []map[string]string
+	conns    int
+	open     []net.Conn
+}
+
+// Start serves handler on a unix socket in a temporary directory until the
+// test ends.
+func Start(t *testing.T, handler Handler) *Server {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fpm.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", path, err)
+	}
+	return serve(t, l, "unix://"+path, handler)
+}
+
+// StartTCP serves handler on a local TCP port until the test ends.
+func StartTCP(t *testing.T, handler Handler) *Server {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return serve(t, l, "tcp://"+l.Addr().String(), handler)
+}
+
+func serve(t *testing.T, l net.Listener, socket string, handler Handler) *Server {
+	t.Cleanup(func() { l.Close() })
+
+	_, addr, _ := strings.Cut(socket, "://")
+	s := &Server{Socket: socket, Addr: addr}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.open = append(s.open, conn)
+			s.mu.Unlock()
+			go s.serveConn(conn, handler)
+		}
+	}()
+	return s
+}
+
+// Requests returns the params of every request served so far.
+func (s *Server) Requests() []map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]string(nil), s.requests...)
+}
+
+// Conns returns the number of connections accepted so far.
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// CloseConns closes every connection accepted so far, as php-fpm does with
+// kept connections when a worker exits.
+func (s *Server) CloseConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.open {
+		conn.Close()
+	}
+	s.open = nil
+}
+
+func (s *Server) serveConn(conn net.Conn, handler Handler) {
+	defer conn.Close()
+
+	var (
+		reqID     uint16
+		keepConn  bool
+		rawParams []byte
+	)
+	for {
+		var h [8]byte
+		if _, err := io.ReadFull(conn, h[:]); err != nil {
+			return
+		}
+		content := make([]byte, int(binary.BigEndian.Uint16(h[4:6]))+int(h[6]))
+		if _, err := io.ReadFull(conn, content); err != nil {
+			return
+		}
+		content = content[:binary.BigEndian.Uint16(h[4:6])]
+
+		switch h[1] {
+		case 1: // BEGIN_REQUEST
+			reqID = binary.BigEndian.Uint16(h[2:4])
+			keepConn = content[2]&1 != 0
+			rawParams = nil
+		case 4: // PARAMS
+			rawParams = append(rawParams, content...)
+		case 5: // STDIN, the empty record ends the request
+			if len(content) > 0 {
+				continue
+			}
+			params := decodeParams(rawParams)
+			s.mu.Lock()
+			s.requests = append(s.requests, params)
+			s.mu.Unlock()
+
+			out := []byte(handler(params))
+			for len(out) > 0 {
+				n := min(len(out), 65535)
+				writeRecord(conn, 6, reqID, out[:n])
+				out = out[n:]
+			}
+			writeRecord(conn, 6, reqID, nil)
+			writeRecord(conn, 3, reqID, make([]byte, 8))
+			if !keepConn {
+				return
+			}
+		}
+	}
+}
+
+func decodeParams(b []byte) map[string]string {
+	params := make(map[string]string)
+	readLen := func() int {
+		if b[0]>>7 == 0 {
+			n := int(b[0])
+			b = b[1:]
+			return n
+		}
+		n := int(binary.BigEndian.Uint32(b[:4]) & 0x7fffffff)
+		b = b[4:]
+		return n
+	}
+	for len(b) > 0 {
+		nameLen := readLen()
+		valueLen := readLen()
+		params[string(b[:nameLen])] = string(b[nameLen : nameLen+valueLen])
+		b = b[nameLen+valueLen:]
+	}
+	return params
+}
+
+func writeRecord(w io.Writer, recType uint8, reqID uint16, content []byte) {
+	h := [8]byte{1, recType}
+	binary.BigEndian.PutUint16(h[2:4], reqID)
+	binary.BigEndian.PutUint16(h[4:6], uint16(len(content)))
+	w.Write(h[:])
+	w.Write(content)
+}
@@ -0,0 +1,104 @@
+package fcgx
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveRecords answers each request read from conn with body, reporting the
+// flags of its BEGIN_REQUEST record. It leaves the connection open.
+func serveRecords(conn net.Conn, body string, flags chan<- uint8) {
+	defer conn.Close()
+
+	for {
+		var flag uint8
+		for {
+			var h header
+			if err := binary.Read(conn, binary.BigEndian, &h); err != nil {
+				return
+			}
+			content := make([]byte, int(h.ContentLength)+int(h.PaddingLength))
+			if _, err := io.ReadFull(conn, content); err != nil {
+				return
+			}
+			if h.Type == fcgiBeginRequest {
+				flag = content[2]
+			}
+			if h.Type == fcgiStdin && h.ContentLength == 0 {
+				break
+			}
+		}
+		flags <- flag
+
+		stdout := []byte("Content-Type: text/plain\r\n\r\n" + body)
+		records := []struct {
+			recType uint8
+			content []byte
+		}{
+			{fcgiStdout, stdout},
+			{fcgiStdout, nil},
+			{fcgiEndRequest, make([]byte, 8)},
+		}
+		for _, r := range records {
+			h := header{Version: fcgiVersion1, Type: r.recType, RequestID: 1, ContentLength: uint16(len(r.content))}
+			if err := binary.Write(conn, binary.BigEndian, h); err != nil {
+				return
+			}
+			if _, err := conn.Write(r.content); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestKeepConn(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	flags := make(chan uint8, 2)
+	go serveRecords(serverConn, "pong", flags)
+
+	config := DefaultConfig()
+	config.KeepConn = true
+	client := NewClient(clientConn, config)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		resp, err := client.Get(ctx, map[string]string{"SCRIPT_NAME": "/ping"})
+		cancel()
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Reading body %d failed: %v", i, err)
+		}
+		if string(body) != "pong" {
+			t.Errorf("Expected body %q, got %q", "pong", body)
+		}
+		if flag := <-flags; flag != fcgiKeepConn {
+			t.Errorf("Expected FCGI_KEEP_CONN in request %d, got flags %d", i, flag)
+		}
+	}
+}
+
+func TestKeepConnDisabled(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	flags := make(chan uint8, 1)
+	go serveRecords(serverConn, "pong", flags)
+
+	client := NewClient(clientConn, nil)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := client.Get(ctx, map[string]string{"SCRIPT_NAME": "/ping"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if flag := <-flags; flag != 0 {
+		t.Errorf("Expected no flags, got %d", flag)
+	}
+}
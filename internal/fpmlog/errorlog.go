@@ -0,0 +1,180 @@
+package fpmlog
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+// Error log events counted per pool.
+const (
+	EventSegfault     = "segfault"
+	EventTerminated   = "terminated"
+	EventTimeout      = "timeout"
+	EventMaxChildren  = "max_children"
+	EventSpawnFailure = "spawn_failure"
+)
+
+// ErrorLogEvents lists every event kind.
+var ErrorLogEvents = []string{EventSegfault, EventTerminated, EventTimeout, EventMaxChildren, EventSpawnFailure}
+
+// GlobalPool attributes events logged by the master outside of any pool.
+const GlobalPool = "global"
+
+var (
+	errorLogPool   = regexp.MustCompile(`\[pool ([^\]]+)\]`)
+	errorLogSignal = regexp.MustCompile(`exited on signal ([0-9]+)`)
+)
+
+// ParseErrorLogLine classifies an FPM error log line. It returns the pool the
+// line belongs to and the event, or ok false for lines that are not counted.
+func ParseErrorLogLine(line string) (pool, event string, ok bool) {
+	switch {
+	case strings.Contains(line, "execution timed out"):
+		event = EventTimeout
+	case strings.Contains(line, "reached pm.max_children"), strings.Contains(line, "reached max_children"):
+		event = EventMaxChildren
+	case strings.Contains(line, "fork() failed"), strings.Contains(line, "unable to spawn"), strings.Contains(line, "failed to spawn"):
+		event = EventSpawnFailure
+	default:
+		m := errorLogSignal.FindStringSubmatch(line)
+		if m == nil {
+			return "", "", false
+		}
+		// SIGSEGV and SIGBUS are crashes, everything else was killed
+		if m[1] == "11" || m[1] == "7" {
+			event = EventSegfault
+		} else {
+			event = EventTerminated
+		}
+	}
+
+	pool = GlobalPool
+	if m := errorLogPool.FindStringSubmatch(line); m != nil {
+		pool = m[1]
+	}
+	return pool, event, true
+}
+
+// ErrorLogKey identifies an error log event counter.
+type ErrorLogKey struct {
+	Pool  string
+	Event string
+}
+
+// ErrorLogMonitor tails the global error_log of each FPM master and counts
+// worker crashes, timeouts and process limit warnings per pool.
+type ErrorLogMonitor struct {
+	mu      sync.Mutex
+	tailers map[string]*Tailer
+	counts  map[ErrorLogKey]uint64
+	refs    socketRefs
+}
+
+func NewErrorLogMonitor() *ErrorLogMonitor {
+	return &ErrorLogMonitor{
+		tailers: make(map[string]*Tailer),
+		counts:  make(map[ErrorLogKey]uint64),
+		refs:    newSocketRefs(),
+	}
+}
+
+// Observe reads new lines from the error_log of the master behind result.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (m *ErrorLogMonitor) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	path := result.Global["error_log"]
+	if !tailable(path) {
+		return
+	}
+
+	path = phpfpm.HostPath(result.Root, path)
+
+	// Known pools report zero rather than no series until their first event
+	m.mu.Lock()
+	m.refs.addPath(socket, path)
+	for name := range result.Pools {
+		m.refs.addPool(socket, name)
+		for _, event := range ErrorLogEvents {
+			key := ErrorLogKey{Pool: name, Event: event}
+			if _, ok := m.counts[key]; !ok {
+				m.counts[key] = 0
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	m.Poll(path)
+}
+
+// Forget closes the error logs only the socket's master used and drops the
+// counters of pools no remaining socket reports, once the socket is no longer
+// collected. Events of the masters themselves are kept.
+// It matches metrics.PoolRemovedListener.
+func (m *ErrorLogMonitor) Forget(socket string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, path := range m.refs.forget(socket) {
+		if tailer, ok := m.tailers[path]; ok {
+			tailer.Close()
+			delete(m.tailers, path)
+		}
+	}
+	for key := range m.counts {
+		if key.Pool != GlobalPool && !m.refs.hasPool(key.Pool) {
+			delete(m.counts, key)
+		}
+	}
+}
+
+// tailable reports whether path is a regular log file the exporter can read:
+// not syslog, not relative to an unknown prefix and not the master's stderr.
+func tailable(path string) bool {
+	if path == "" || !filepath.IsAbs(path) {
+		return false
+	}
+	return !strings.HasPrefix(path, "/proc/self/") && !strings.HasPrefix(path, "/dev/")
+}
+
+// Poll reads new lines from the error log at path.
+func (m *ErrorLogMonitor) Poll(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tailer, ok := m.tailers[path]
+	if !ok {
+		tailer = NewTailer(path, false)
+		m.tailers[path] = tailer
+	}
+
+	lines, err := tailer.Lines()
+	if err != nil {
+		logging.L().Debug("PHPeek failed to read FPM error log", "path", path, "error", err)
+	}
+
+	for _, line := range lines {
+		if pool, event, ok := ParseErrorLogLine(line); ok {
+			m.counts[ErrorLogKey{Pool: pool, Event: event}]++
+		}
+	}
+}
+
+// Counts returns a copy of the event counters.
+func (m *ErrorLogMonitor) Counts() map[ErrorLogKey]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[ErrorLogKey]uint64, len(m.counts))
+	for k, v := range m.counts {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package fpmlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+func TestParseErrorLogLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		pool  string
+		event string
+		ok    bool
+	}{
+		{
+			name:  "segfault",
+			line:  "[16-Oct-2026 10:06:40] WARNING: [pool www] child 1288 exited on signal 11 (SIGSEGV - core dumped) after 312.45 seconds from start",
+			pool:  "www",
+			event: EventSegfault,
+			ok:    true,
+		},
+		{
+			name:  "killed",
+			line:  "[16-Oct-2026 10:07:01] WARNING: [pool api] child 1301 exited on signal 9 (SIGKILL) after 95.0 seconds from start",
+			pool:  "api",
+			event: EventTerminated,
+			ok:    true,
+		},
+		{
+			name:  "timeout",
+			line:  `[16-Oct-2026 10:07:01] WARNING: [pool api] child 1301, script '/index.php' (request: "GET /index.php") execution timed out (30.1 sec), terminating`,
+			pool:  "api",
+			event: EventTimeout,
+			ok:    true,
+		},
+		{
+			name:  "max children",
+			line:  "[16-Oct-2026 10:05:13] WARNING: [pool www] server reached pm.max_children setting (20), consider raising it",
+			pool:  "www",
+			event: EventMaxChildren,
+			ok:    true,
+		},
+		{
+			name:  "spawn failure without pool",
+			line:  "[16-Oct-2026 10:09:30] ALERT: fork() failed: Cannot allocate memory (12)",
+			pool:  GlobalPool,
+			event: EventSpawnFailure,
+			ok:    true,
+		},
+		{
+			name: "clean exit",
+			line: "[16-Oct-2026 10:11:00] NOTICE: [pool www] child 1290 exited with code 0 after 600.0 seconds from start",
+		},
+		{
+			name: "busy notice",
+			line: "[16-Oct-2026 10:05:12] WARNING: [pool www] seems busy (you may need to increase pm.start_servers), spawning 8 children",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, event, ok := ParseErrorLogLine(tt.line)
+			if ok != tt.ok || pool != tt.pool || event != tt.event {
+				t.Errorf("ParseErrorLogLine() = (%q, %q, %v), want (%q, %q, %v)", pool, event, ok, tt.pool, tt.event, tt.ok)
+			}
+		})
+	}
+}
+
+func TestErrorLogMonitor_Observe(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "error.log"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "php-fpm.log")
+	appendFile(t, path, "[16-Oct-2026 09:00:00] WARNING: [pool www] child 1 exited on signal 11 (SIGSEGV)\n")
+
+	result := &phpfpm.Result{
+		Pools:  map[string]phpfpm.Pool{"www": {Name: "www"}, "api": {Name: "api"}, "idle": {Name: "idle"}},
+		Global: map[string]string{"error_log": path},
+	}
+
+	monitor := NewErrorLogMonitor()
+	monitor.Observe("sock", result)
+
+	counts := monitor.Counts()
+	if n, ok := counts[ErrorLogKey{Pool: "www", Event: EventSegfault}]; !ok || n != 0 {
+		t.Fatalf("Expected existing lines to be skipped with a zero counter, got %v", counts)
+	}
+
+	appendFile(t, path, string(fixture))
+	monitor.Observe("sock", result)
+
+	counts = monitor.Counts()
+	want := map[ErrorLogKey]uint64{
+		{Pool: "www", Event: EventSegfault}:          2,
+		{Pool: "www", Event: EventMaxChildren}:       2,
+		{Pool: "www", Event: EventTerminated}:        0,
+		{Pool: "api", Event: EventTimeout}:           1,
+		{Pool: "api", Event: EventTerminated}:        1,
+		{Pool: "api", Event: EventSpawnFailure}:      1,
+		{Pool: GlobalPool, Event: EventSpawnFailure}: 1,
+		{Pool: "idle", Event: EventSegfault}:         0,
+	}
+	for key, n := range want {
+		got, ok := counts[key]
+		if !ok || got != n {
+			t.Errorf("Expected %+v to be %d, got %d (present: %v)", key, n, got, ok)
+		}
+	}
+}
+
+func TestErrorLogMonitor_Root(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	root := t.TempDir()
+	path := filepath.Join(root, "php-fpm.log")
+	appendFile(t, path, "")
+
+	// The master writes /php-fpm.log, which is below its root for the exporter
+	result := &phpfpm.Result{
+		Pools:  map[string]phpfpm.Pool{"www": {Name: "www"}},
+		Global: map[string]string{"error_log": "/php-fpm.log"},
+		Root:   root,
+	}
+
+	monitor := NewErrorLogMonitor()
+	monitor.Observe("sock", result)
+	appendFile(t, path, "[16-Oct-2026 09:00:00] WARNING: [pool www] child 1 exited on signal 11 (SIGSEGV)\n")
+	monitor.Observe("sock", result)
+
+	if n := monitor.Counts()[ErrorLogKey{Pool: "www", Event: EventSegfault}]; n != 1 {
+		t.Errorf("Expected the log below the root to be read, got %d", n)
+	}
+}
+
+func TestErrorLogMonitor_SkipsUntailablePaths(t *testing.T) {
+	tests := []string{"", "syslog", "log/php-fpm.log", "/proc/self/fd/2", "/dev/stderr"}
+
+	for _, path := range tests {
+		if tailable(path) {
+			t.Errorf("Expected %q not to be tailed", path)
+		}
+	}
+
+	if !tailable("/var/log/php-fpm.log") {
+		t.Errorf("Expected absolute log path to be tailed")
+	}
+}
+
+func TestErrorLogMonitor_Forget(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	dir := t.TempDir()
+	wwwLog := filepath.Join(dir, "www.log")
+	apiLog := filepath.Join(dir, "api.log")
+	appendFile(t, wwwLog, "")
+	appendFile(t, apiLog, "")
+
+	monitor := NewErrorLogMonitor()
+	monitor.Observe("a", &phpfpm.Result{
+		Pools:  map[string]phpfpm.Pool{"www": {Name: "www"}},
+		Global: map[string]string{"error_log": wwwLog},
+	})
+	monitor.Observe("b", &phpfpm.Result{
+		Pools:  map[string]phpfpm.Pool{"api": {Name: "api"}},
+		Global: map[string]string{"error_log": apiLog},
+	})
+
+	monitor.Forget("a")
+
+	for key := range monitor.Counts() {
+		if key.Pool == "www" {
+			t.Errorf("Expected the counters of the removed master to be dropped, got %+v", key)
+		}
+	}
+	if _, ok := monitor.Counts()[ErrorLogKey{Pool: "api", Event: EventSegfault}]; !ok {
+		t.Errorf("Expected the counters of other masters to be kept")
+	}
+	if _, ok := monitor.tailers[wwwLog]; ok {
+		t.Errorf("Expected the removed master's error log to be closed")
+	}
+	if _, ok := monitor.tailers[apiLog]; !ok {
+		t.Errorf("Expected other error logs to stay open")
+	}
+}
@@ -0,0 +1,254 @@
+package fpmlog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+// maxSlowlogSeries bounds the distinct {pool, script, top_frame} counters.
+// Further entries are counted under script and top_frame "other".
+const maxSlowlogSeries = 1000
+
+var (
+	slowlogHeader = regexp.MustCompile(`^\[([^\]]+)\]\s+\[pool ([^\]]+)\] pid ([0-9]+)`)
+	slowlogFrame  = regexp.MustCompile(`^\[0x[0-9a-fA-F]+\] (.*)$`)
+
+	logTimeLayouts = []string{
+		"02-Jan-2006 15:04:05",
+		"02-Jan-2006 15:04:05.000000",
+		"02-Jan-2006 15:04:05 MST",
+		"02-Jan-2006 15:04:05.000000 MST",
+	}
+)
+
+// SlowlogEntry is one stack trace block of an FPM slowlog.
+type SlowlogEntry struct {
+	Time   time.Time `json:"time"`
+	Pool   string    `json:"pool"`
+	PID    int       `json:"pid"`
+	Script string    `json:"script"`
+	Frames []string  `json:"frames"`
+}
+
+// TopFrame returns the innermost frame, where the request was stuck.
+func (e SlowlogEntry) TopFrame() string {
+	if len(e.Frames) == 0 {
+		return "unknown"
+	}
+	return e.Frames[0]
+}
+
+// SlowlogParser assembles slowlog blocks from lines. A block may arrive over
+// several reads, so the parser keeps the block in progress.
+type SlowlogParser struct {
+	current *SlowlogEntry
+}
+
+// Feed consumes a line and returns the entry it completed, if any.
+func (p *SlowlogParser) Feed(line string) (SlowlogEntry, bool) {
+	line = strings.TrimSpace(line)
+
+	if m := slowlogHeader.FindStringSubmatch(line); m != nil {
+		done, ok := p.Flush()
+		pid, _ := strconv.Atoi(m[3])
+		p.current = &SlowlogEntry{
+			Time: parseLogTime(m[1]),
+			Pool: m[2],
+			PID:  pid,
+		}
+		return done, ok
+	}
+
+	if p.current == nil {
+		return SlowlogEntry{}, false
+	}
+
+	switch {
+	case line == "":
+		return p.Flush()
+	case strings.HasPrefix(line, "script_filename"):
+		if _, v, ok := strings.Cut(line, "="); ok {
+			p.current.Script = strings.TrimSpace(v)
+		}
+	default:
+		if m := slowlogFrame.FindStringSubmatch(line); m != nil {
+			p.current.Frames = append(p.current.Frames, m[1])
+		}
+	}
+	return SlowlogEntry{}, false
+}
+
+// Flush returns the block in progress, if any.
+func (p *SlowlogParser) Flush() (SlowlogEntry, bool) {
+	if p.current == nil {
+		return SlowlogEntry{}, false
+	}
+	entry := *p.current
+	p.current = nil
+	return entry, true
+}
+
+func parseLogTime(s string) time.Time {
+	for _, layout := range logTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SlowlogKey identifies a slowlog entry counter.
+type SlowlogKey struct {
+	Pool     string
+	Script   string
+	TopFrame string
+}
+
+type slowlogSource struct {
+	tailer *Tailer
+	parser SlowlogParser
+}
+
+// SlowlogMonitor tails the slowlog of every pool it is shown, counts entries
+// and keeps the most recent ones.
+type SlowlogMonitor struct {
+	mu      sync.Mutex
+	sources map[string]*slowlogSource
+	counts  map[SlowlogKey]uint64
+	recent  []SlowlogEntry
+	limit   int
+	refs    socketRefs
+}
+
+func NewSlowlogMonitor(limit int) *SlowlogMonitor {
+	return &SlowlogMonitor{
+		sources: make(map[string]*slowlogSource),
+		counts:  make(map[SlowlogKey]uint64),
+		limit:   limit,
+		refs:    newSocketRefs(),
+	}
+}
+
+// Observe reads new entries from the slowlog of each pool in result.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (m *SlowlogMonitor) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	for name, pool := range result.Pools {
+		path := strings.ReplaceAll(pool.Config["slowlog"], "$pool", name)
+
+		m.mu.Lock()
+		m.refs.addPool(socket, name)
+		if path != "" {
+			path = phpfpm.HostPath(result.Root, path)
+			m.refs.addPath(socket, path)
+		}
+		m.mu.Unlock()
+
+		if path == "" {
+			continue
+		}
+
+		m.Poll(path)
+	}
+}
+
+// Forget closes the slowlogs only the socket's pools used and drops the
+// counters and recent entries of pools no remaining socket reports, once the
+// socket is no longer collected.
+// It matches metrics.PoolRemovedListener.
+func (m *SlowlogMonitor) Forget(socket string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, path := range m.refs.forget(socket) {
+		if src, ok := m.sources[path]; ok {
+			src.tailer.Close()
+			delete(m.sources, path)
+		}
+	}
+	for key := range m.counts {
+		if !m.refs.hasPool(key.Pool) {
+			delete(m.counts, key)
+		}
+	}
+	recent := m.recent[:0]
+	for _, entry := range m.recent {
+		if m.refs.hasPool(entry.Pool) {
+			recent = append(recent, entry)
+		}
+	}
+	m.recent = recent
+}
+
+// Poll reads new entries from the slowlog at path. Pools sharing a slowlog
+// are read once, and entries are attributed by the pool in their header.
+func (m *SlowlogMonitor) Poll(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, ok := m.sources[path]
+	if !ok {
+		src = &slowlogSource{tailer: NewTailer(path, false)}
+		m.sources[path] = src
+	}
+
+	lines, err := src.tailer.Lines()
+	if err != nil {
+		logging.L().Debug("PHPeek failed to read slowlog", "path", path, "error", err)
+	}
+
+	for _, line := range lines {
+		if entry, ok := src.parser.Feed(line); ok {
+			m.add(entry)
+		}
+	}
+}
+
+func (m *SlowlogMonitor) add(entry SlowlogEntry) {
+	key := SlowlogKey{Pool: entry.Pool, Script: entry.Script, TopFrame: entry.TopFrame()}
+	if _, ok := m.counts[key]; !ok && len(m.counts) >= maxSlowlogSeries {
+		key = SlowlogKey{Pool: entry.Pool, Script: "other", TopFrame: "other"}
+	}
+	m.counts[key]++
+
+	if m.limit <= 0 {
+		return
+	}
+	m.recent = append(m.recent, entry)
+	if len(m.recent) > m.limit {
+		m.recent = m.recent[len(m.recent)-m.limit:]
+	}
+}
+
+// Counts returns a copy of the entry counters.
+func (m *SlowlogMonitor) Counts() map[SlowlogKey]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[SlowlogKey]uint64, len(m.counts))
+	for k, v := range m.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// Recent returns the most recent entries, newest first.
+func (m *SlowlogMonitor) Recent() []SlowlogEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]SlowlogEntry, len(m.recent))
+	for i, entry := range m.recent {
+		out[len(m.recent)-1-i] = entry
+	}
+	return out
+}
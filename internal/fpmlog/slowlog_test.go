@@ -0,0 +1,188 @@
+package fpmlog
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+func parseFixture(t *testing.T, name string) []SlowlogEntry {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	var parser SlowlogParser
+	var entries []SlowlogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if entry, ok := parser.Feed(scanner.Text()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if entry, ok := parser.Flush(); ok {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSlowlogParser_Fixture(t *testing.T) {
+	entries := parseFixture(t, "slowlog.log")
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	first := entries[0]
+	if first.Pool != "www" || first.PID != 1234 {
+		t.Errorf("Expected pool www pid 1234, got %s %d", first.Pool, first.PID)
+	}
+	if first.Script != "/var/www/html/public/index.php" {
+		t.Errorf("Unexpected script: %s", first.Script)
+	}
+	if len(first.Frames) != 4 {
+		t.Errorf("Expected 4 frames, got %d", len(first.Frames))
+	}
+	if first.TopFrame() != "sleep() /var/www/html/app/Http/Controllers/ReportController.php:42" {
+		t.Errorf("Unexpected top frame: %s", first.TopFrame())
+	}
+
+	want := time.Date(2026, time.October, 16, 10, 15, 2, 0, time.Local)
+	if !first.Time.Equal(want) {
+		t.Errorf("Expected time %v, got %v", want, first.Time)
+	}
+
+	if entries[1].Pool != "api" || entries[1].TopFrame() != "curl_exec() /var/www/api/app/Services/Gateway.php:88" {
+		t.Errorf("Unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestSlowlogParser_HeaderEndsBlock(t *testing.T) {
+	var parser SlowlogParser
+
+	// Without a blank line between blocks the next header completes the previous one
+	lines := []string{
+		"[16-Oct-2026 10:00:00]  [pool www] pid 1",
+		"script_filename = /a.php",
+		"[0x0000000000000001] foo() /a.php:1",
+		"[16-Oct-2026 10:00:01]  [pool www] pid 2",
+	}
+
+	var entries []SlowlogEntry
+	for _, line := range lines {
+		if entry, ok := parser.Feed(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) != 1 || entries[0].PID != 1 {
+		t.Fatalf("Expected the first block to be completed, got %+v", entries)
+	}
+
+	entry, ok := parser.Flush()
+	if !ok || entry.PID != 2 || entry.TopFrame() != "unknown" {
+		t.Errorf("Expected an empty second block, got %+v", entry)
+	}
+}
+
+func TestSlowlogMonitor_Observe(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "slowlog.log"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "www.slow.log")
+	appendFile(t, path, "[16-Oct-2026 09:00:00]  [pool www] pid 1\n\n")
+
+	result := &phpfpm.Result{
+		Pools: map[string]phpfpm.Pool{
+			"www": {Name: "www", Config: map[string]string{"slowlog": filepath.Join(dir, "$pool.slow.log")}},
+			// Pools without a slowlog are skipped
+			"api": {Name: "api"},
+		},
+	}
+
+	monitor := NewSlowlogMonitor(2)
+
+	// Entries written before the exporter started are not counted
+	monitor.Observe("sock", result)
+	if len(monitor.Counts()) != 0 {
+		t.Fatalf("Expected existing entries to be skipped, got %v", monitor.Counts())
+	}
+
+	appendFile(t, path, string(fixture))
+	monitor.Observe("sock", result)
+
+	counts := monitor.Counts()
+	key := SlowlogKey{
+		Pool:     "www",
+		Script:   "/var/www/html/public/index.php",
+		TopFrame: "sleep() /var/www/html/app/Http/Controllers/ReportController.php:42",
+	}
+	if counts[key] != 2 {
+		t.Errorf("Expected 2 entries for %+v, got %v", key, counts)
+	}
+	if len(counts) != 2 {
+		t.Errorf("Expected 2 counters, got %d", len(counts))
+	}
+
+	recent := monitor.Recent()
+	if len(recent) != 2 {
+		t.Fatalf("Expected recent entries to be limited to 2, got %d", len(recent))
+	}
+	if recent[0].PID != 1240 || recent[1].PID != 1301 {
+		t.Errorf("Expected newest entries first, got pids %d, %d", recent[0].PID, recent[1].PID)
+	}
+}
+
+func TestSlowlogMonitor_Forget(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "slowlog.log"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "www.slow.log")
+	appendFile(t, path, "")
+	result := &phpfpm.Result{
+		Pools: map[string]phpfpm.Pool{
+			"www": {Name: "www", Config: map[string]string{"slowlog": path}},
+		},
+	}
+
+	monitor := NewSlowlogMonitor(10)
+	monitor.Observe("a", result)
+	monitor.Observe("b", result)
+	appendFile(t, path, string(fixture))
+	monitor.Observe("a", result)
+
+	// Another socket still reports the pool and its slowlog
+	monitor.Forget("a")
+	if len(monitor.Counts()) == 0 || len(monitor.sources) != 1 {
+		t.Fatalf("Expected a slowlog shared with another socket to be kept, got %v", monitor.Counts())
+	}
+
+	monitor.Forget("b")
+	if len(monitor.Counts()) != 0 || len(monitor.Recent()) != 0 {
+		t.Errorf("Expected the pool's entries to be dropped, got %v and %d recent", monitor.Counts(), len(monitor.Recent()))
+	}
+	if len(monitor.sources) != 0 {
+		t.Errorf("Expected the slowlog to be closed, got %d sources", len(monitor.sources))
+	}
+}
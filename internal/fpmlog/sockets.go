@@ -0,0 +1,70 @@
+package fpmlog
+
+// socketRefs remembers the log files and pool names each socket reported, so
+// the tailers and counters of a socket that is no longer collected can be
+// dropped once no other socket uses them. Pools of different masters may
+// share a log file or a name.
+type socketRefs struct {
+	paths map[string]map[string]struct{} // socket -> log paths
+	pools map[string]map[string]struct{} // socket -> pool names
+}
+
+func newSocketRefs() socketRefs {
+	return socketRefs{
+		paths: make(map[string]map[string]struct{}),
+		pools: make(map[string]map[string]struct{}),
+	}
+}
+
+func (r socketRefs) addPath(socket, path string) {
+	addRef(r.paths, socket, path)
+}
+
+func (r socketRefs) addPool(socket, name string) {
+	addRef(r.pools, socket, name)
+}
+
+// forget drops socket and returns the paths no other socket reported.
+func (r socketRefs) forget(socket string) []string {
+	delete(r.pools, socket)
+	return forgetRef(r.paths, socket)
+}
+
+// hasPool reports whether any socket reported the pool name.
+func (r socketRefs) hasPool(name string) bool {
+	for _, pools := range r.pools {
+		if _, ok := pools[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func addRef(refs map[string]map[string]struct{}, socket, value string) {
+	values, ok := refs[socket]
+	if !ok {
+		values = make(map[string]struct{})
+		refs[socket] = values
+	}
+	values[value] = struct{}{}
+}
+
+func forgetRef(refs map[string]map[string]struct{}, socket string) []string {
+	values := refs[socket]
+	delete(refs, socket)
+
+	var unused []string
+	for value := range values {
+		used := false
+		for _, other := range refs {
+			if _, ok := other[value]; ok {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, value)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,154 @@
+package fpmlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxLineLength bounds a line without newline kept between reads.
+const maxLineLength = 64 * 1024
+
+// Tailer returns the lines appended to a file since the previous read. It is
+// polled rather than notified, and follows the path across rotation (rename
+// or re-create) and truncation (copytruncate).
+type Tailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	seekEnd bool
+}
+
+// NewTailer creates a tailer for path. Unless fromStart is set, content that
+// already exists when the file is first opened is skipped; a file created
+// later is always read from the beginning.
+func NewTailer(path string, fromStart bool) *Tailer {
+	return &Tailer{
+		path:    path,
+		seekEnd: !fromStart,
+	}
+}
+
+func (t *Tailer) Path() string {
+	return t.path
+}
+
+// Lines returns the complete lines written since the last call.
+func (t *Tailer) Lines() ([]string, error) {
+	if t.file == nil {
+		seekEnd := t.seekEnd
+		t.seekEnd = false
+		if err := t.open(seekEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := t.read()
+	if err != nil {
+		return lines, err
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// Rotated away and not re-created yet; keep the old file open
+		if errors.Is(err, os.ErrNotExist) {
+			return lines, nil
+		}
+		return lines, fmt.Errorf("failed to stat %s: %w", t.path, err)
+	}
+
+	switch {
+	case !os.SameFile(t.info, info):
+		// Rotated: the old file is drained, continue with the new one
+		t.Close()
+		if err := t.open(false); err != nil {
+			return lines, err
+		}
+	case info.Size() < t.offset:
+		// Truncated in place
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return lines, fmt.Errorf("failed to rewind %s: %w", t.path, err)
+		}
+		t.offset = 0
+		t.partial = nil
+	default:
+		return lines, nil
+	}
+
+	more, err := t.read()
+	return append(lines, more...), err
+}
+
+// Close releases the open file. The next call to Lines reopens the path.
+func (t *Tailer) Close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+	t.offset = 0
+	t.partial = nil
+}
+
+func (t *Tailer) open(seekEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", t.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat %s: %w", t.path, err)
+	}
+
+	t.file = f
+	t.info = info
+	t.offset = 0
+	t.partial = nil
+
+	if seekEnd {
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			t.Close()
+			return fmt.Errorf("failed to seek %s: %w", t.path, err)
+		}
+		t.offset = offset
+	}
+	return nil
+}
+
+func (t *Tailer) read() ([]string, error) {
+	data, err := io.ReadAll(t.file)
+	t.offset += int64(len(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", t.path, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	data = append(t.partial, data...)
+	t.partial = nil
+
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(bytes.TrimSuffix(data[:i], []byte("\r"))))
+		data = data[i+1:]
+	}
+
+	if len(data) > maxLineLength {
+		lines = append(lines, string(data))
+	} else if len(data) > 0 {
+		t.partial = append([]byte(nil), data...)
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,150 @@
+package fpmlog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func expectLines(t *testing.T, tailer *Tailer, want ...string) {
+	t.Helper()
+
+	got, err := tailer.Lines()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected lines %q, got %q", want, got)
+	}
+}
+
+func TestTailer_SkipsExistingContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fpm.log")
+	appendFile(t, path, "old line\n")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+
+	expectLines(t, tailer)
+
+	appendFile(t, path, "new line\n")
+	expectLines(t, tailer, "new line")
+}
+
+func TestTailer_FromStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fpm.log")
+	appendFile(t, path, "first\nsecond\n")
+
+	tailer := NewTailer(path, true)
+	defer tailer.Close()
+
+	expectLines(t, tailer, "first", "second")
+}
+
+func TestTailer_PartialLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fpm.log")
+	appendFile(t, path, "")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+	expectLines(t, tailer)
+
+	// A line is only returned once its newline has been written
+	appendFile(t, path, "half")
+	expectLines(t, tailer)
+
+	appendFile(t, path, " done\r\nnext\n")
+	expectLines(t, tailer, "half done", "next")
+}
+
+func TestTailer_FileCreatedLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fpm.log")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+
+	if _, err := tailer.Lines(); err == nil {
+		t.Errorf("Expected error while the file does not exist")
+	}
+
+	// Content of a file that appears later is new and must not be skipped
+	appendFile(t, path, "created\n")
+	expectLines(t, tailer, "created")
+}
+
+func TestTailer_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fpm.log")
+	appendFile(t, path, "")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+	expectLines(t, tailer)
+
+	// Lines written just before the rename are still read from the old file
+	appendFile(t, path, "before rotation\n")
+	if err := os.Rename(path, filepath.Join(dir, "fpm.log.1")); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	appendFile(t, path, "after rotation\n")
+
+	expectLines(t, tailer, "before rotation", "after rotation")
+
+	appendFile(t, path, "later\n")
+	expectLines(t, tailer, "later")
+}
+
+func TestTailer_RotatedAwayWithoutNewFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fpm.log")
+	appendFile(t, path, "")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+	expectLines(t, tailer)
+
+	if err := os.Rename(path, filepath.Join(dir, "fpm.log.1")); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	expectLines(t, tailer)
+
+	appendFile(t, path, "recreated\n")
+	expectLines(t, tailer, "recreated")
+}
+
+func TestTailer_Truncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fpm.log")
+	appendFile(t, path, "")
+
+	tailer := NewTailer(path, false)
+	defer tailer.Close()
+	expectLines(t, tailer)
+
+	appendFile(t, path, "one\ntwo\n")
+	expectLines(t, tailer, "one", "two")
+
+	// copytruncate empties the file in place
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	appendFile(t, path, "x\n")
+	expectLines(t, tailer, "x")
+}
@@ -0,0 +1,142 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// Client is a minimal client of the Kubernetes API, covering what pool
+// discovery needs: listing pods.
+type Client struct {
+	server    string
+	tokenFile string
+	http      *http.Client
+}
+
+// Pod is the part of a pod object discovery reads.
+type Pod struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Status struct {
+		Phase string `json:"phase"`
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+type podList struct {
+	Items    []Pod `json:"items"`
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+}
+
+// NewClient returns a client of the API server in cfg, or of the cluster the
+// exporter runs in when none is set. The CA file is optional; without it the
+// system roots are used.
+func NewClient(cfg config.KubernetesConfig) (*Client, error) {
+	server := cfg.APIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("no api_server configured and not running in a cluster")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in CA file %s", cfg.CAFile)
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+	}
+
+	return &Client{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: cfg.TokenFile,
+		http:      &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}, nil
+}
+
+// ListPods returns the pods in namespace, or in all namespaces when it is
+// empty, that match labelSelector. Large lists are read in pages.
+func (c *Client) ListPods(ctx context.Context, namespace, labelSelector string) ([]Pod, error) {
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	}
+
+	var pods []Pod
+	query := url.Values{"limit": {"500"}}
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+	for {
+		var page podList
+		if err := c.get(ctx, path+"?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+		pods = append(pods, page.Items...)
+		if page.Metadata.Continue == "" {
+			return pods, nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	// Projected service account tokens are rotated, so the file is read
+	// for every request
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("kubernetes API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kubernetes API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse kubernetes API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// fakeAPIServer serves pod lists the way the Kubernetes API does, in pages
+// of pageSize, and records the requests it gets.
+type fakeAPIServer struct {
+	*httptest.Server
+	pods     []Pod
+	pageSize int
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func startFakeAPIServer(t *testing.T, pods []Pod) *fakeAPIServer {
+	t.Helper()
+
+	f := &fakeAPIServer{pods: pods, pageSize: len(pods)}
+	f.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		f.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, `{"kind":"Status","message":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		namespace := ""
+		switch {
+		case r.URL.Path == "/api/v1/pods":
+		case strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/") && strings.HasSuffix(r.URL.Path, "/pods"):
+			namespace = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/pods")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		var matching []Pod
+		for _, pod := range f.pods {
+			if namespace == "" || pod.Metadata.Namespace == namespace {
+				matching = append(matching, pod)
+			}
+		}
+
+		start := 0
+		if c := r.URL.Query().Get("continue"); c != "" {
+			start = len(c) // the token is as long as the offset
+		}
+		end := min(start+f.pageSize, len(matching))
+
+		var page podList
+		page.Items = matching[start:end]
+		if end < len(matching) {
+			page.Metadata.Continue = strings.Repeat("x", end)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Requests returns the requests served so far.
+func (f *fakeAPIServer) Requests() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...)
+}
+
+// clientConfig returns the configuration to reach the fake API server,
+// trusting its certificate and sending test-token.
+func (f *fakeAPIServer) clientConfig(t *testing.T) config.KubernetesConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("test-token\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	return config.KubernetesConfig{
+		APIServer:  f.URL,
+		Annotation: "phpeek.io/fpm-status",
+		TokenFile:  tokenFile,
+		CAFile:     caFile,
+	}
+}
+
+func newPod(namespace, name, ip string, annotations map[string]string) Pod {
+	var pod Pod
+	pod.Metadata.Namespace = namespace
+	pod.Metadata.Name = name
+	pod.Metadata.Annotations = annotations
+	pod.Status.Phase = "Running"
+	pod.Status.PodIP = ip
+	return pod
+}
+
+func TestClient_ListPods(t *testing.T) {
+	api := startFakeAPIServer(t, []Pod{
+		newPod("shop", "web-1", "10.0.0.1", nil),
+		newPod("shop", "web-2", "10.0.0.2", nil),
+		newPod("blog", "web-1", "10.0.1.1", nil),
+	})
+	api.pageSize = 1
+
+	client, err := NewClient(api.clientConfig(t))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	pods, err := client.ListPods(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("ListPods failed: %v", err)
+	}
+	if len(pods) != 3 || len(api.Requests()) != 3 {
+		t.Errorf("Expected 3 pods in 3 pages, got %d pods in %d requests", len(pods), len(api.Requests()))
+	}
+
+	pods, err = client.ListPods(context.Background(), "shop", "app=web")
+	if err != nil {
+		t.Fatalf("ListPods failed: %v", err)
+	}
+	if len(pods) != 2 {
+		t.Errorf("Expected the 2 pods in shop, got %d", len(pods))
+	}
+	if selector := api.Requests()[3].URL.Query().Get("labelSelector"); selector != "app=web" {
+		t.Errorf("Expected the label selector to be sent, got %q", selector)
+	}
+}
+
+func TestClient_ListPods_Errors(t *testing.T) {
+	api := startFakeAPIServer(t, nil)
+	cfg := api.clientConfig(t)
+
+	// No token
+	cfg.TokenFile = filepath.Join(t.TempDir(), "missing")
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.ListPods(context.Background(), "", ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+
+	// Untrusted certificate
+	cfg = api.clientConfig(t)
+	cfg.CAFile = ""
+	client, err = NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.ListPods(context.Background(), "", ""); err == nil {
+		t.Error("Expected a certificate error")
+	}
+}
+
+func TestNewClient_InCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	if _, err := NewClient(config.KubernetesConfig{}); err == nil {
+		t.Error("Expected an error outside a cluster without api_server")
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	client, err := NewClient(config.KubernetesConfig{})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if client.server != "https://10.96.0.1:443" {
+		t.Errorf("Expected the in-cluster service, got %s", client.server)
+	}
+}
@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+// Discoverer finds PHP-FPM pools in pods carrying the configured annotation.
+// Its value lists the status URLs of the pod's pools, separated by commas,
+// e.g. tcp://:9000/status. An empty host stands for the pod's IP.
+type Discoverer struct {
+	client *Client
+	cfg    config.KubernetesConfig
+}
+
+func NewDiscoverer(cfg config.KubernetesConfig) (*Discoverer, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Discoverer{client: client, cfg: cfg}, nil
+}
+
+// Discover lists the pods and returns a pool for every status URL in their
+// annotation. Pods that are not running, have no IP yet or carry an invalid
+// annotation are skipped.
+func (d *Discoverer) Discover(ctx context.Context) ([]config.FPMPoolConfig, error) {
+	pods, err := d.client.ListPods(ctx, d.cfg.Namespace, d.cfg.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var pools []config.FPMPoolConfig
+	for _, pod := range pods {
+		found, err := PoolsFromPod(pod, d.cfg.Annotation)
+		if err != nil {
+			logging.L().Warn("PHPeek Skipping pod with invalid annotation",
+				"namespace", pod.Metadata.Namespace,
+				"pod", pod.Metadata.Name,
+				"annotation", d.cfg.Annotation,
+				"error", err,
+			)
+			continue
+		}
+		pools = append(pools, found...)
+	}
+
+	// Stable order, so merging with other pools resolves the same way each run
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Socket < pools[j].Socket })
+	return pools, nil
+}
+
+// PoolsFromPod returns the pools listed in the pod's annotation, or none when
+// the pod has no such annotation or is not running.
+func PoolsFromPod(pod Pod, annotation string) ([]config.FPMPoolConfig, error) {
+	value, ok := pod.Metadata.Annotations[annotation]
+	if !ok || pod.Status.Phase != "Running" || pod.Status.PodIP == "" {
+		return nil, nil
+	}
+
+	var pools []config.FPMPoolConfig
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		socket, path, err := ParseStatusURL(raw, pod.Status.PodIP)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, config.FPMPoolConfig{
+			Socket:       socket,
+			StatusSocket: socket,
+			StatusPath:   path,
+			Namespace:    pod.Metadata.Namespace,
+			Pod:          pod.Metadata.Name,
+			// Probe scripts are written to the exporter's filesystem, which
+			// the pod's workers cannot read
+			SkipProbes: true,
+			Discovered: true,
+		})
+	}
+	return pools, nil
+}
+
+// ParseStatusURL turns a status URL such as tcp://:9000/status into the
+// socket and status path of a pool, filling in podIP for an empty host. The
+// path defaults to /status.
+func ParseStatusURL(raw, podIP string) (socket, path string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid status URL %q: %w", raw, err)
+	}
+	if u.Scheme != "tcp" {
+		return "", "", fmt.Errorf("invalid status URL %q: only tcp:// is reachable in another pod", raw)
+	}
+	if u.Port() == "" {
+		return "", "", fmt.Errorf("invalid status URL %q: missing port", raw)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		host = podIP
+	}
+	path = u.Path
+	if path == "" {
+		path = "/status"
+	}
+	return "tcp://" + net.JoinHostPort(host, u.Port()), path, nil
+}
@@ -0,0 +1,107 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func TestParseStatusURL(t *testing.T) {
+	tests := []struct {
+		raw        string
+		socket     string
+		path       string
+		shouldFail bool
+	}{
+		{"tcp://:9000/status", "tcp://10.0.0.1:9000", "/status", false},
+		{"tcp://:9001", "tcp://10.0.0.1:9001", "/status", false},
+		{"tcp://127.0.0.1:9000/fpm-status", "tcp://127.0.0.1:9000", "/fpm-status", false},
+		{"tcp://[::1]:9000/status", "tcp://[::1]:9000", "/status", false},
+		{"unix:///run/php/www.sock", "", "", true},
+		{"tcp://:/status", "", "", true},
+		{"://", "", "", true},
+	}
+
+	for _, tt := range tests {
+		socket, path, err := ParseStatusURL(tt.raw, "10.0.0.1")
+		if tt.shouldFail {
+			if err == nil {
+				t.Errorf("Expected an error for %q, got %s %s", tt.raw, socket, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseStatusURL(%q) failed: %v", tt.raw, err)
+			continue
+		}
+		if socket != tt.socket || path != tt.path {
+			t.Errorf("ParseStatusURL(%q) = %s %s, expected %s %s", tt.raw, socket, path, tt.socket, tt.path)
+		}
+	}
+}
+
+func TestPoolsFromPod(t *testing.T) {
+	pod := newPod("shop", "web-1", "10.0.0.1", map[string]string{
+		"phpeek.io/fpm-status": "tcp://:9000/status, tcp://:9001/fpm-status",
+	})
+
+	pools, err := PoolsFromPod(pod, "phpeek.io/fpm-status")
+	if err != nil {
+		t.Fatalf("PoolsFromPod failed: %v", err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %+v", pools)
+	}
+	want := config.FPMPoolConfig{
+		Socket:       "tcp://10.0.0.1:9001",
+		StatusSocket: "tcp://10.0.0.1:9001",
+		StatusPath:   "/fpm-status",
+		Namespace:    "shop",
+		Pod:          "web-1",
+		SkipProbes:   true,
+		Discovered:   true,
+	}
+	if pools[1].Socket != want.Socket || pools[1].StatusSocket != want.StatusSocket || pools[1].StatusPath != want.StatusPath ||
+		pools[1].Namespace != want.Namespace || pools[1].Pod != want.Pod || !pools[1].SkipProbes || !pools[1].Discovered {
+		t.Errorf("Expected %+v, got %+v", want, pools[1])
+	}
+
+	pending := pod
+	pending.Status.Phase = "Pending"
+	if pools, _ := PoolsFromPod(pending, "phpeek.io/fpm-status"); len(pools) != 0 {
+		t.Errorf("Expected no pools for a pending pod, got %+v", pools)
+	}
+	if pools, _ := PoolsFromPod(pod, "example.com/other"); len(pools) != 0 {
+		t.Errorf("Expected no pools without the annotation, got %+v", pools)
+	}
+}
+
+func TestDiscoverer_Discover(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	api := startFakeAPIServer(t, []Pod{
+		newPod("shop", "web-2", "10.0.0.2", map[string]string{"phpeek.io/fpm-status": "tcp://:9000/status"}),
+		newPod("shop", "web-1", "10.0.0.1", map[string]string{"phpeek.io/fpm-status": "tcp://:9000/status"}),
+		newPod("shop", "broken", "10.0.0.3", map[string]string{"phpeek.io/fpm-status": "unix:///run/php.sock"}),
+		newPod("shop", "redis", "10.0.0.4", nil),
+	})
+
+	d, err := NewDiscoverer(api.clientConfig(t))
+	if err != nil {
+		t.Fatalf("NewDiscoverer failed: %v", err)
+	}
+
+	pools, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Expected the pools of the 2 annotated web pods, got %+v", pools)
+	}
+	if pools[0].Pod != "web-1" || pools[1].Pod != "web-2" {
+		t.Errorf("Expected pools sorted by socket, got %s and %s", pools[0].Pod, pools[1].Pod)
+	}
+}
@@ -4,30 +4,91 @@ import (
 	"context"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/laravel"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/server"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
 )
 
 type Listener func(*Metrics)
 
+// PoolListener is called after every scrape of a single pool, keyed by socket.
+type PoolListener func(socket string, result *phpfpm.Result)
+
+// PoolRemovedListener is called once a pool is no longer collected, after its
+// last PoolListener call, so state kept for its socket can be dropped.
+type PoolRemovedListener func(socket string)
+
 type Collector struct {
-	cfg       *config.Config
-	interval  time.Duration
-	listeners []Listener
-	mu        sync.Mutex
-	results   map[string]*phpfpm.Result
+	cfg           *config.Config
+	interval      time.Duration
+	listeners     []Listener
+	poolListeners []PoolListener
+	removedPools  []PoolRemovedListener
+	mu            sync.Mutex
+	results       map[string]*phpfpm.Result
+	latest        *Metrics
+
+	// Pools being collected, by socket
+	running map[string]runningPool
+
+	// wg tracks the goroutines of Start and SetPools so Stop can wait for them
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc // stops the loops of Start, nil before it
+	stopped bool
+
+	// discover finds the pools on the host, replaced in tests
+	discover func() ([]phpfpm.DiscoveredFPM, error)
+	// pods finds pools in Kubernetes pods, nil unless enabled
+	pods      func(context.Context) ([]config.FPMPoolConfig, error)
+	discovery DiscoveryStatus
+}
+
+type runningPool struct {
+	cfg    config.FPMPoolConfig
+	cancel context.CancelFunc
+	done   chan struct{} // closed once collectPool has returned
+}
+
+// DiscoveryStatus describes the outcome of continuous autodiscovery.
+type DiscoveryStatus struct {
+	Pools  int    // discovered pools being collected, not counting configured ones
+	Errors uint64 // discovery runs that failed
 }
 
 func NewCollector(cfg *config.Config, interval time.Duration) *Collector {
-	return &Collector{
+	c := &Collector{
 		cfg:       cfg,
 		interval:  interval,
 		listeners: make([]Listener, 0),
 		results:   make(map[string]*phpfpm.Result),
+		running:   make(map[string]runningPool),
+		discover:  phpfpm.DiscoverFPMProcesses,
+	}
+	c.discovery.Pools = countDiscovered(cfg.PHPFpm.Pools)
+	return c
+}
+
+func countDiscovered(pools []config.FPMPoolConfig) int {
+	n := 0
+	for _, pool := range pools {
+		if pool.Discovered {
+			n++
+		}
 	}
+	return n
+}
+
+// SetPodDiscovery adds a source of pools running in other pods, consulted
+// on every discovery run alongside the local process table.
+func (c *Collector) SetPodDiscovery(fn func(context.Context) ([]config.FPMPoolConfig, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pods = fn
 }
 
 func (c *Collector) AddListener(fn Listener) {
@@ -44,17 +105,126 @@ func (c *Collector) notify(m *Metrics) {
 	}
 }
 
+func (c *Collector) AddPoolListener(fn PoolListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.poolListeners = append(c.poolListeners, fn)
+}
+
+// notifyPool runs pool listeners outside the lock so a slow listener does not
+// hold up snapshots or other pools.
+func (c *Collector) notifyPool(socket string, result *phpfpm.Result) {
+	c.mu.Lock()
+	listeners := make([]PoolListener, len(c.poolListeners))
+	copy(listeners, c.poolListeners)
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(socket, result)
+	}
+}
+
+func (c *Collector) AddPoolRemovedListener(fn PoolRemovedListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removedPools = append(c.removedPools, fn)
+}
+
+// poolRemoved waits for the removed pool's loop to return, so no scrape of it
+// is published afterwards, then drops what is kept about its socket.
+func (c *Collector) poolRemoved(pool runningPool) {
+	<-pool.done
+	phpfpm.ForgetPool(pool.cfg)
+
+	c.mu.Lock()
+	listeners := make([]PoolRemovedListener, len(c.removedPools))
+	copy(listeners, c.removedPools)
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(pool.cfg.Socket)
+	}
+}
+
+// Start launches the background collection loops: one per FPM pool, one
+// for system and Laravel metrics and, with autodiscovery, one that keeps the
+// pools up to date. Scrapers read the result via Snapshot. The loops run
+// until ctx is done or Stop is called.
+func (c *Collector) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	c.cancel = cancel
+	pods := c.pods
+	c.mu.Unlock()
+
+	if c.cfg.PHPFpm.Enabled {
+		c.RunPerPoolCollector(ctx)
+		if (c.cfg.PHPFpm.Autodiscover && c.cfg.PHPFpm.DiscoveryInterval > 0) || pods != nil {
+			c.spawn(func() { c.RunDiscovery(ctx, c.cfg.PHPFpm.DiscoveryInterval) })
+		}
+	}
+	c.spawn(func() { c.Run(ctx) })
+}
+
+// Stop stops every loop started by Start and SetPools and waits for them to
+// return. Listeners are not called after Stop returns, and the collector
+// cannot be started again.
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	c.stopped = true
+	if c.cancel != nil {
+		c.cancel()
+	}
+	for socket, running := range c.running {
+		running.cancel()
+		delete(c.running, socket)
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+// spawn runs fn in a goroutine Stop waits for, unless the collector has
+// been stopped already.
+func (c *Collector) spawn(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spawnLocked(fn)
+}
+
+// spawnLocked is spawn with c.mu held.
+func (c *Collector) spawnLocked(fn func()) {
+	if c.stopped {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
+// Run collects system and Laravel metrics on every tick, merges them with the
+// latest per-pool FPM results and notifies listeners. FPM pools themselves are
+// scraped by RunPerPoolCollector.
 func (c *Collector) Run(ctx context.Context) {
-	ticker := time.NewTicker(c.interval)
+	ticker := time.NewTicker(pollInterval(c.interval))
 	defer ticker.Stop()
 
 	for {
+		m := collectShared(ctx, c.cfg)
+
+		c.mu.Lock()
+		c.latest = m
+		c.mu.Unlock()
+
+		c.notify(c.Snapshot())
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			m, _ := GetMetrics(ctx, c.cfg)
-			c.notify(m)
 		}
 	}
 }
@@ -63,59 +233,242 @@ func (c *Collector) Collect(ctx context.Context) (*Metrics, error) {
 	return GetMetrics(ctx, c.cfg)
 }
 
+// Snapshot returns the most recently collected metrics without blocking on
+// PHP-FPM or Laravel. Pools that have not been scraped yet are absent.
+func (c *Collector) Snapshot() *Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &Metrics{
+		Timestamp: time.Now(),
+		Errors:    make(map[string]string),
+	}
+	if c.latest != nil {
+		out.Timestamp = c.latest.Timestamp
+		out.Server = c.latest.Server
+		out.Laravel = c.latest.Laravel
+		for k, v := range c.latest.Errors {
+			out.Errors[k] = v
+		}
+	}
+
+	if c.cfg.PHPFpm.Enabled {
+		out.Fpm = make(map[string]*phpfpm.Result, len(c.results))
+		for socket, result := range c.results {
+			out.Fpm[socket] = result
+		}
+	}
+
+	return out
+}
+
+// RunPerPoolCollector starts collecting every configured pool.
 func (c *Collector) RunPerPoolCollector(ctx context.Context) {
+	c.SetPools(ctx, c.cfg.PHPFpm.Pools)
+}
+
+// SetPools starts collecting pools that are new or whose configuration
+// changed and stops collecting pools that are gone, dropping their last
+// result and notifying PoolRemovedListeners. It returns the sockets that were
+// added and removed. When several pools share a socket the last one wins, as
+// in phpfpm.GetMetrics.
+func (c *Collector) SetPools(ctx context.Context, pools []config.FPMPoolConfig) (added, removed []string) {
+	wanted := make(map[string]config.FPMPoolConfig, len(pools))
+	for _, pool := range pools {
+		wanted[pool.Socket] = pool
+	}
+
+	var gone []runningPool
+	defer func() {
+		for _, pool := range gone {
+			c.poolRemoved(pool)
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for socket, running := range c.running {
+		pool, ok := wanted[socket]
+		if ok && reflect.DeepEqual(pool, running.cfg) {
+			delete(wanted, socket)
+			continue
+		}
+		running.cancel()
+		delete(c.running, socket)
+		if !ok {
+			delete(c.results, socket)
+			removed = append(removed, socket)
+			gone = append(gone, running)
+		}
+	}
+
+	for socket, pool := range wanted {
+		if c.stopped {
+			break
+		}
+		if _, ok := c.results[socket]; !ok {
+			added = append(added, socket)
+		}
+		poolCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		c.running[socket] = runningPool{cfg: pool, cancel: cancel, done: done}
+		c.spawnLocked(func() {
+			defer close(done)
+			c.collectPool(poolCtx, pool)
+		})
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// collectPool scrapes a single pool on its poll interval until ctx is done.
+func (c *Collector) collectPool(ctx context.Context, poolCfg config.FPMPoolConfig) {
+	interval := poolCfg.PollInterval
+	if interval == 0 {
+		interval = c.cfg.PHPFpm.PollInterval
+	}
+	ticker := time.NewTicker(pollInterval(interval))
+	defer ticker.Stop()
+
+	for {
+		poolCtx, cancel := context.WithTimeout(ctx, phpfpm.PoolTimeout(poolCfg))
+		result, err := phpfpm.GetMetricsForPool(poolCtx, poolCfg)
+		cancel()
+
+		if err != nil {
+			result = phpfpm.NewFailedResult(poolCfg, err)
+		}
+
+		// A pool removed while it was being scraped must not come back
+		c.mu.Lock()
+		if ctx.Err() != nil {
+			c.mu.Unlock()
+			return
+		}
+		c.results[poolCfg.Socket] = result
+		c.mu.Unlock()
+
+		c.notifyPool(poolCfg.Socket, result)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDiscovery looks for PHP-FPM pools on every tick and applies what it
+// finds with SetPools. Configured pools are always kept and take precedence
+// over a discovered pool on the same socket. A failed run keeps the current
+// pools. Pods are looked for right away, as they are not discovered at startup;
+// with an interval of 0 that is the only run.
+func (c *Collector) RunDiscovery(ctx context.Context, interval time.Duration) {
+	var static []config.FPMPoolConfig
 	for _, pool := range c.cfg.PHPFpm.Pools {
-		go func(poolCfg config.FPMPoolConfig) {
-			interval := poolCfg.PollInterval
-			if interval == 0 {
-				interval = c.cfg.PHPFpm.PollInterval
-			}
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					timeout := poolCfg.Timeout
-					if timeout == 0 {
-						timeout = 2 * time.Second
-					}
-
-					poolCtx, cancel := context.WithTimeout(ctx, timeout)
-					result, err := phpfpm.GetMetricsForPool(poolCtx, poolCfg)
-					cancel()
-
-					c.mu.Lock()
-					if err == nil {
-						c.results[poolCfg.Socket] = result
-					} else {
-						c.results[poolCfg.Socket] = &phpfpm.Result{
-							Timestamp: time.Now(),
-							Pools:     nil,
-							Global:    nil,
-						}
-					}
-					c.mu.Unlock()
-				}
-			}
-		}(pool)
+		if !pool.Discovered {
+			static = append(static, pool)
+		}
+	}
+
+	c.mu.Lock()
+	pods := c.pods
+	c.mu.Unlock()
+	if pods != nil {
+		c.rediscover(ctx, static)
+	}
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.rediscover(ctx, static)
 	}
 }
 
-func GetMetrics(ctx context.Context, cfg *config.Config) (*Metrics, error) {
-	out := &Metrics{
-		Timestamp: time.Now(),
-		Errors:    make(map[string]string),
+func (c *Collector) rediscover(ctx context.Context, static []config.FPMPoolConfig) {
+	c.mu.Lock()
+	pods := c.pods
+	c.mu.Unlock()
+
+	var discovered []phpfpm.DiscoveredFPM
+	var err error
+	if c.cfg.PHPFpm.Autodiscover {
+		discovered, err = c.discover()
 	}
 
-	systemInfoData := server.DetectSystem()
-	out.Server = systemInfoData.SystemInfo
-	for k, v := range systemInfoData.Errors {
-		out.Errors[k] = v
+	var podPools []config.FPMPoolConfig
+	if err == nil && pods != nil {
+		podPools, err = pods(ctx)
+	}
+
+	if err != nil {
+		logging.L().Warn("PHPeek PHP-FPM autodiscover failed", "error", err)
+		c.mu.Lock()
+		c.discovery.Errors++
+		c.mu.Unlock()
+		return
+	}
+
+	fpm := c.cfg.PHPFpm
+	fpm.Pools = mergePools(phpfpm.MergeDiscovered(static, discovered), podPools)
+	fpm.ApplyPoolDefaults()
+
+	added, removed := c.SetPools(ctx, fpm.Pools)
+	if len(added) > 0 || len(removed) > 0 {
+		logging.L().Info("PHPeek PHP-FPM pools changed", "added", added, "removed", removed)
 	}
 
+	c.mu.Lock()
+	c.discovery.Pools = countDiscovered(fpm.Pools)
+	c.mu.Unlock()
+}
+
+// mergePools appends the pools found in pods whose socket is not taken yet.
+func mergePools(pools, podPools []config.FPMPoolConfig) []config.FPMPoolConfig {
+	seen := make(map[string]bool, len(pools)+len(podPools))
+	for _, pool := range pools {
+		seen[pool.Socket] = true
+	}
+	for _, pool := range podPools {
+		if seen[pool.Socket] {
+			continue
+		}
+		pools = append(pools, pool)
+		seen[pool.Socket] = true
+	}
+	return pools
+}
+
+// DiscoveryStatus returns the number of discovered pools and failed runs.
+func (c *Collector) DiscoveryStatus() DiscoveryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discovery
+}
+
+// pollInterval guards against a zero interval, which time.NewTicker rejects.
+func pollInterval(d time.Duration) time.Duration {
+	if d <= 0 {
+		return time.Second
+	}
+	return d
+}
+
+func GetMetrics(ctx context.Context, cfg *config.Config) (*Metrics, error) {
+	out := collectShared(ctx, cfg)
+
 	if cfg.PHPFpm.Enabled {
 		fpmResults, err := phpfpm.GetMetrics(ctx, cfg)
 		if err != nil {
@@ -125,6 +478,22 @@ func GetMetrics(ctx context.Context, cfg *config.Config) (*Metrics, error) {
 		}
 	}
 
+	return out, nil
+}
+
+// collectShared gathers everything that is not scraped per FPM pool.
+func collectShared(ctx context.Context, cfg *config.Config) *Metrics {
+	out := &Metrics{
+		Timestamp: time.Now(),
+		Errors:    make(map[string]string),
+	}
+
+	systemInfoData := server.DetectSystem()
+	out.Server = systemInfoData.SystemInfo
+	for k, v := range systemInfoData.Errors {
+		out.Errors[k] = v
+	}
+
 	if len(cfg.Laravel) > 0 {
 		data, errs := laravel.Collect(ctx, cfg)
 		for key, msg := range errs {
@@ -137,5 +506,5 @@ func GetMetrics(ctx context.Context, cfg *config.Config) (*Metrics, error) {
 		}
 	}
 
-	return out, nil
+	return out
 }
@@ -2,11 +2,15 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
 )
 
 func TestNewCollector(t *testing.T) {
@@ -195,6 +199,9 @@ func TestCollector_RunCancellation(t *testing.T) {
 }
 
 func TestCollector_RunPerPoolCollector(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
 	cfg := &config.Config{
 		PHPFpm: config.FPMConfig{
 			Enabled:      true,
@@ -218,6 +225,7 @@ func TestCollector_RunPerPoolCollector(t *testing.T) {
 		},
 	}
 	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -348,3 +356,458 @@ func TestListener_FunctionType(t *testing.T) {
 
 	listener(testMetrics)
 }
+
+func TestCollector_Snapshot(t *testing.T) {
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+		},
+	}
+	collector := NewCollector(cfg, time.Second)
+
+	// Before any collection the snapshot is empty but usable
+	snapshot := collector.Snapshot()
+	if snapshot == nil {
+		t.Fatalf("Expected Snapshot to return non-nil metrics")
+	}
+	if snapshot.Errors == nil {
+		t.Errorf("Expected snapshot to have initialized Errors map")
+	}
+	if len(snapshot.Fpm) != 0 {
+		t.Errorf("Expected no FPM results before collection, got %d", len(snapshot.Fpm))
+	}
+
+	collected := time.Now().Add(-time.Minute)
+	collector.mu.Lock()
+	collector.results["unix:///tmp/test.sock"] = &phpfpm.Result{Timestamp: collected}
+	collector.latest = &Metrics{
+		Timestamp: collected,
+		Errors:    map[string]string{"cpu": "failed"},
+	}
+	collector.mu.Unlock()
+
+	snapshot = collector.Snapshot()
+	if !snapshot.Timestamp.Equal(collected) {
+		t.Errorf("Expected snapshot timestamp to match last collection")
+	}
+	if snapshot.Errors["cpu"] != "failed" {
+		t.Errorf("Expected snapshot to carry collection errors")
+	}
+	if _, ok := snapshot.Fpm["unix:///tmp/test.sock"]; !ok {
+		t.Errorf("Expected snapshot to include per-pool results")
+	}
+
+	// Mutating the snapshot must not affect the collector's state
+	delete(snapshot.Fpm, "unix:///tmp/test.sock")
+	snapshot.Errors["new"] = "value"
+	if len(collector.Snapshot().Fpm) != 1 {
+		t.Errorf("Expected snapshot to be a copy of collector results")
+	}
+	if _, ok := collector.Snapshot().Errors["new"]; ok {
+		t.Errorf("Expected snapshot errors to be a copy")
+	}
+}
+
+func TestCollector_RunStoresSnapshot(t *testing.T) {
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: false,
+		},
+	}
+	collector := NewCollector(cfg, 50*time.Millisecond)
+
+	var mu sync.Mutex
+	notified := 0
+	collector.AddListener(func(m *Metrics) {
+		mu.Lock()
+		notified++
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go collector.Run(ctx)
+	time.Sleep(120 * time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if notified == 0 {
+		t.Errorf("Expected listeners to be notified after collection")
+	}
+
+	if collector.Snapshot().Server == nil {
+		t.Errorf("Expected snapshot to contain server info after Run")
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	if got := pollInterval(0); got != time.Second {
+		t.Errorf("Expected zero interval to default to 1s, got %v", got)
+	}
+	if got := pollInterval(-time.Second); got != time.Second {
+		t.Errorf("Expected negative interval to default to 1s, got %v", got)
+	}
+	if got := pollInterval(5 * time.Second); got != 5*time.Second {
+		t.Errorf("Expected interval to be preserved, got %v", got)
+	}
+}
+
+func TestCollector_PoolListener(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Socket:       "unix:///tmp/phpeek-listener.sock",
+					StatusSocket: "unix:///tmp/phpeek-listener.sock",
+					StatusPath:   "/status",
+					PollInterval: 20 * time.Millisecond,
+					Timeout:      100 * time.Millisecond,
+				},
+			},
+		},
+	}
+	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	collector.AddPoolListener(func(socket string, result *phpfpm.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[socket]++
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collector.RunPerPoolCollector(ctx)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Every poll notifies, including failed ones
+	if calls["unix:///tmp/phpeek-listener.sock"] == 0 {
+		t.Errorf("Expected pool listener to be called, got %v", calls)
+	}
+}
+
+func TestCollector_SetPools(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	pool := func(socket string) config.FPMPoolConfig {
+		return config.FPMPoolConfig{
+			Socket:       socket,
+			StatusSocket: socket,
+			StatusPath:   "/status",
+			PollInterval: 20 * time.Millisecond,
+			Timeout:      100 * time.Millisecond,
+		}
+	}
+	cfg := &config.Config{PHPFpm: config.FPMConfig{Enabled: true}}
+	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	added, removed := collector.SetPools(ctx, []config.FPMPoolConfig{pool("unix:///tmp/phpeek-a.sock"), pool("unix:///tmp/phpeek-b.sock")})
+	if len(added) != 2 || len(removed) != 0 {
+		t.Errorf("Expected 2 added pools, got %v added and %v removed", added, removed)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	added, removed = collector.SetPools(ctx, []config.FPMPoolConfig{pool("unix:///tmp/phpeek-b.sock"), pool("unix:///tmp/phpeek-c.sock")})
+	if len(added) != 1 || added[0] != "unix:///tmp/phpeek-c.sock" {
+		t.Errorf("Expected c to be added, got %v", added)
+	}
+	if len(removed) != 1 || removed[0] != "unix:///tmp/phpeek-a.sock" {
+		t.Errorf("Expected a to be removed, got %v", removed)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	snapshot := collector.Snapshot()
+	if _, ok := snapshot.Fpm["unix:///tmp/phpeek-a.sock"]; ok {
+		t.Errorf("Expected the removed pool's result to be dropped")
+	}
+	for _, socket := range []string{"unix:///tmp/phpeek-b.sock", "unix:///tmp/phpeek-c.sock"} {
+		if _, ok := snapshot.Fpm[socket]; !ok {
+			t.Errorf("Expected a result for %s", socket)
+		}
+	}
+
+	collector.mu.Lock()
+	running := len(collector.running)
+	collector.mu.Unlock()
+	if running != 2 {
+		t.Errorf("Expected 2 running pools, got %d", running)
+	}
+}
+
+func TestCollector_PoolRemovedListener(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	pool := config.FPMPoolConfig{
+		Socket:       "unix:///tmp/phpeek-removed.sock",
+		StatusSocket: "unix:///tmp/phpeek-removed.sock",
+		StatusPath:   "/status",
+		PollInterval: 5 * time.Millisecond,
+		Timeout:      100 * time.Millisecond,
+	}
+	cfg := &config.Config{PHPFpm: config.FPMConfig{Enabled: true}}
+	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
+
+	var mu sync.Mutex
+	var removed []string
+	scrapedAfterRemoval := false
+	collector.AddPoolListener(func(socket string, result *phpfpm.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(removed) > 0 {
+			scrapedAfterRemoval = true
+		}
+	})
+	collector.AddPoolRemovedListener(func(socket string) {
+		mu.Lock()
+		defer mu.Unlock()
+		removed = append(removed, socket)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector.SetPools(ctx, []config.FPMPoolConfig{pool})
+	time.Sleep(50 * time.Millisecond)
+	collector.SetPools(ctx, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(removed) != 1 || removed[0] != pool.Socket {
+		t.Errorf("Expected one removal of %s, got %v", pool.Socket, removed)
+	}
+	if scrapedAfterRemoval {
+		t.Errorf("Expected no scrape to be published after the removal")
+	}
+	for key := range phpfpm.ScrapeFailures() {
+		if key.Socket == pool.Socket {
+			t.Errorf("Expected the removed pool's failure counters to be dropped, got %+v", key)
+		}
+	}
+}
+
+func TestCollector_Rediscover(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	static := config.FPMPoolConfig{Socket: "unix:///tmp/phpeek-static.sock", StatusSocket: "unix:///tmp/phpeek-static.sock", StatusPath: "/status"}
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled:      true,
+			Autodiscover: true,
+			ProbeDir:     "/var/lib/phpeek",
+			Pools:        []config.FPMPoolConfig{static},
+		},
+	}
+	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
+
+	var discovered []phpfpm.DiscoveredFPM
+	var discoverErr error
+	collector.discover = func() ([]phpfpm.DiscoveredFPM, error) {
+		return discovered, discoverErr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// php-fpm started after the exporter, with one pool on the static socket
+	discovered = []phpfpm.DiscoveredFPM{
+		{Name: "www", Socket: "unix:///tmp/phpeek-static.sock", StatusPath: "/fpm-status"},
+		{Name: "api", Socket: "unix:///tmp/phpeek-api.sock", StatusPath: "/status"},
+	}
+	collector.rediscover(ctx, []config.FPMPoolConfig{static})
+
+	collector.mu.Lock()
+	staticCfg := collector.running["unix:///tmp/phpeek-static.sock"].cfg
+	apiCfg, apiRunning := collector.running["unix:///tmp/phpeek-api.sock"]
+	collector.mu.Unlock()
+
+	if staticCfg.StatusPath != "/status" || staticCfg.Discovered {
+		t.Errorf("Expected the configured pool to take precedence, got %+v", staticCfg)
+	}
+	if !apiRunning || !apiCfg.cfg.Discovered || apiCfg.cfg.ProbeDir != "/var/lib/phpeek" {
+		t.Errorf("Expected the discovered pool with defaults applied, got %+v", apiCfg.cfg)
+	}
+	if status := collector.DiscoveryStatus(); status.Pools != 1 {
+		t.Errorf("Expected 1 discovered pool, got %d", status.Pools)
+	}
+
+	// A failed run keeps the pools
+	discoverErr = errors.New("permission denied")
+	collector.rediscover(ctx, []config.FPMPoolConfig{static})
+	if status := collector.DiscoveryStatus(); status.Errors != 1 || status.Pools != 1 {
+		t.Errorf("Expected 1 error and the pool kept, got %+v", status)
+	}
+
+	// php-fpm stopped
+	discovered, discoverErr = nil, nil
+	collector.rediscover(ctx, []config.FPMPoolConfig{static})
+
+	collector.mu.Lock()
+	_, apiRunning = collector.running["unix:///tmp/phpeek-api.sock"]
+	_, staticRunning := collector.running["unix:///tmp/phpeek-static.sock"]
+	collector.mu.Unlock()
+
+	if apiRunning || !staticRunning {
+		t.Errorf("Expected only the configured pool to be left")
+	}
+	if status := collector.DiscoveryStatus(); status.Pools != 0 {
+		t.Errorf("Expected no discovered pools, got %d", status.Pools)
+	}
+}
+
+func TestCollector_RediscoverPods(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	static := config.FPMPoolConfig{Socket: "tcp://10.0.0.1:9000", StatusSocket: "tcp://10.0.0.1:9000", StatusPath: "/status"}
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools:   []config.FPMPoolConfig{static},
+		},
+	}
+	collector := NewCollector(cfg, time.Second)
+	t.Cleanup(collector.Stop)
+	collector.discover = func() ([]phpfpm.DiscoveredFPM, error) {
+		t.Error("Expected the process table not to be read without autodiscover")
+		return nil, nil
+	}
+
+	var pods []config.FPMPoolConfig
+	var podsErr error
+	collector.SetPodDiscovery(func(context.Context) ([]config.FPMPoolConfig, error) {
+		return pods, podsErr
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pods = []config.FPMPoolConfig{
+		{Socket: "tcp://10.0.0.1:9000", StatusPath: "/fpm-status", Namespace: "shop", Pod: "web-1", Discovered: true},
+		{Socket: "tcp://10.0.0.2:9000", StatusSocket: "tcp://10.0.0.2:9000", StatusPath: "/status", Namespace: "shop", Pod: "web-2", Discovered: true},
+	}
+	collector.rediscover(ctx, []config.FPMPoolConfig{static})
+
+	collector.mu.Lock()
+	staticCfg := collector.running["tcp://10.0.0.1:9000"].cfg
+	podCfg, podRunning := collector.running["tcp://10.0.0.2:9000"]
+	collector.mu.Unlock()
+
+	if staticCfg.Pod != "" || staticCfg.StatusPath != "/status" {
+		t.Errorf("Expected the configured pool to take precedence, got %+v", staticCfg)
+	}
+	if !podRunning || podCfg.cfg.Pod != "web-2" || podCfg.cfg.Namespace != "shop" {
+		t.Errorf("Expected the pod's pool to be collected, got %+v", podCfg.cfg)
+	}
+	if status := collector.DiscoveryStatus(); status.Pools != 1 {
+		t.Errorf("Expected 1 discovered pool, got %d", status.Pools)
+	}
+
+	// An unreachable API server keeps the pools
+	podsErr = errors.New("connection refused")
+	collector.rediscover(ctx, []config.FPMPoolConfig{static})
+	if status := collector.DiscoveryStatus(); status.Errors != 1 || status.Pools != 1 {
+		t.Errorf("Expected 1 error and the pool kept, got %+v", status)
+	}
+}
+
+func TestCollector_StartDiscoversPodsOnce(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled:           true,
+			DiscoveryInterval: 0,
+		},
+	}
+	collector := NewCollector(cfg, time.Hour)
+	t.Cleanup(collector.Stop)
+
+	var calls atomic.Int64
+	collector.SetPodDiscovery(func(context.Context) ([]config.FPMPoolConfig, error) {
+		calls.Add(1)
+		return []config.FPMPoolConfig{
+			{Socket: "tcp://10.0.0.2:9000", StatusSocket: "tcp://10.0.0.2:9000", StatusPath: "/status", PollInterval: time.Hour, Namespace: "shop", Pod: "web-2", Discovered: true},
+		}, nil
+	})
+
+	// Pods are not discovered before serving, so a discovery_interval of 0
+	// must not leave them uncollected
+	collector.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		collector.mu.Lock()
+		_, running := collector.running["tcp://10.0.0.2:9000"]
+		collector.mu.Unlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the pod's pool to be collected at startup")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected pods to be discovered once, got %d runs", n)
+	}
+}
+
+func TestCollector_Stop(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Socket:       "unix:///tmp/phpeek-stop.sock",
+					StatusSocket: "unix:///tmp/phpeek-stop.sock",
+					StatusPath:   "/status",
+					PollInterval: 10 * time.Millisecond,
+					Timeout:      100 * time.Millisecond,
+				},
+			},
+		},
+	}
+	collector := NewCollector(cfg, 10*time.Millisecond)
+
+	var calls atomic.Int64
+	collector.AddPoolListener(func(string, *phpfpm.Result) { calls.Add(1) })
+
+	collector.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	collector.Stop()
+
+	// Every loop has returned, so no listener runs after Stop
+	stoppedAt := calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != stoppedAt || n == 0 {
+		t.Errorf("Expected the listener to be called before Stop only, got %d then %d", stoppedAt, n)
+	}
+
+	if added, _ := collector.SetPools(context.Background(), cfg.PHPFpm.Pools); len(added) != 0 {
+		t.Errorf("Expected no pools to be started after Stop, got %v", added)
+	}
+}
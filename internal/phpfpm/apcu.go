@@ -0,0 +1,85 @@
+package phpfpm
+
+import (
+	"context"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// ApcuStatus is the state of the APCu cache of a pool. APCu memory belongs to
+// the FPM master, so it can only be observed from inside the pool.
+type ApcuStatus struct {
+	Loaded  bool `json:"loaded"`  // the apcu extension is loaded
+	Enabled bool `json:"enabled"` // apc.enabled, the remaining fields are zero otherwise
+
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Inserts   uint64 `json:"inserts"`
+	Entries   uint64 `json:"entries"`
+	Expunges  uint64 `json:"expunges"`
+	Slots     uint64 `json:"slots"`
+	StartTime int64  `json:"start_time"`
+	MemSize   uint64 `json:"mem_size"` // bytes used by entries
+
+	Segments        uint64  `json:"segments"`
+	SegmentSize     uint64  `json:"segment_size"`     // bytes per segment
+	AvailableMemory uint64  `json:"available_memory"` // bytes free over all segments
+	Fragmentation   float64 `json:"fragmentation"`    // share of free memory in blocks below 5 MiB
+}
+
+// apcuProbe reports the APCu cache in a flat JSON object. The segment
+// block lists are only used to compute fragmentation the way apc.php does and
+// are not sent, as they can hold thousands of entries.
+var apcuProbe = Probe{Name: "apcu-status", Script: `<?php
+error_reporting(0);
+ini_set('display_errors', 0);
+header("Status: 200 OK");
+header("Content-Type: application/json");
+if (!function_exists('apcu_cache_info')) {
+    echo json_encode(['loaded' => false]);
+    exit;
+}
+$enabled = function_exists('apcu_enabled') ? apcu_enabled() : (bool) ini_get('apc.enabled');
+if (!$enabled) {
+    echo json_encode(['loaded' => true, 'enabled' => false]);
+    exit;
+}
+$cache = apcu_cache_info(true);
+$sma = apcu_sma_info();
+$free = 0;
+$small = 0;
+foreach ($sma['block_lists'] as $blocks) {
+    foreach ($blocks as $block) {
+        $free += $block['size'];
+        if ($block['size'] < 5 * 1024 * 1024) {
+            $small += $block['size'];
+        }
+    }
+}
+echo json_encode([
+    'loaded' => true,
+    'enabled' => true,
+    'hits' => $cache['num_hits'],
+    'misses' => $cache['num_misses'],
+    'inserts' => $cache['num_inserts'],
+    'entries' => $cache['num_entries'],
+    'expunges' => $cache['expunges'],
+    'slots' => $cache['num_slots'],
+    'start_time' => $cache['start_time'],
+    'mem_size' => $cache['mem_size'],
+    'segments' => $sma['num_seg'],
+    'segment_size' => $sma['seg_size'],
+    'available_memory' => $sma['avail_mem'],
+    'fragmentation' => $free > 0 ? $small / $free : 0,
+]);
+exit;`}
+
+// GetApcuStatus runs an APCu probe script in the pool. A pool without the
+// extension reports Loaded false rather than an error.
+func GetApcuStatus(ctx context.Context, cfg config.FPMPoolConfig) (*ApcuStatus, error) {
+	var status ApcuStatus
+	if err := apcuProbe.Run(ctx, cfg, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
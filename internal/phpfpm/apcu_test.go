@@ -0,0 +1,76 @@
+package phpfpm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+)
+
+func TestGetApcuStatus(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Status: 200 OK\r\nContent-Type: application/json\r\n\r\n" + `{
+			"loaded": true, "enabled": true,
+			"hits": 900, "misses": 100, "inserts": 120, "entries": 80, "expunges": 2,
+			"slots": 4099, "start_time": 1700000000, "mem_size": 1048576,
+			"segments": 1, "segment_size": 33554432, "available_memory": 30000000,
+			"fragmentation": 0.25
+		}`
+	})
+
+	status, err := GetApcuStatus(context.Background(), config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("GetApcuStatus failed: %v", err)
+	}
+
+	expected := ApcuStatus{
+		Loaded: true, Enabled: true,
+		Hits: 900, Misses: 100, Inserts: 120, Entries: 80, Expunges: 2,
+		Slots: 4099, StartTime: 1700000000, MemSize: 1048576,
+		Segments: 1, SegmentSize: 33554432, AvailableMemory: 30000000,
+		Fragmentation: 0.25,
+	}
+	if *status != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *status)
+	}
+
+	requests := fpm.Requests()
+	if len(requests) != 1 || requests[0]["SCRIPT_NAME"] != "/phpeek-apcu-status.php" {
+		t.Errorf("Expected a single request for the APCu probe, got %v", requests)
+	}
+}
+
+func TestGetApcuStatus_NotLoaded(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-Type: application/json\r\n\r\n" + `{"loaded": false}`
+	})
+
+	status, err := GetApcuStatus(context.Background(), config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Expected a missing extension not to be an error, got %v", err)
+	}
+	if status.Loaded || status.Enabled {
+		t.Errorf("Expected APCu to be reported as not loaded, got %+v", *status)
+	}
+}
+
+func TestGetApcuStatus_InvalidResponse(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-Type: text/html\r\n\r\nPrimary script unknown"
+	})
+
+	_, err := GetApcuStatus(context.Background(), config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "apcu-status JSON") {
+		t.Errorf("Expected an APCu JSON parse error, got %v", err)
+	}
+}
+
+func TestApcuStatusScript(t *testing.T) {
+	for _, call := range []string{"apcu_cache_info(true)", "apcu_sma_info()", "'loaded' => false"} {
+		if !strings.Contains(apcuProbe.Script, call) {
+			t.Errorf("Expected the APCu script to contain %s", call)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package phpfpm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CapacityReserve is the share of the memory limit kept free for the FPM
+// masters, opcache, the OS and the exporter itself.
+const CapacityReserve = 0.1
+
+const mib = 1024 * 1024
+
+// CapacityPlan is the pm.max_children recommendation for one pool, with the
+// steps that led to it.
+type CapacityPlan struct {
+	Pool   string `json:"pool"`
+	Socket string `json:"socket"`
+
+	MemoryLimit   int64   `json:"memory_limit"` // bytes available to the host or container
+	PoolBudget    int64   `json:"pool_budget"`  // bytes this pool may use
+	Pools         int     `json:"pools"`        // pools sharing the memory limit
+	Workers       int     `json:"workers"`      // workers with a known RSS
+	WorkerP50     float64 `json:"worker_p50"`   // bytes
+	WorkerP95     float64 `json:"worker_p95"`   // bytes
+	WorkerMax     float64 `json:"worker_max"`   // bytes
+	MaxChildren   int64   `json:"max_children"` // configured, 0 when unknown
+	Recommended   int64   `json:"recommended"`  // 0 when no recommendation can be made
+	Headroom      int64   `json:"headroom"`     // budget left at the configured max_children
+	HeadroomKnown bool    `json:"headroom_known"`
+
+	Reasoning []string `json:"reasoning"`
+}
+
+// PlanCapacity recommends pm.max_children for every scraped pool. The memory
+// limit, minus CapacityReserve, is split evenly between all pools, and each
+// pool's share is divided by the 95th percentile RSS of its workers.
+// memoryLimitMB is the value reported by server.DetectSystem.
+func PlanCapacity(memoryLimitMB int64, results map[string]*Result) []CapacityPlan {
+	pools := 0
+	for _, result := range results {
+		if result != nil {
+			pools += len(result.Pools)
+		}
+	}
+
+	var plans []CapacityPlan
+	for socket, result := range results {
+		if result == nil {
+			continue
+		}
+		for name, pool := range result.Pools {
+			plans = append(plans, planPool(memoryLimitMB, pools, socket, name, pool))
+		}
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Pool != plans[j].Pool {
+			return plans[i].Pool < plans[j].Pool
+		}
+		return plans[i].Socket < plans[j].Socket
+	})
+	return plans
+}
+
+func planPool(memoryLimitMB int64, pools int, socket, name string, pool Pool) CapacityPlan {
+	plan := CapacityPlan{
+		Pool:   name,
+		Socket: socket,
+		Pools:  pools,
+	}
+	reason := func(format string, args ...any) {
+		plan.Reasoning = append(plan.Reasoning, fmt.Sprintf(format, args...))
+	}
+
+	if v, err := strconv.ParseInt(pool.Config["pm.max_children"], 10, 64); err == nil {
+		plan.MaxChildren = v
+	}
+
+	if memoryLimitMB <= 0 {
+		reason("memory limit unknown: no recommendation")
+		return plan
+	}
+	plan.MemoryLimit = memoryLimitMB * mib
+
+	usable := float64(plan.MemoryLimit) * (1 - CapacityReserve)
+	reason("memory limit %s, %.0f%% reserved for masters, opcache and the OS: %s usable",
+		formatMiB(float64(plan.MemoryLimit)), CapacityReserve*100, formatMiB(usable))
+
+	plan.PoolBudget = int64(usable / float64(pools))
+	if pools > 1 {
+		reason("%d pools share the limit: %s per pool", pools, formatMiB(float64(plan.PoolBudget)))
+	}
+
+	var rss []float64
+	for _, proc := range pool.Processes {
+		if proc.Proc != nil && proc.CurrentRSS > 0 {
+			rss = append(rss, float64(proc.CurrentRSS))
+		}
+	}
+	plan.Workers = len(rss)
+	if len(rss) == 0 {
+		reason("no worker RSS available (workers not visible in /proc): no recommendation")
+		return plan
+	}
+
+	sort.Float64s(rss)
+	plan.WorkerP50 = percentile(rss, 0.5)
+	plan.WorkerP95 = percentile(rss, 0.95)
+	plan.WorkerMax = rss[len(rss)-1]
+	reason("worker RSS over %d workers: p50 %s, p95 %s, max %s",
+		plan.Workers, formatMiB(plan.WorkerP50), formatMiB(plan.WorkerP95), formatMiB(plan.WorkerMax))
+
+	plan.Recommended = int64(math.Floor(float64(plan.PoolBudget) / plan.WorkerP95))
+	if plan.Recommended < 1 {
+		plan.Recommended = 1
+		reason("budget is below one worker at p95: recommending the minimum of 1")
+	} else {
+		reason("recommended pm.max_children = %s / %s = %d",
+			formatMiB(float64(plan.PoolBudget)), formatMiB(plan.WorkerP95), plan.Recommended)
+	}
+
+	if plan.MaxChildren > 0 {
+		plan.Headroom = plan.PoolBudget - int64(float64(plan.MaxChildren)*plan.WorkerP95)
+		plan.HeadroomKnown = true
+		if plan.Headroom >= 0 {
+			reason("configured pm.max_children = %d leaves %s headroom with all workers busy",
+				plan.MaxChildren, formatMiB(float64(plan.Headroom)))
+		} else {
+			reason("configured pm.max_children = %d can exceed the budget by %s with all workers busy",
+				plan.MaxChildren, formatMiB(float64(-plan.Headroom)))
+		}
+	} else {
+		reason("configured pm.max_children unknown: no headroom")
+	}
+
+	return plan
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func formatMiB(bytes float64) string {
+	return fmt.Sprintf("%.1f MiB", bytes/mib)
+}
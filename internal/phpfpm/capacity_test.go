@@ -0,0 +1,148 @@
+package phpfpm
+
+import (
+	"strings"
+	"testing"
+)
+
+// workers builds processes with the given RSS in MiB, all visible in /proc.
+func workers(rssMiB ...int64) []PoolProcess {
+	procs := make([]PoolProcess, len(rssMiB))
+	for i, rss := range rssMiB {
+		procs[i] = PoolProcess{PID: 100 + i, CurrentRSS: rss * mib, Proc: &ProcStats{RSS: rss * mib}}
+	}
+	return procs
+}
+
+func TestPlanCapacity(t *testing.T) {
+	results := map[string]*Result{
+		"unix:///run/www.sock": {
+			Pools: map[string]Pool{
+				"www": {
+					Config:    map[string]string{"pm.max_children": "50"},
+					Processes: workers(30, 40, 40, 50, 60),
+				},
+			},
+		},
+		"unix:///run/api.sock": {
+			Pools: map[string]Pool{
+				"api": {
+					Config:    map[string]string{"pm.max_children": "10"},
+					Processes: workers(20, 20),
+				},
+			},
+		},
+		// Failed scrape: counted out of the pools sharing the host
+		"unix:///run/down.sock": {Name: "down"},
+	}
+
+	plans := PlanCapacity(2000, results)
+	if len(plans) != 2 {
+		t.Fatalf("Expected 2 plans, got %d", len(plans))
+	}
+
+	// Sorted by pool name
+	api, www := plans[0], plans[1]
+	if api.Pool != "api" || www.Pool != "www" {
+		t.Fatalf("Expected plans for api and www, got %s and %s", api.Pool, www.Pool)
+	}
+
+	// 2000 MiB minus 10% reserve, split between 2 pools
+	wantBudget := int64(float64(2000*mib) * 0.9 / 2)
+	if www.PoolBudget != wantBudget {
+		t.Errorf("Expected pool budget %d, got %d", wantBudget, www.PoolBudget)
+	}
+
+	if www.Workers != 5 || www.WorkerP95 != 60*mib || www.WorkerP50 != 40*mib || www.WorkerMax != 60*mib {
+		t.Errorf("Unexpected worker stats: %+v", www)
+	}
+
+	// 900 MiB / 60 MiB
+	if www.Recommended != 15 {
+		t.Errorf("Expected 15 recommended children for www, got %d", www.Recommended)
+	}
+	// 50 workers at 60 MiB exceed the 900 MiB budget by 2100 MiB
+	if !www.HeadroomKnown || www.Headroom != wantBudget-50*60*mib {
+		t.Errorf("Expected headroom %d, got %d", wantBudget-50*60*mib, www.Headroom)
+	}
+
+	// 900 MiB / 20 MiB, 10 workers leave 700 MiB
+	if api.Recommended != 45 || api.Headroom != wantBudget-10*20*mib {
+		t.Errorf("Unexpected api plan: recommended %d, headroom %d", api.Recommended, api.Headroom)
+	}
+
+	if !strings.Contains(strings.Join(www.Reasoning, "\n"), "2 pools share the limit") {
+		t.Errorf("Expected reasoning to mention the shared limit, got %v", www.Reasoning)
+	}
+}
+
+func TestPlanCapacity_NoRecommendation(t *testing.T) {
+	tests := []struct {
+		name          string
+		memoryLimitMB int64
+		pool          Pool
+		reason        string
+	}{
+		{
+			name:          "unknown memory limit",
+			memoryLimitMB: -1,
+			pool:          Pool{Processes: workers(50)},
+			reason:        "memory limit unknown",
+		},
+		{
+			name:          "workers not visible",
+			memoryLimitMB: 1024,
+			pool:          Pool{Processes: []PoolProcess{{PID: 1}}},
+			reason:        "no worker RSS available",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plans := PlanCapacity(tt.memoryLimitMB, map[string]*Result{"sock": {Pools: map[string]Pool{"www": tt.pool}}})
+			if len(plans) != 1 {
+				t.Fatalf("Expected 1 plan, got %d", len(plans))
+			}
+			if plans[0].Recommended != 0 || plans[0].HeadroomKnown {
+				t.Errorf("Expected no recommendation, got %+v", plans[0])
+			}
+			if !strings.Contains(strings.Join(plans[0].Reasoning, "\n"), tt.reason) {
+				t.Errorf("Expected reasoning %q, got %v", tt.reason, plans[0].Reasoning)
+			}
+		})
+	}
+}
+
+func TestPlanCapacity_MinimumOneWorker(t *testing.T) {
+	plans := PlanCapacity(100, map[string]*Result{
+		"sock": {Pools: map[string]Pool{"www": {Processes: workers(500)}}},
+	})
+
+	if plans[0].Recommended != 1 {
+		t.Errorf("Expected a minimum of 1 child, got %d", plans[0].Recommended)
+	}
+	// Without a configured max_children there is nothing to compare against
+	if plans[0].HeadroomKnown {
+		t.Errorf("Expected headroom to be unknown")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{0.5, 5},
+		{0.95, 10},
+		{1, 10},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 )
 
 var (
 	fpmConfigCache     = make(map[string]*FPMConfig)
+	fpmConfigTTFailed  = make(map[string]bool) // php-fpm -tt failed, by cache key
 	fpmConfigCacheLock sync.Mutex
 )
 
@@ -18,14 +21,11 @@ type FPMConfig struct {
 	Pools  map[string]map[string]string
 }
 
+// ParseFPMConfig returns the configuration php-fpm -tt reports. The result is
+// cached until InvalidateFPMConfig is called for the same binary and config.
 func ParseFPMConfig(FPMBinaryPath string, FPMConfigPath string) (*FPMConfig, error) {
-	key := FPMBinaryPath + "::" + FPMConfigPath
-
-	fpmConfigCacheLock.Lock()
-	cached, ok := fpmConfigCache[key]
-	fpmConfigCacheLock.Unlock()
-
-	if ok {
+	key := fpmConfigKey(FPMBinaryPath, FPMConfigPath, "")
+	if cached, ok := cachedFPMConfig(key); ok {
 		return cached, nil
 	}
 
@@ -93,9 +93,101 @@ func ParseFPMConfig(FPMBinaryPath string, FPMConfigPath string) (*FPMConfig, err
 		return nil, fmt.Errorf("failed to scan php-fpm config output: %w", err)
 	}
 
+	cacheFPMConfig(key, fpmconfig)
+	return fpmconfig, nil
+}
+
+// ReadFPMConfig returns the configuration of a master whose filesystem root
+// is root, as seen by the exporter ("" for its own). php-fpm -tt is only run
+// for a master sharing the exporter's root: a binary from another container
+// is usually unable to run here. Otherwise, or when it fails, the config
+// files are parsed directly, with ${VAR} expanded from the environment of the
+// master with the given pid (0 when unknown). The result, and a failure of
+// php-fpm -tt, are cached until InvalidateFPMConfig, so a failing binary is
+// not run again on every poll.
+func ReadFPMConfig(FPMBinaryPath string, FPMConfigPath string, root string, pid int) (*FPMConfig, error) {
+	key := fpmConfigKey(FPMBinaryPath, FPMConfigPath, root)
+	if cached, ok := cachedFPMConfig(key); ok {
+		return cached, nil
+	}
+
+	if root == "" && !fpmTTFailed(key) {
+		conf, err := ParseFPMConfig(FPMBinaryPath, FPMConfigPath)
+		if err == nil {
+			return conf, nil
+		}
+		markFPMTTFailed(key)
+		logging.L().Info("PHPeek php-fpm -tt failed, parsing config files instead", "binary", FPMBinaryPath, "config", FPMConfigPath, "error", err)
+	}
+
+	var args []string
+	if pid > 0 {
+		args, _ = ReadCmdline(pid)
+	}
+	conf, err := ParseFPMConfigFiles(root, masterEnviron(pid, root), fpmPrefix(args, FPMConfigPath), FPMConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	cacheFPMConfig(key, conf)
+	return conf, nil
+}
+
+// masterEnviron returns the environment of the master with the given pid. The
+// exporter's own (nil) only stands in for a master sharing the exporter's
+// root; a master in another container has an environment of its own, so
+// ${VAR} expands to "" there when it cannot be read.
+func masterEnviron(pid int, root string) map[string]string {
+	if pid > 0 {
+		env, err := ReadEnviron(pid)
+		if err == nil {
+			return env
+		}
+		logging.L().Debug("PHPeek Cannot read FPM master environment", "pid", pid, "error", err)
+	}
+	if root == "" {
+		return nil
+	}
+	return map[string]string{}
+}
+
+func cachedFPMConfig(key string) (*FPMConfig, bool) {
+	fpmConfigCacheLock.Lock()
+	defer fpmConfigCacheLock.Unlock()
+	conf, ok := fpmConfigCache[key]
+	return conf, ok
+}
+
+func fpmTTFailed(key string) bool {
 	fpmConfigCacheLock.Lock()
-	fpmConfigCache[key] = fpmconfig
-	fpmConfigCacheLock.Unlock()
+	defer fpmConfigCacheLock.Unlock()
+	return fpmConfigTTFailed[key]
+}
 
-	return fpmconfig, nil
+func markFPMTTFailed(key string) {
+	fpmConfigCacheLock.Lock()
+	defer fpmConfigCacheLock.Unlock()
+	fpmConfigTTFailed[key] = true
+}
+
+func cacheFPMConfig(key string, conf *FPMConfig) {
+	fpmConfigCacheLock.Lock()
+	defer fpmConfigCacheLock.Unlock()
+	fpmConfigCache[key] = conf
+}
+
+// InvalidateFPMConfig drops the cached configuration and php-fpm -tt failure,
+// so the next call to ParseFPMConfig or ReadFPMConfig reads it again. It is
+// called when the master restarts, which is when a changed configuration on
+// disk takes effect.
+func InvalidateFPMConfig(FPMBinaryPath string, FPMConfigPath string, root string) {
+	fpmConfigCacheLock.Lock()
+	defer fpmConfigCacheLock.Unlock()
+	for _, key := range []string{fpmConfigKey(FPMBinaryPath, FPMConfigPath, root), fpmConfigKey(FPMBinaryPath, FPMConfigPath, "")} {
+		delete(fpmConfigCache, key)
+		delete(fpmConfigTTFailed, key)
+	}
+}
+
+func fpmConfigKey(FPMBinaryPath string, FPMConfigPath string, root string) string {
+	return root + "::" + FPMBinaryPath + "::" + FPMConfigPath
 }
@@ -2,9 +2,13 @@ package phpfpm
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 )
 
 func TestFPMConfig_Structure(t *testing.T) {
@@ -232,7 +236,7 @@ echo "listen = /test/cache.sock"
 
 	// Verify cache contains the entry
 	fpmConfigCacheLock.Lock()
-	cacheKey := mockFpmPath + "::" + configPath
+	cacheKey := fpmConfigKey(mockFpmPath, configPath, "")
 	cached, exists := fpmConfigCache[cacheKey]
 	fpmConfigCacheLock.Unlock()
 
@@ -427,3 +431,120 @@ sleep 0.1
 		}
 	}
 }
+
+func TestInvalidateFPMConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	mockFpmPath := tempDir + "/mock-php-fpm-invalidate"
+	configPath := tempDir + "/invalidate.conf"
+	childrenPath := tempDir + "/max_children"
+
+	// The mock reports whatever pm.max_children is on disk
+	mockScript := `#!/bin/bash
+echo "[www]"
+echo "pm.max_children = $(cat ` + childrenPath + `)"
+`
+	if err := os.WriteFile(mockFpmPath, []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to create mock script: %v", err)
+	}
+	if err := os.WriteFile(childrenPath, []byte("5"), 0644); err != nil {
+		t.Fatalf("Failed to write max_children: %v", err)
+	}
+
+	first, err := ParseFPMConfig(mockFpmPath, configPath)
+	if err != nil {
+		t.Fatalf("ParseFPMConfig failed: %v", err)
+	}
+
+	if err := os.WriteFile(childrenPath, []byte("10"), 0644); err != nil {
+		t.Fatalf("Failed to write max_children: %v", err)
+	}
+	cached, _ := ParseFPMConfig(mockFpmPath, configPath)
+	if cached.Pools["www"]["pm.max_children"] != "5" {
+		t.Errorf("Expected the cached config until it is invalidated, got %v", cached.Pools["www"])
+	}
+
+	InvalidateFPMConfig(mockFpmPath, configPath, "")
+
+	reread, err := ParseFPMConfig(mockFpmPath, configPath)
+	if err != nil {
+		t.Fatalf("ParseFPMConfig failed: %v", err)
+	}
+	if reread == first || reread.Pools["www"]["pm.max_children"] != "10" {
+		t.Errorf("Expected the config to be read again, got %v", reread.Pools["www"])
+	}
+}
+
+func TestReadFPMConfig_FallsBackToFiles(t *testing.T) {
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	configPath := filepath.Join(t.TempDir(), "php-fpm.conf")
+	content := "[global]\npid = /run/php-fpm.pid\n[www]\nlisten = /run/php/www.sock\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	conf, err := ReadFPMConfig("/non/existent/php-fpm", configPath, "", 0)
+	if err != nil {
+		t.Fatalf("ReadFPMConfig failed: %v", err)
+	}
+	if conf.Global["pid"] != "/run/php-fpm.pid" || conf.Pools["www"]["listen"] != "/run/php/www.sock" {
+		t.Errorf("Expected the config read from the file, got %+v", conf)
+	}
+}
+
+func TestReadFPMConfig_OtherRoot(t *testing.T) {
+	useProcFixture(t)
+	t.Setenv("APP_ENV", "exporter")
+
+	// The binary is never run for a master with another root
+	conf, err := ReadFPMConfig("testdata/proc/2000/root/usr/sbin/php-fpm", "/etc/php-fpm.conf", "testdata/proc/2000/root", 2000)
+	if err != nil {
+		t.Fatalf("ReadFPMConfig failed: %v", err)
+	}
+	if len(conf.Pools) != 3 {
+		t.Errorf("Expected the pools of the included files, got %+v", conf.Pools)
+	}
+	if got := conf.Pools["cron"]["env[APP_ENV]"]; got != "staging" {
+		t.Errorf("Expected ${APP_ENV} from the master's environment, got %q", got)
+	}
+
+	InvalidateFPMConfig("testdata/proc/2000/root/usr/sbin/php-fpm", "/etc/php-fpm.conf", "testdata/proc/2000/root")
+	if _, ok := cachedFPMConfig(fpmConfigKey("testdata/proc/2000/root/usr/sbin/php-fpm", "/etc/php-fpm.conf", "testdata/proc/2000/root")); ok {
+		t.Error("Expected the cached config to be dropped")
+	}
+}
+
+func TestReadFPMConfig_CachesTTFailure(t *testing.T) {
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	tempDir := t.TempDir()
+	runsPath := filepath.Join(tempDir, "runs")
+	mockFpmPath := filepath.Join(tempDir, "php-fpm")
+	// A binary that cannot run here, e.g. one from a distroless image
+	mockScript := "#!/bin/bash\necho run >> " + runsPath + "\nexit 1\n"
+	if err := os.WriteFile(mockFpmPath, []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to create mock script: %v", err)
+	}
+	// The config files cannot be read either, so nothing is cached
+	configPath := filepath.Join(tempDir, "missing.conf")
+
+	runs := func() int {
+		data, _ := os.ReadFile(runsPath)
+		return strings.Count(string(data), "run")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ReadFPMConfig(mockFpmPath, configPath, "", 0); err == nil {
+			t.Fatal("Expected ReadFPMConfig to fail")
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("Expected php-fpm -tt to be run once, got %d", n)
+	}
+
+	InvalidateFPMConfig(mockFpmPath, configPath, "")
+	ReadFPMConfig(mockFpmPath, configPath, "", 0)
+	if n := runs(); n != 2 {
+		t.Errorf("Expected php-fpm -tt to be run again after a restart, got %d", n)
+	}
+}
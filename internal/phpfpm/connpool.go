@@ -0,0 +1,371 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// Defaults for ConfigureConnections, matching those of phpfpm.connections.
+const (
+	DefaultMaxIdleConns    = 1
+	DefaultIdleConnTimeout = 30 * time.Second
+	DefaultMaxDialBackoff  = 30 * time.Second
+)
+
+// dialTimeout bounds a dial when the request's context has no deadline.
+const dialTimeout = 5 * time.Second
+
+// minDialBackoff is the wait after the first failed dial, doubled with every
+// further failure up to the configured maximum.
+const minDialBackoff = time.Second
+
+// DialBuckets are the upper bounds, in seconds, of the dial latency buckets
+// in ConnStats.
+var DialBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// ConnStats are the cumulative connection counters of one status socket.
+type ConnStats struct {
+	Dials       uint64   // connections opened
+	DialSeconds float64  // total time spent opening them
+	DialBuckets []uint64 // dials that took at most DialBuckets[i] seconds, cumulative
+	Requests    uint64   // requests sent
+	Reused      uint64   // requests sent on a connection kept from earlier
+	Stale       uint64   // kept connections found closed by php-fpm
+	Idle        int      // connections currently kept open
+}
+
+// dialError marks a failure to connect, as opposed to one of the request.
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string { return e.err.Error() }
+func (e *dialError) Unwrap() error { return e.err }
+
+// connPool keeps FastCGI connections to status sockets open between
+// requests, so a poll's status request and probes share one connection
+// instead of dialing for each. Dials to a failing socket are spaced out with
+// an exponential backoff, except those of one-shot requests.
+type connPool struct {
+	mu    sync.Mutex
+	cfg   config.ConnectionsConfig
+	conns map[string]*socketConns // by socket
+}
+
+type socketConns struct {
+	idle     []*fcgiConn // most recently used last
+	failures int
+	retryAt  time.Time
+	lastErr  error
+	stats    ConnStats
+}
+
+var fcgiConns = newConnPool(config.ConnectionsConfig{
+	KeepAlive:   true,
+	MaxIdle:     DefaultMaxIdleConns,
+	IdleTimeout: DefaultIdleConnTimeout,
+	MaxBackoff:  DefaultMaxDialBackoff,
+})
+
+func newConnPool(cfg config.ConnectionsConfig) *connPool {
+	return &connPool{cfg: cfg, conns: make(map[string]*socketConns)}
+}
+
+// ConfigureConnections applies phpfpm.connections to the connections shared
+// by all scrapes and probes. Connections kept so far are closed.
+func ConfigureConnections(cfg config.ConnectionsConfig) {
+	fcgiConns.configure(cfg)
+}
+
+// ConnectionStats returns a copy of the connection counters by status socket.
+func ConnectionStats() map[string]ConnStats {
+	return fcgiConns.statsCopy()
+}
+
+// fcgiGet sends a GET request with params to socket over a kept connection
+// when there is one. A failure on a kept connection, which php-fpm may have
+// closed in the meantime, is retried once on a new one. Dial failures are
+// returned as *dialError.
+func fcgiGet(ctx context.Context, socket string, params map[string]string) (*fcgiResponse, error) {
+	return fcgiConns.get(ctx, socket, params)
+}
+
+// poolGet sends a request of poolCfg's scrape to socket. Connections are
+// only kept to a separate status socket: one kept to the listen socket would
+// hold a worker that serves traffic. A transient pool gets a connection of
+// its own that counts towards neither the socket's stats nor its dial backoff.
+func poolGet(ctx context.Context, poolCfg config.FPMPoolConfig, socket string, params map[string]string) (*fcgiResponse, error) {
+	switch {
+	case poolCfg.Transient:
+		return fcgiGetUnpooled(ctx, socket, params)
+	case socket == poolCfg.Socket:
+		return fcgiConns.getOnce(ctx, socket, params)
+	default:
+		return fcgiGet(ctx, socket, params)
+	}
+}
+
+// fcgiGetUnpooled sends a request on a new connection, closed afterwards,
+// without going through fcgiConns.
+func fcgiGetUnpooled(ctx context.Context, socket string, params map[string]string) (*fcgiResponse, error) {
+	scheme, address, _, err := ParseAddress(socket, "")
+	if err != nil {
+		return nil, &dialError{err: err}
+	}
+	start := time.Now()
+	conn, err := dialAddress(ctx, scheme, address)
+	if err != nil {
+		return nil, &dialError{err: err}
+	}
+	c := newFCGIConn(conn, false)
+	defer c.close()
+
+	resp, err := c.do(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	resp.Duration = time.Since(start)
+	return resp, nil
+}
+
+func (p *connPool) configure(cfg config.ConnectionsConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cfg = cfg
+	for _, sc := range p.conns {
+		for _, c := range sc.idle {
+			c.stopIdleTimer()
+			c.close()
+		}
+		sc.idle = nil
+		sc.stats.Idle = 0
+	}
+}
+
+func (p *connPool) get(ctx context.Context, socket string, params map[string]string) (*fcgiResponse, error) {
+	// The liveness check of a kept connection is not part of the round trip
+	if c := p.take(socket); c != nil {
+		start := time.Now()
+		resp, err := c.do(ctx, params)
+		if err == nil {
+			resp.Duration = time.Since(start)
+			p.release(socket, c)
+			return resp, nil
+		}
+		c.close()
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	c, err := p.dial(ctx, socket, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, params)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	resp.Duration = time.Since(start)
+	p.release(socket, c)
+	return resp, nil
+}
+
+// getOnce sends a request on a new connection, which is closed afterwards.
+// It is dialed whatever the socket's backoff, see dial.
+func (p *connPool) getOnce(ctx context.Context, socket string, params map[string]string) (*fcgiResponse, error) {
+	start := time.Now()
+	c, err := p.dial(ctx, socket, false)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	resp, err := c.do(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	resp.Duration = time.Since(start)
+	return resp, nil
+}
+
+// take returns a kept connection to socket that is still open, or nil.
+func (p *connPool) take(socket string) *fcgiConn {
+	for {
+		p.mu.Lock()
+		sc := p.socket(socket)
+		if len(sc.idle) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		c := sc.idle[len(sc.idle)-1]
+		sc.idle = sc.idle[:len(sc.idle)-1]
+		sc.stats.Idle = len(sc.idle)
+		c.stopIdleTimer()
+		p.mu.Unlock()
+
+		alive := c.alive()
+
+		p.mu.Lock()
+		if alive {
+			sc.stats.Requests++
+			sc.stats.Reused++
+		} else {
+			sc.stats.Stale++
+		}
+		p.mu.Unlock()
+
+		if alive {
+			return c
+		}
+		c.close()
+	}
+}
+
+// release keeps c for the next request to socket, or closes it when keeping
+// connections is disabled or enough are kept already.
+func (p *connPool) release(socket string, c *fcgiConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sc := p.socket(socket)
+	if !p.cfg.KeepAlive || !c.keepAlive || len(sc.idle) >= p.cfg.MaxIdle {
+		c.close()
+		return
+	}
+
+	if p.cfg.IdleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(p.cfg.IdleTimeout, func() { p.expire(socket, c) })
+	}
+	sc.idle = append(sc.idle, c)
+	sc.stats.Idle = len(sc.idle)
+}
+
+// expire closes c when it is still kept after the idle timeout, so a pool
+// that is no longer polled does not hold on to one of its workers.
+func (p *connPool) expire(socket string, c *fcgiConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sc, ok := p.conns[socket]
+	if !ok {
+		return
+	}
+	for i, idle := range sc.idle {
+		if idle == c {
+			sc.idle = append(sc.idle[:i], sc.idle[i+1:]...)
+			sc.stats.Idle = len(sc.idle)
+			c.close()
+			return
+		}
+	}
+}
+
+// forget closes the connections kept to socket and drops its counters.
+func (p *connPool) forget(socket string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sc, ok := p.conns[socket]
+	if !ok {
+		return
+	}
+	for _, c := range sc.idle {
+		c.stopIdleTimer()
+		c.close()
+	}
+	delete(p.conns, socket)
+}
+
+// dial opens a new connection to socket, to be kept when keep is set and
+// keeping connections is enabled. Only dials for kept connections wait for
+// and extend the socket's backoff: one-shot requests to the listen socket
+// are sent once per poll already, and backing them off would report a pool
+// that has come back as down for up to the maximum backoff.
+func (p *connPool) dial(ctx context.Context, socket string, keep bool) (*fcgiConn, error) {
+	p.mu.Lock()
+	sc := p.socket(socket)
+	if wait := time.Until(sc.retryAt); keep && wait > 0 {
+		err := fmt.Errorf("%w (retrying in %s)", sc.lastErr, wait.Round(time.Millisecond))
+		p.mu.Unlock()
+		return nil, &dialError{err: err}
+	}
+	keepAlive := keep && p.cfg.KeepAlive
+	maxBackoff := p.cfg.MaxBackoff
+	p.mu.Unlock()
+
+	scheme, address, _, err := ParseAddress(socket, "")
+	if err != nil {
+		return nil, &dialError{err: err}
+	}
+
+	start := time.Now()
+	conn, err := dialAddress(ctx, scheme, address)
+	elapsed := time.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		// A dial cut short by the scrape's own deadline says little about the socket
+		if keep && maxBackoff > 0 && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			backoff := min(minDialBackoff<<min(sc.failures, 16), maxBackoff)
+			sc.failures++
+			sc.retryAt = time.Now().Add(backoff)
+			sc.lastErr = err
+		}
+		return nil, &dialError{err: err}
+	}
+
+	if keep {
+		sc.failures = 0
+		sc.retryAt = time.Time{}
+		sc.lastErr = nil
+	}
+	sc.stats.Dials++
+	sc.stats.DialSeconds += elapsed.Seconds()
+	for i, bound := range DialBuckets {
+		if elapsed.Seconds() <= bound {
+			sc.stats.DialBuckets[i]++
+		}
+	}
+	sc.stats.Requests++
+	return newFCGIConn(conn, keepAlive), nil
+}
+
+func dialAddress(ctx context.Context, scheme, address string) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	return d.DialContext(ctx, scheme, address)
+}
+
+// socket returns the state of socket, creating it. p.mu must be held.
+func (p *connPool) socket(socket string) *socketConns {
+	sc, ok := p.conns[socket]
+	if !ok {
+		sc = &socketConns{stats: ConnStats{DialBuckets: make([]uint64, len(DialBuckets))}}
+		p.conns[socket] = sc
+	}
+	return sc
+}
+
+func (p *connPool) statsCopy() map[string]ConnStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make(map[string]ConnStats, len(p.conns))
+	for socket, sc := range p.conns {
+		stats := sc.stats
+		stats.DialBuckets = append([]uint64(nil), sc.stats.DialBuckets...)
+		out[socket] = stats
+	}
+	return out
+}
@@ -0,0 +1,274 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func keepAliveConfig() config.ConnectionsConfig {
+	return config.ConnectionsConfig{
+		KeepAlive:   true,
+		MaxIdle:     DefaultMaxIdleConns,
+		IdleTimeout: DefaultIdleConnTimeout,
+		MaxBackoff:  DefaultMaxDialBackoff,
+	}
+}
+
+// withConnections applies cfg to the shared connections for the duration of
+// the test.
+func withConnections(t *testing.T, cfg config.ConnectionsConfig) {
+	fcgiConns.mu.Lock()
+	prev := fcgiConns.cfg
+	fcgiConns.mu.Unlock()
+
+	ConfigureConnections(cfg)
+	t.Cleanup(func() { ConfigureConnections(prev) })
+}
+
+func okHandler(params map[string]string) string {
+	return "Content-Type: text/plain\r\n\r\n" + params["SCRIPT_NAME"]
+}
+
+func TestConnPool_ReusesConnection(t *testing.T) {
+	fpm := fcgitest.Start(t, okHandler)
+	p := newConnPool(keepAliveConfig())
+
+	for i := 0; i < 3; i++ {
+		resp, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/status"})
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		if string(resp.Body) != "/status" {
+			t.Errorf("Expected the response body, got %q", resp.Body)
+		}
+	}
+
+	if n := fpm.Conns(); n != 1 {
+		t.Errorf("Expected one connection for all requests, got %d", n)
+	}
+	stats := p.statsCopy()[fpm.Socket]
+	if stats.Dials != 1 || stats.Requests != 3 || stats.Reused != 2 || stats.Idle != 1 {
+		t.Errorf("Expected 1 dial, 3 requests, 2 reused and 1 idle, got %+v", stats)
+	}
+	if stats.DialBuckets[len(DialBuckets)-1] != 1 {
+		t.Errorf("Expected the dial in the last bucket, got %v", stats.DialBuckets)
+	}
+}
+
+func TestConnPool_DurationLeavesOutLivenessCheck(t *testing.T) {
+	fpm := fcgitest.Start(t, okHandler)
+	p := newConnPool(keepAliveConfig())
+
+	resp, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/ping"})
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.Duration <= 0 {
+		t.Errorf("Expected the round trip of a new connection to be measured, got %v", resp.Duration)
+	}
+
+	// The check of the kept connection waits at least its 1ms read deadline
+	start := time.Now()
+	resp, err = p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/ping"})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if p.statsCopy()[fpm.Socket].Reused != 1 {
+		t.Fatalf("Expected the kept connection to be reused")
+	}
+	if resp.Duration <= 0 || elapsed-resp.Duration < time.Millisecond {
+		t.Errorf("Expected the round trip without the liveness check, got %v of %v", resp.Duration, elapsed)
+	}
+}
+
+func TestConnPool_KeepAliveDisabled(t *testing.T) {
+	fpm := fcgitest.Start(t, okHandler)
+	cfg := keepAliveConfig()
+	cfg.KeepAlive = false
+	p := newConnPool(cfg)
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/status"}); err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+	}
+
+	if n := fpm.Conns(); n != 3 {
+		t.Errorf("Expected a connection per request, got %d", n)
+	}
+	if stats := p.statsCopy()[fpm.Socket]; stats.Reused != 0 || stats.Idle != 0 {
+		t.Errorf("Expected no reused or idle connections, got %+v", stats)
+	}
+}
+
+func TestConnPool_StaleConnection(t *testing.T) {
+	fpm := fcgitest.Start(t, okHandler)
+	p := newConnPool(keepAliveConfig())
+
+	if _, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/status"}); err != nil {
+		t.Fatalf("First request failed: %v", err)
+	}
+	fpm.CloseConns()
+
+	resp, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/status"})
+	if err != nil {
+		t.Fatalf("Expected a new connection after the kept one was closed, got %v", err)
+	}
+	if string(resp.Body) != "/status" {
+		t.Errorf("Expected the response body, got %q", resp.Body)
+	}
+
+	if n := fpm.Conns(); n != 2 {
+		t.Errorf("Expected a second connection, got %d", n)
+	}
+	if stats := p.statsCopy()[fpm.Socket]; stats.Stale != 1 || stats.Dials != 2 {
+		t.Errorf("Expected 1 stale connection and 2 dials, got %+v", stats)
+	}
+}
+
+func TestConnPool_IdleTimeout(t *testing.T) {
+	fpm := fcgitest.Start(t, okHandler)
+	cfg := keepAliveConfig()
+	cfg.IdleTimeout = 20 * time.Millisecond
+	p := newConnPool(cfg)
+
+	if _, err := p.get(context.Background(), fpm.Socket, map[string]string{"SCRIPT_NAME": "/status"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.statsCopy()[fpm.Socket].Idle != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the idle connection to be closed after the idle timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnPool_DialBackoff(t *testing.T) {
+	socket := "unix://" + filepath.Join(t.TempDir(), "missing.sock")
+	p := newConnPool(keepAliveConfig())
+
+	_, err := p.get(context.Background(), socket, nil)
+	var dialErr *dialError
+	if !errors.As(err, &dialErr) {
+		t.Fatalf("Expected a dial error, got %v", err)
+	}
+
+	_, err = p.get(context.Background(), socket, nil)
+	if !errors.As(err, &dialErr) || !strings.Contains(err.Error(), "retrying in") {
+		t.Fatalf("Expected the second dial to wait for the backoff, got %v", err)
+	}
+
+	// Each further failure doubles the wait
+	p.mu.Lock()
+	p.conns[socket].retryAt = time.Time{}
+	p.mu.Unlock()
+	p.get(context.Background(), socket, nil)
+
+	p.mu.Lock()
+	wait := time.Until(p.conns[socket].retryAt)
+	p.mu.Unlock()
+	if wait <= minDialBackoff || wait > 2*minDialBackoff {
+		t.Errorf("Expected a backoff of %s, got %s", 2*minDialBackoff, wait)
+	}
+}
+
+func TestConnPool_OneShotNoBackoff(t *testing.T) {
+	socket := "unix://" + filepath.Join(t.TempDir(), "missing.sock")
+	p := newConnPool(keepAliveConfig())
+
+	for i := 0; i < 2; i++ {
+		_, err := p.getOnce(context.Background(), socket, nil)
+		var dialErr *dialError
+		if !errors.As(err, &dialErr) || strings.Contains(err.Error(), "retrying in") {
+			t.Fatalf("Expected dial %d to be attempted, got %v", i, err)
+		}
+	}
+
+	p.mu.Lock()
+	retryAt := p.conns[socket].retryAt
+	p.mu.Unlock()
+	if !retryAt.IsZero() {
+		t.Errorf("Expected one-shot dials to leave the backoff alone, got a retry at %s", retryAt)
+	}
+}
+
+func TestGetMetricsForPool_SharesConnection(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	withConnections(t, keepAliveConfig())
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		if params["SCRIPT_NAME"] == "/status" {
+			return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "process manager": "static", "processes": []}`
+		}
+		return "Status: 404 Not Found\r\n\r\nFile not found."
+	})
+
+	// A separate status socket, as with pm.status_listen
+	cfg := config.FPMPoolConfig{
+		Socket:       "unix://" + filepath.Join(t.TempDir(), "www.sock"),
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		ProbeDir:     t.TempDir(),
+	}
+
+	if _, err := GetMetricsForPool(context.Background(), cfg); err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+
+	if n := len(fpm.Requests()); n < 2 {
+		t.Fatalf("Expected the status page and probes to be requested, got %d requests", n)
+	}
+	if n := fpm.Conns(); n != 1 {
+		t.Errorf("Expected the status request and probes to share one connection, got %d", n)
+	}
+	if stats := ConnectionStats()[fpm.Socket]; stats.Dials != 1 || stats.Reused == 0 {
+		t.Errorf("Expected one dial and reused connections, got %+v", stats)
+	}
+}
+
+func TestGetMetricsForPool_ListenSocketNotKept(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	withConnections(t, keepAliveConfig())
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		if params["SCRIPT_NAME"] == "/status" {
+			return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "process manager": "static", "processes": []}`
+		}
+		return "Status: 404 Not Found\r\n\r\nFile not found."
+	})
+
+	// The status page is served on the listen socket
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		ProbeDir:     t.TempDir(),
+	}
+
+	if _, err := GetMetricsForPool(context.Background(), cfg); err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+
+	requests := len(fpm.Requests())
+	if n := fpm.Conns(); n != requests {
+		t.Errorf("Expected a connection per request, got %d for %d requests", n, requests)
+	}
+	if stats := ConnectionStats()[fpm.Socket]; stats.Reused != 0 || stats.Idle != 0 {
+		t.Errorf("Expected no connection to the listen socket to be kept, got %+v", stats)
+	}
+}
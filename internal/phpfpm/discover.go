@@ -4,27 +4,132 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
 type DiscoveredFPM struct {
-	ConfigPath   string
-	StatusPath   string
-	Binary       string
-	Socket       string
-	StatusSocket string
-	CliBinary    string
+	Name              string
+	ConfigPath        string
+	StatusPath        string
+	StatusPathEnabled bool // pm.status_path is set; the pool is reported as unavailable otherwise
+	PingPath          string
+	PingResponse      string
+	Binary            string
+	Socket            string
+	StatusSocket      string // pm.status_listen, or listen when the pool has none
+	CliBinary         string
+	Root              string // the master's filesystem root when in another mount namespace
+}
+
+// PoolConfig returns the configuration to scrape the discovered pool with.
+func (d DiscoveredFPM) PoolConfig() config.FPMPoolConfig {
+	return config.FPMPoolConfig{
+		Name:              d.Name,
+		Socket:            d.Socket,
+		StatusSocket:      d.StatusSocket,
+		StatusPath:        d.StatusPath,
+		StatusPathEnabled: d.StatusPathEnabled,
+		PingPath:          d.PingPath,
+		PingResponse:      d.PingResponse,
+		ConfigPath:        d.ConfigPath,
+		Binary:            d.Binary,
+		CliBinary:         d.CliBinary,
+		Root:              d.Root,
+		Discovered:        true,
+	}
+}
+
+// MergeDiscovered returns the statically configured pools followed by the
+// discovered ones. A discovered pool is left out when its socket is already
+// configured or was discovered before.
+func MergeDiscovered(static []config.FPMPoolConfig, discovered []DiscoveredFPM) []config.FPMPoolConfig {
+	pools := make([]config.FPMPoolConfig, 0, len(static)+len(discovered))
+	seen := make(map[string]bool, len(static)+len(discovered))
+	for _, pool := range static {
+		pools = append(pools, pool)
+		seen[pool.Socket] = true
+	}
+	for _, d := range discovered {
+		if seen[d.Socket] {
+			continue
+		}
+		pools = append(pools, d.PoolConfig())
+		seen[d.Socket] = true
+	}
+	return pools
 }
 
 var fpmNamePattern = regexp.MustCompile(`^php[0-9]{0,2}.*fpm.*$`)
 
+// masterKey identifies a running master: the same PID with another binary
+// is a new master.
+type masterKey struct {
+	binary string
+	pid    int32
+}
+
+// masterInfo holds what discovery learned about a master that does not
+// change while it runs, so rediscovery neither runs its binary nor dials
+// its sockets again.
+type masterInfo struct {
+	mu        sync.Mutex
+	cliBinary *string           // nil until looked up
+	sockets   map[string]string // resolved socket by listen value
+}
+
+var (
+	discoveredMastersMu sync.Mutex
+	discoveredMasters   = make(map[masterKey]*masterInfo)
+)
+
+func discoveredMaster(key masterKey) *masterInfo {
+	discoveredMastersMu.Lock()
+	defer discoveredMastersMu.Unlock()
+
+	info, ok := discoveredMasters[key]
+	if !ok {
+		info = &masterInfo{sockets: make(map[string]string)}
+		discoveredMasters[key] = info
+	}
+	return info
+}
+
+// forgetMastersExcept drops what is known about masters that are gone.
+func forgetMastersExcept(alive map[int32]bool) {
+	discoveredMastersMu.Lock()
+	defer discoveredMastersMu.Unlock()
+
+	for key := range discoveredMasters {
+		if !alive[key.pid] {
+			delete(discoveredMasters, key)
+		}
+	}
+}
+
+// socket resolves a listen value, dialing only for those not seen before.
+// Must be called with m.mu held.
+func (m *masterInfo) socket(listen string) string {
+	if socket, ok := m.sockets[listen]; ok {
+		return socket
+	}
+	socket := parseSocket(listen)
+	if socket != "" {
+		m.sockets[listen] = socket
+	}
+	return socket
+}
+
 func DiscoverFPMProcesses() ([]DiscoveredFPM, error) {
 	procs, err := process.Processes()
 	if err != nil {
@@ -32,6 +137,7 @@ func DiscoverFPMProcesses() ([]DiscoveredFPM, error) {
 	}
 
 	found := make([]DiscoveredFPM, 0)
+	alive := make(map[int32]bool)
 
 	for _, p := range procs {
 		name, err := p.Name()
@@ -44,66 +150,123 @@ func DiscoverFPMProcesses() ([]DiscoveredFPM, error) {
 			continue
 		}
 
-		config := extractConfigFromMaster(cmdlineStr)
-		if config == "" {
-			continue
-		}
-
 		exe, err := p.Exe()
 		if err != nil {
 			logging.L().Debug("PHPeek Cannot determine binary path", "pid", p.Pid, "error", err)
 			continue
 		}
 
-		parsed, err := ParseFPMConfig(exe, config)
-		if err != nil {
-			logging.L().Error("PHPeek PHPeek Failed to parse FPM config", "config", config, "error", err)
+		alive[p.Pid] = true
+		found = append(found, discoverMaster(p.Pid, cmdlineStr, exe)...)
+	}
+	forgetMastersExcept(alive)
+
+	return found, nil
+}
+
+// discoverMaster returns the pools of the master with the given pid. A master
+// in another mount namespace, such as a sidecar sharing the process
+// namespace, is read through /proc/<pid>/root: its binary, config files and
+// unix sockets are only reachable there.
+func discoverMaster(pid int32, cmdline, exe string) []DiscoveredFPM {
+	config := extractConfigFromMaster(cmdline)
+	if config == "" {
+		return nil
+	}
+
+	root := masterRoot(pid)
+	binary := HostPath(root, exe)
+
+	parsed, err := ReadFPMConfig(binary, config, root, int(pid))
+	if err != nil {
+		logging.L().Error("PHPeek Failed to parse FPM config", "config", config, "root", root, "error", err)
+		return nil
+	}
+
+	master := discoveredMaster(masterKey{binary: binary, pid: pid})
+	master.mu.Lock()
+	defer master.mu.Unlock()
+
+	// The matching CLI is looked up on the exporter's PATH, which is
+	// meaningless for a master in another container
+	if master.cliBinary == nil {
+		cliBinary := ""
+		if root == "" {
+			cliBinary, _ = findMatchingCliBinary(binary)
+		}
+		master.cliBinary = &cliBinary
+	}
+	cliBinary := *master.cliBinary
+
+	var found []DiscoveredFPM
+	for poolName, poolConfig := range parsed.Pools {
+		socket := translateSocket(master.socket(poolConfig["listen"]), root)
+		if socket == "" {
 			continue
 		}
 
-		for poolName, poolConfig := range parsed.Pools {
-			socket := parseSocket(poolConfig["listen"])
-			if socket == "" {
-				continue
-			}
+		// A dedicated status listener keeps status requests off the
+		// workers serving traffic
+		statusSocket := translateSocket(master.socket(poolConfig["pm.status_listen"]), root)
+		if statusSocket == "" {
+			statusSocket = socket
+		}
 
-			statusSocket := parseSocket(poolConfig["status_listen"])
-			if statusSocket == "" {
-				statusSocket = socket
-			}
+		// Pools without a status path are kept, to be reported as
+		// unavailable rather than silently missing. pm.status_path is a
+		// pool directive, php-fpm does not accept it in [global].
+		status := poolConfig["pm.status_path"]
 
-			status := poolConfig["pm.status_path"]
-			if status == "" {
-				status = parsed.Global["pm.status_path"]
-			}
-			if status == "" {
-				logging.L().Debug("PHPeek Skipping pool with no status path", "pool", poolName, "config", config)
-				continue
-			}
+		found = append(found, DiscoveredFPM{
+			Name:              poolName,
+			ConfigPath:        config,
+			StatusPath:        status,
+			StatusPathEnabled: status != "",
+			PingPath:          poolConfig["ping.path"],
+			PingResponse:      poolConfig["ping.response"],
+			Binary:            binary,
+			Socket:            socket,
+			StatusSocket:      statusSocket,
+			CliBinary:         cliBinary,
+			Root:              root,
+		})
 
-			cliBinary, _ := findMatchingCliBinary(exe)
-
-			found = append(found, DiscoveredFPM{
-				ConfigPath:   config,
-				StatusPath:   status,
-				Binary:       exe,
-				Socket:       socket,
-				StatusSocket: statusSocket,
-				CliBinary:    cliBinary,
-			})
-
-			logging.L().Debug("PHPeek Discovered php-fpm pool",
-				"config", config,
-				"pool", poolName,
-				"socket", socket,
-				"status_socket", statusSocket,
-				"status_path", status,
-				"cli_binary", cliBinary,
-			)
-		}
+		logging.L().Debug("PHPeek Discovered php-fpm pool",
+			"config", config,
+			"pool", poolName,
+			"socket", socket,
+			"status_socket", statusSocket,
+			"status_path", status,
+			"cli_binary", cliBinary,
+			"root", root,
+		)
 	}
+	return found
+}
 
-	return found, nil
+// masterRoot returns /proc/<pid>/root when the process is in another mount
+// namespace than the exporter, and "" when it shares the exporter's or the
+// namespaces cannot be compared.
+func masterRoot(pid int32) string {
+	own, err := os.Readlink(filepath.Join(procRoot, "self", "ns", "mnt"))
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(procRoot, strconv.Itoa(int(pid)))
+	theirs, err := os.Readlink(filepath.Join(dir, "ns", "mnt"))
+	if err != nil || theirs == own {
+		return ""
+	}
+	return filepath.Join(dir, "root")
+}
+
+// translateSocket rewrites a unix socket of a master with the given root to
+// the path the exporter reaches it by. TCP sockets are left as they are.
+func translateSocket(socket, root string) string {
+	if root == "" || !strings.HasPrefix(socket, "unix://") {
+		return socket
+	}
+	return "unix://" + HostPath(root, strings.TrimPrefix(socket, "unix://"))
 }
 
 func parseSocket(socket string) string {
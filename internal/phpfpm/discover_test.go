@@ -1,10 +1,15 @@
 package phpfpm
 
 import (
+	"net"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
@@ -505,3 +510,165 @@ func TestRegexPatterns(t *testing.T) {
 		}
 	}
 }
+
+func TestMergeDiscovered(t *testing.T) {
+	static := []config.FPMPoolConfig{
+		{Name: "www", Socket: "unix:///run/php/www.sock", StatusPath: "/status"},
+	}
+	discovered := []DiscoveredFPM{
+		{Name: "www", Socket: "unix:///run/php/www.sock", StatusPath: "/fpm-status"},
+		{Name: "api", Socket: "unix:///run/php/api.sock", StatusPath: "/status", Binary: "/usr/sbin/php-fpm8.3"},
+		{Name: "api", Socket: "unix:///run/php/api.sock", StatusPath: "/status", Binary: "/usr/sbin/php-fpm8.3"},
+	}
+
+	pools := MergeDiscovered(static, discovered)
+
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %+v", pools)
+	}
+	if pools[0].StatusPath != "/status" || pools[0].Discovered {
+		t.Errorf("Expected the configured pool to be kept as is, got %+v", pools[0])
+	}
+	if pools[1].Name != "api" || pools[1].Binary != "/usr/sbin/php-fpm8.3" || !pools[1].Discovered {
+		t.Errorf("Expected the discovered api pool, got %+v", pools[1])
+	}
+}
+
+func TestMasterRoot(t *testing.T) {
+	useProcFixture(t)
+
+	if root := masterRoot(1200); root != "" {
+		t.Errorf("Expected no root for a master in the exporter's namespace, got %s", root)
+	}
+	if root := masterRoot(2000); root != filepath.Join("testdata/proc", "2000", "root") {
+		t.Errorf("Expected the master's root, got %s", root)
+	}
+	if root := masterRoot(9999); root != "" {
+		t.Errorf("Expected no root for an unknown process, got %s", root)
+	}
+}
+
+func TestTranslateSocket(t *testing.T) {
+	tests := []struct {
+		socket   string
+		root     string
+		expected string
+	}{
+		{"unix:///run/php/www.sock", "", "unix:///run/php/www.sock"},
+		{"unix:///run/php/www.sock", "/proc/2000/root", "unix:///proc/2000/root/run/php/www.sock"},
+		{"tcp://127.0.0.1:9000", "/proc/2000/root", "tcp://127.0.0.1:9000"},
+		{"", "/proc/2000/root", ""},
+	}
+
+	for _, tt := range tests {
+		if got := translateSocket(tt.socket, tt.root); got != tt.expected {
+			t.Errorf("translateSocket(%q, %q) = %q, expected %q", tt.socket, tt.root, got, tt.expected)
+		}
+	}
+}
+
+func TestDiscoverMaster_OtherNamespace(t *testing.T) {
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+	useProcFixture(t)
+
+	root := filepath.Join("testdata/proc", "2000", "root")
+	found := discoverMaster(2000, "php-fpm: master process (/etc/php-fpm.conf)", "/usr/sbin/php-fpm")
+	t.Cleanup(func() { InvalidateFPMConfig(filepath.Join(root, "usr/sbin/php-fpm"), "/etc/php-fpm.conf", root) })
+
+	if len(found) != 3 {
+		t.Fatalf("Expected 3 pools, got %+v", found)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+
+	api, cron, www := found[0], found[1], found[2]
+	if www.Socket != "unix://"+filepath.Join(root, "run/php/www.sock") || www.StatusSocket != www.Socket || www.StatusPath != "/status" || !www.StatusPathEnabled {
+		t.Errorf("Expected the www socket below the master's root, got %+v", www)
+	}
+	if api.Socket != "tcp://127.0.0.1:9001" || api.StatusSocket != "unix://"+filepath.Join(root, "run/php/api-status.sock") || api.StatusPath != "/fpm-status" {
+		t.Errorf("Expected the api TCP socket and translated status socket, got %+v", api)
+	}
+	// Kept to be reported as unavailable
+	if cron.StatusPath != "" || cron.StatusPathEnabled || cron.PoolConfig().StatusPathEnabled {
+		t.Errorf("Expected the cron pool without a status path, got %+v", cron)
+	}
+	if www.Binary != filepath.Join(root, "usr/sbin/php-fpm") || www.ConfigPath != "/etc/php-fpm.conf" || www.Root != root || www.CliBinary != "" {
+		t.Errorf("Expected the binary below the master's root, got %+v", www)
+	}
+	if cfg := www.PoolConfig(); cfg.Root != root {
+		t.Errorf("Expected the pool config to carry the root, got %+v", cfg)
+	}
+}
+
+func TestDiscoverMaster_Rediscovery(t *testing.T) {
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	// A pool listening on a port alone is resolved by dialing it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	var dials atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			dials.Add(1)
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	tempDir := t.TempDir()
+	runs := filepath.Join(tempDir, "runs")
+	binary := filepath.Join(tempDir, "php-fpm")
+	script := `#!/bin/bash
+if [[ "$1" == "-v" ]]; then
+    echo run >> ` + runs + `
+    echo "PHP 8.3.4 (fpm-fcgi)"
+    exit 0
+fi
+exit 1
+`
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary: %v", err)
+	}
+	confPath := filepath.Join(tempDir, "php-fpm.conf")
+	conf := "[global]\npm.status_path = /status\n[www]\nlisten = " + port + "\n"
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Cleanup(func() {
+		InvalidateFPMConfig(binary, confPath, "")
+		forgetMastersExcept(nil)
+	})
+
+	const pid = 999999 // not running, so the master shares the exporter's root
+	for i := 0; i < 2; i++ {
+		found := discoverMaster(pid, "php-fpm: master process ("+confPath+")", binary)
+		if len(found) != 1 || found[0].Socket != "tcp://127.0.0.1:"+port {
+			t.Fatalf("Expected the www pool on port %s, got %+v", port, found)
+		}
+		// pm.status_path is not a [global] directive
+		if found[0].StatusPath != "" || found[0].StatusPathEnabled {
+			t.Errorf("Expected no status path from [global], got %+v", found[0])
+		}
+	}
+
+	if out, _ := os.ReadFile(runs); strings.Count(string(out), "run") != 1 {
+		t.Errorf("Expected the binary's version to be read once, got %d runs", strings.Count(string(out), "run"))
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := dials.Load(); n != 1 {
+		t.Errorf("Expected the port to be dialed once, got %d", n)
+	}
+
+	// A master that is gone is looked up again when its PID comes back
+	forgetMastersExcept(map[int32]bool{})
+	discoverMaster(pid, "php-fpm: master process ("+confPath+")", binary)
+	if out, _ := os.ReadFile(runs); strings.Count(string(out), "run") != 2 {
+		t.Errorf("Expected a new master to be looked up again, got %d runs", strings.Count(string(out), "run"))
+	}
+}
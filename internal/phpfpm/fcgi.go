@@ -0,0 +1,111 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgx"
+)
+
+// fcgiConn is a FastCGI connection that can carry one request after another.
+// With keepAlive, requests ask php-fpm to keep the connection open
+// (FCGI_KEEP_CONN); the worker that accepted it stays attached to it until
+// it is closed.
+type fcgiConn struct {
+	conn      net.Conn
+	client    *fcgx.Client
+	keepAlive bool
+	idleTimer *time.Timer // closes the connection once it has been kept too long
+}
+
+// fcgiResponse is the CGI response of a FastCGI request.
+type fcgiResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Duration   time.Duration // round trip, including the dial of a new connection
+}
+
+func newFCGIConn(conn net.Conn, keepAlive bool) *fcgiConn {
+	cfg := fcgx.DefaultConfig()
+	cfg.KeepConn = keepAlive
+	return &fcgiConn{conn: conn, client: fcgx.NewClient(conn, cfg), keepAlive: keepAlive}
+}
+
+// do runs a GET request with params and reads the response. The connection
+// must not be used again after an error.
+func (c *fcgiConn) do(ctx context.Context, params map[string]string) (*fcgiResponse, error) {
+	// fcgx only applies the deadline; unblock reads and writes when ctx is
+	// cancelled before it. The deadline fcgx sets is cleared here as well,
+	// after stop, so a late cancellation cannot leave it behind.
+	defer c.conn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	env := make(map[string]string, len(params)+2)
+	for k, v := range params {
+		env[k] = v
+	}
+	resp, err := c.client.Get(ctx, env)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return nil, fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newFCGIResponse(resp)
+}
+
+// newFCGIResponse reads the body of resp. fcgx only takes the status from a
+// Status header on the first line, PHP may send it after others.
+func newFCGIResponse(resp *http.Response) (*fcgiResponse, error) {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	out := &fcgiResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	if status := resp.Header.Get("Status"); status != "" {
+		code, _, _ := strings.Cut(status, " ")
+		if out.StatusCode, err = strconv.Atoi(code); err != nil {
+			return nil, fmt.Errorf("invalid response status %q", status)
+		}
+	}
+	return out, nil
+}
+
+// alive reports whether an idle connection is still open. php-fpm closes
+// kept connections when the worker exits, e.g. after pm.max_requests or a
+// reload, which shows as EOF or unsolicited data.
+func (c *fcgiConn) alive() bool {
+	if err := c.conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := c.conn.Read(b[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *fcgiConn) close() {
+	c.client.Close()
+}
+
+func (c *fcgiConn) stopIdleTimer() {
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+		c.idleTimer = nil
+	}
+}
@@ -0,0 +1,61 @@
+package phpfpm
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+)
+
+func TestFCGIConn_Do(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		status int
+		header string // Content-Type
+		body   string
+	}{
+		{"crlf headers", "Content-Type: application/json\r\n\r\n{}", 200, "application/json", "{}"},
+		{"lf headers", "Content-Type: text/plain\n\nok", 200, "text/plain", "ok"},
+		{"status header", "Status: 403 Forbidden\r\nContent-Type: text/html\r\n\r\n", 403, "text/html", ""},
+		{"status header after others", "Content-Type: text/html\r\nStatus: 404 Not Found\r\n\r\nFile not found.", 404, "text/html", "File not found."},
+		{"blank line in body", "Content-Type: text/plain\r\n\r\na\r\n\r\nb", 200, "text/plain", "a\r\n\r\nb"},
+		{"large body", "Content-Type: text/plain\r\n\r\n" + strings.Repeat("x", 100000), 200, "text/plain", strings.Repeat("x", 100000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fpm := fcgitest.Start(t, func(map[string]string) string { return tt.raw })
+			conn, err := net.Dial("unix", fpm.Addr)
+			if err != nil {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			c := newFCGIConn(conn, false)
+			defer c.close()
+
+			resp, err := c.do(context.Background(), map[string]string{"SCRIPT_NAME": "/status"})
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if resp.StatusCode != tt.status || resp.Header.Get("Content-Type") != tt.header || string(resp.Body) != tt.body {
+				t.Errorf("Expected %d %q %q, got %d %q %.40q", tt.status, tt.header, tt.body, resp.StatusCode, resp.Header.Get("Content-Type"), resp.Body)
+			}
+		})
+	}
+}
+
+func TestFCGIConn_InvalidStatus(t *testing.T) {
+	fpm := fcgitest.Start(t, func(map[string]string) string { return "Status: forbidden\r\n\r\n" })
+	conn, err := net.Dial("unix", fpm.Addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	c := newFCGIConn(conn, false)
+	defer c.close()
+
+	if _, err := c.do(context.Background(), nil); err == nil {
+		t.Error("Expected an error for an invalid status")
+	}
+}
@@ -0,0 +1,285 @@
+package phpfpm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+// maxIncludeDepth bounds include= nesting, which php-fpm does not limit but
+// which a loop of includes would otherwise turn into endless recursion.
+const maxIncludeDepth = 10
+
+// fpmGlobalDefaults and fpmPoolDefaults are the values php-fpm -tt reports
+// for settings a config leaves out. Settings without a default are reported
+// as undefined there and are left out here.
+var (
+	fpmGlobalDefaults = map[string]string{
+		"log_level":                   "notice",
+		"log_limit":                   "1024",
+		"log_buffering":               "yes",
+		"syslog.ident":                "php-fpm",
+		"syslog.facility":             "daemon",
+		"emergency_restart_threshold": "0",
+		"emergency_restart_interval":  "0s",
+		"process_control_timeout":     "0s",
+		"process.max":                 "0",
+		"daemonize":                   "yes",
+		"rlimit_files":                "0",
+		"rlimit_core":                 "0",
+	}
+	fpmPoolDefaults = map[string]string{
+		"listen.backlog":                           "511",
+		"listen.mode":                              "0660",
+		"process.dumpable":                         "no",
+		"pm.max_spawn_rate":                        "32",
+		"pm.process_idle_timeout":                  "10s",
+		"pm.max_requests":                          "0",
+		"request_slowlog_timeout":                  "0s",
+		"request_slowlog_trace_depth":              "20",
+		"request_terminate_timeout":                "0s",
+		"request_terminate_timeout_track_finished": "no",
+		"rlimit_files":                             "0",
+		"rlimit_core":                              "0",
+		"catch_workers_output":                     "no",
+		"decorate_workers_output":                  "yes",
+		"clear_env":                                "yes",
+		"security.limit_extensions":                ".php .phar",
+	}
+)
+
+// fpmBoolKeys are reported as yes or no by php-fpm -tt, whichever of the ini
+// spellings the config uses.
+var fpmBoolKeys = map[string]bool{
+	"log_buffering":           true,
+	"daemonize":               true,
+	"process.dumpable":        true,
+	"catch_workers_output":    true,
+	"decorate_workers_output": true,
+	"clear_env":               true,
+	"request_terminate_timeout_track_finished": true,
+}
+
+// fpmArrayKey matches the bracketed settings, e.g. php_admin_value[memory_limit].
+var fpmArrayKey = regexp.MustCompile(`^(php_value|php_flag|php_admin_value|php_admin_flag|env)\[\s*([^\]]*?)\s*\]$`)
+
+// fpmEnvVar matches ${VAR}, which the ini parser replaces with the variable
+// from the master's environment.
+var fpmEnvVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ParseFPMConfigFiles reads the php-fpm configuration at path and the files
+// it includes, without running php-fpm, and reports it the way php-fpm -tt
+// would: with defaults filled in, $pool replaced by the pool name and ${VAR}
+// expanded from env, the master's environment (nil for the exporter's).
+// Paths are resolved below root, the master's filesystem root as seen by the
+// exporter ("" for the same one). Relative include= patterns are resolved
+// against prefix, see fpmPrefix.
+func ParseFPMConfigFiles(root string, env map[string]string, prefix string, path string) (*FPMConfig, error) {
+	conf := &FPMConfig{
+		Global: make(map[string]string),
+		Pools:  make(map[string]map[string]string),
+	}
+	p := &fpmConfParser{root: root, env: env, prefix: prefix, conf: conf, section: "global"}
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+
+	for key, value := range fpmGlobalDefaults {
+		if _, ok := conf.Global[key]; !ok {
+			conf.Global[key] = value
+		}
+	}
+	for name, pool := range conf.Pools {
+		for key, value := range fpmPoolDefaults {
+			if _, ok := pool[key]; !ok {
+				pool[key] = value
+			}
+		}
+		// php-fpm substitutes the pool name after all files are read
+		for key, value := range pool {
+			pool[key] = strings.ReplaceAll(value, "$pool", name)
+		}
+	}
+	return conf, nil
+}
+
+type fpmConfParser struct {
+	root    string
+	env     map[string]string
+	prefix  string
+	conf    *FPMConfig
+	section string
+}
+
+func (p *fpmConfParser) parseFile(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("includes nested deeper than %d at %s", maxIncludeDepth, path)
+	}
+
+	f, err := os.Open(HostPath(p.root, path))
+	if err != nil {
+		return fmt.Errorf("failed to read php-fpm config: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			p.section = strings.TrimSpace(line[1 : len(line)-1])
+			if p.section != "global" {
+				if _, ok := p.conf.Pools[p.section]; !ok {
+					p.conf.Pools[p.section] = make(map[string]string)
+				}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key = value", path, lineNo)
+		}
+		key = normalizeFPMKey(strings.TrimSpace(key))
+		value = parseFPMValue(strings.TrimSpace(value), p.env)
+
+		if key == "include" {
+			if err := p.include(value, depth); err != nil {
+				return err
+			}
+			continue
+		}
+		if fpmBoolKeys[key] {
+			value = normalizeFPMBool(value)
+		}
+
+		if p.section == "global" {
+			p.conf.Global[key] = value
+		} else {
+			p.conf.Pools[p.section][key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read php-fpm config: %w", err)
+	}
+	return nil
+}
+
+// include parses every file matching pattern in order. Like php-fpm, relative
+// patterns are taken relative to the prefix, not to the including file.
+func (p *fpmConfParser) include(pattern string, depth int) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.prefix, pattern)
+	}
+
+	matches, err := filepath.Glob(HostPath(p.root, pattern))
+	if err != nil {
+		return fmt.Errorf("invalid include %s: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		logging.L().Warn("PHPeek FPM config include matches no files", "include", pattern, "root", p.root)
+	}
+	for _, match := range matches {
+		// Back to the master's view, parseFile resolves it below root again
+		path := match
+		if p.root != "" {
+			path = "/" + strings.TrimPrefix(strings.TrimPrefix(match, filepath.Clean(p.root)), "/")
+		}
+		if err := p.parseFile(path, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fpmPrefix returns the prefix php-fpm resolves relative include= patterns
+// against: -p or --prefix on the master's command line, or else its install
+// prefix, taken as the parent of the etc directory holding the config, e.g.
+// /usr/local for /usr/local/etc/php-fpm.conf. Without an etc directory the
+// config's own directory is used.
+func fpmPrefix(args []string, configPath string) string {
+	for i, arg := range args {
+		switch {
+		case (arg == "-p" || arg == "--prefix") && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(arg, "--prefix="):
+			return strings.TrimPrefix(arg, "--prefix=")
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2 && !strings.HasPrefix(arg, "--"):
+			return arg[2:]
+		}
+	}
+
+	for dir := filepath.Dir(configPath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == "etc" {
+			return filepath.Dir(dir)
+		}
+	}
+	return filepath.Dir(configPath)
+}
+
+// normalizeFPMKey drops the spaces the ini syntax allows inside the brackets
+// of php_value[...] and the like, so keys match those of php-fpm -tt.
+func normalizeFPMKey(key string) string {
+	if m := fpmArrayKey.FindStringSubmatch(key); m != nil {
+		return m[1] + "[" + m[2] + "]"
+	}
+	return key
+}
+
+// parseFPMValue strips the quotes around a value and any trailing comment
+// after an unquoted one, and expands ${VAR} from env outside of single quotes.
+func parseFPMValue(v string, env map[string]string) string {
+	if len(v) >= 2 && v[0] == '\'' {
+		if end := strings.IndexByte(v[1:], '\''); end >= 0 {
+			return v[1 : end+1]
+		}
+	}
+	if len(v) >= 2 && v[0] == '"' {
+		if end := strings.IndexByte(v[1:], '"'); end >= 0 {
+			return expandFPMEnv(v[1:end+1], env)
+		}
+	}
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return expandFPMEnv(v, env)
+}
+
+// expandFPMEnv replaces ${VAR} with the variable from env, or from the
+// exporter's environment when env is nil.
+func expandFPMEnv(v string, env map[string]string) string {
+	return fpmEnvVar.ReplaceAllStringFunc(v, func(m string) string {
+		name := m[2 : len(m)-1]
+		if env == nil {
+			return os.Getenv(name)
+		}
+		return env[name]
+	})
+}
+
+func normalizeFPMBool(v string) string {
+	switch strings.ToLower(v) {
+	case "1", "on", "yes", "true":
+		return "yes"
+	case "", "0", "off", "no", "false", "none":
+		return "no"
+	}
+	return v
+}
+
+// HostPath returns path, as seen by a master whose filesystem root is root,
+// as seen by the exporter. An empty root is the exporter's own.
+func HostPath(root, path string) string {
+	if root == "" || path == "" {
+		return path
+	}
+	return filepath.Join(root, path)
+}
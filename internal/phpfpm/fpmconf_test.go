@@ -0,0 +1,205 @@
+package phpfpm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func TestParseFPMConfigFiles(t *testing.T) {
+	conf, err := ParseFPMConfigFiles("testdata/proc/2000/root", nil, "/", "/etc/php-fpm.conf")
+	if err != nil {
+		t.Fatalf("ParseFPMConfigFiles failed: %v", err)
+	}
+
+	if conf.Global["error_log"] != "/var/log/php-fpm.log" {
+		t.Errorf("Expected the global error_log, got %+v", conf.Global)
+	}
+	if _, ok := conf.Global["include"]; ok {
+		t.Error("Expected include to be followed rather than kept")
+	}
+	if conf.Pools["www"]["listen"] != "/run/php/www.sock" || conf.Pools["www"]["pm.status_path"] != "/status" {
+		t.Errorf("Expected the www pool from its include, got %+v", conf.Pools["www"])
+	}
+	if conf.Pools["api"]["pm.status_path"] != "/fpm-status" {
+		t.Errorf("Expected the quoted value without its comment, got %q", conf.Pools["api"]["pm.status_path"])
+	}
+}
+
+func TestParseFPMConfigFiles_Tree(t *testing.T) {
+	// The master's environment, not the exporter's
+	t.Setenv("PHPEEK_TEST_APP_ENV", "exporter")
+	env := map[string]string{"PHPEEK_TEST_APP_ENV": "production"}
+
+	conf, err := ParseFPMConfigFiles("testdata/fpmconf", env, "/", "/etc/php/8.2/fpm/php-fpm.conf")
+	if err != nil {
+		t.Fatalf("ParseFPMConfigFiles failed: %v", err)
+	}
+
+	wantGlobal := map[string]string{
+		"pid":       "/run/php/php8.2-fpm.pid",
+		"error_log": "/var/log/php8.2-fpm.log",
+		"daemonize": "no",     // off
+		"log_level": "notice", // default
+	}
+	for key, want := range wantGlobal {
+		if got := conf.Global[key]; got != want {
+			t.Errorf("Expected global %s = %q, got %q", key, want, got)
+		}
+	}
+
+	if len(conf.Pools) != 2 {
+		t.Fatalf("Expected the www and api pools, got %v", conf.Pools)
+	}
+
+	wantWWW := map[string]string{
+		"listen":                        "/run/php/php8.2-fpm-www.sock",
+		"slowlog":                       "/var/log/php-fpm/www.slow.log",
+		"pm.max_children":               "10", // amended by a later file
+		"catch_workers_output":          "yes",
+		"env[APP_ENV]":                  "production",
+		"php_admin_value[memory_limit]": "256M",
+		"php_flag[display_errors]":      "off",
+		"php_value[error_log]":          "/var/log/php/production.log",
+		"php_value[date.timezone]":      "Europe/Copenhagen",
+		"pm.max_requests":               "0",
+		"request_slowlog_timeout":       "0s",
+		"security.limit_extensions":     ".php .phar",
+	}
+	for key, want := range wantWWW {
+		if got := conf.Pools["www"][key]; got != want {
+			t.Errorf("Expected www %s = %q, got %q", key, want, got)
+		}
+	}
+
+	wantAPI := map[string]string{
+		"listen":           "127.0.0.1:9001",
+		"pm":               "static",
+		"pm.max_children":  "20",
+		"pm.status_path":   "/fpm-status",
+		"pm.status_listen": "/run/php/api-status.sock",
+	}
+	for key, want := range wantAPI {
+		if got := conf.Pools["api"][key]; got != want {
+			t.Errorf("Expected api %s = %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestParseFPMValue(t *testing.T) {
+	t.Setenv("PHPEEK_TEST_VALUE", "value")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"plain ; comment", "plain"},
+		{`"quoted ; not a comment"`, "quoted ; not a comment"},
+		{`'single'`, "single"},
+		{"${PHPEEK_TEST_VALUE}", "value"},
+		{`"a ${PHPEEK_TEST_VALUE}"`, "a value"},
+		{`'${PHPEEK_TEST_VALUE}'`, "${PHPEEK_TEST_VALUE}"},
+		{"${PHPEEK_TEST_UNSET}", ""},
+		{"$pool.sock", "$pool.sock"},
+	}
+
+	for _, tt := range tests {
+		if got := parseFPMValue(tt.input, nil); got != tt.expected {
+			t.Errorf("parseFPMValue(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+
+	// A master's environment replaces the exporter's entirely
+	env := map[string]string{"PHPEEK_TEST_OTHER": "other"}
+	if got := parseFPMValue("${PHPEEK_TEST_VALUE}-${PHPEEK_TEST_OTHER}", env); got != "-other" {
+		t.Errorf("Expected expansion from the given environment, got %q", got)
+	}
+}
+
+func TestParseFPMConfigFiles_RelativeInclude(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	// The layout of the official php:fpm image, prefix /usr/local
+	prefix := filepath.Join(t.TempDir(), "usr", "local")
+	if err := os.MkdirAll(filepath.Join(prefix, "etc", "php-fpm.d"), 0755); err != nil {
+		t.Fatalf("Failed to create php-fpm.d: %v", err)
+	}
+	files := map[string]string{
+		"etc/php-fpm.conf":       "include=etc/php-fpm.d/*.conf\n",
+		"etc/php-fpm.d/www.conf": "[www]\nlisten = 9000\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(prefix, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	path := filepath.Join(prefix, "etc", "php-fpm.conf")
+
+	conf, err := ParseFPMConfigFiles("", nil, fpmPrefix(nil, path), path)
+	if err != nil {
+		t.Fatalf("ParseFPMConfigFiles failed: %v", err)
+	}
+	if conf.Pools["www"]["listen"] != "9000" {
+		t.Errorf("Expected the pool from the include relative to the prefix, got %+v", conf.Pools)
+	}
+}
+
+func TestFPMPrefix(t *testing.T) {
+	tests := []struct {
+		args     []string
+		config   string
+		expected string
+	}{
+		{nil, "/usr/local/etc/php-fpm.conf", "/usr/local"},
+		{nil, "/opt/php/etc/fpm/php-fpm.conf", "/opt/php"},
+		{nil, "/srv/fpm/php-fpm.conf", "/srv/fpm"},
+		{[]string{"php-fpm: master process (/usr/local/etc/php-fpm.conf)"}, "/usr/local/etc/php-fpm.conf", "/usr/local"},
+		{[]string{"php-fpm", "-p", "/app", "-y", "/app/etc/php-fpm.conf"}, "/app/etc/php-fpm.conf", "/app"},
+		{[]string{"php-fpm", "-p/app"}, "/usr/local/etc/php-fpm.conf", "/app"},
+		{[]string{"php-fpm", "--prefix", "/app"}, "/usr/local/etc/php-fpm.conf", "/app"},
+		{[]string{"php-fpm", "--prefix=/app"}, "/usr/local/etc/php-fpm.conf", "/app"},
+	}
+
+	for _, tt := range tests {
+		if got := fpmPrefix(tt.args, tt.config); got != tt.expected {
+			t.Errorf("fpmPrefix(%q, %q): expected %q, got %q", tt.args, tt.config, tt.expected, got)
+		}
+	}
+}
+
+func TestParseFPMConfigFiles_Errors(t *testing.T) {
+	dir := t.TempDir()
+	loop := filepath.Join(dir, "loop.conf")
+	invalid := filepath.Join(dir, "invalid.conf")
+	os.WriteFile(loop, []byte("include = "+loop+"\n"), 0644)
+	os.WriteFile(invalid, []byte("[www]\nlisten\n"), 0644)
+
+	for _, path := range []string{filepath.Join(dir, "missing.conf"), loop, invalid} {
+		if _, err := ParseFPMConfigFiles("", nil, dir, path); err == nil {
+			t.Errorf("Expected an error for %s", filepath.Base(path))
+		}
+	}
+}
+
+func TestHostPath(t *testing.T) {
+	tests := []struct {
+		root     string
+		path     string
+		expected string
+	}{
+		{"", "/var/log/php-fpm.log", "/var/log/php-fpm.log"},
+		{"/proc/2000/root", "/var/log/php-fpm.log", "/proc/2000/root/var/log/php-fpm.log"},
+		{"/proc/2000/root", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := HostPath(tt.root, tt.path); got != tt.expected {
+			t.Errorf("HostPath(%q, %q) = %q, expected %q", tt.root, tt.path, got, tt.expected)
+		}
+	}
+}
@@ -1,66 +1,143 @@
 package phpfpm
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"github.com/gophpeek/fcgx"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
-	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	// phpInfoRefreshInterval bounds how long the output of a binary is
+	// reused while neither its master nor the binary itself changed.
+	phpInfoRefreshInterval = time.Hour
+	// phpInfoRetryInterval is how long a failed run is remembered.
+	phpInfoRetryInterval = time.Minute
+)
+
+// phpInfoKey identifies a PHP installation: the binary and the master that
+// runs it, which may have loaded an older binary than the one on disk.
+type phpInfoKey struct {
+	binary    string
+	masterPID int
+}
+
+// phpInfoEntry holds the output of a binary. Its fields are guarded by
+// phpInfoMu; run is held while the binary runs, so concurrent callers for
+// the same key wait for that run instead of starting their own, and callers
+// for other keys are not held up by it.
+type phpInfoEntry struct {
+	run     sync.Mutex
+	modTime time.Time // of the binary when it was run
+	fetched time.Time // zero until the first run
+	info    *Info
+	err     error
+}
+
 var (
-	phpInfoMu       sync.Mutex
-	cachedPHPInfo   *Info
-	phpInfoErr      error
-	lastPHPInfoTime time.Time
+	phpInfoMu    sync.Mutex
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
 )
 
 type Info struct {
 	Version    string
+	Sapi       string // empty when read from the binary
 	Extensions []string
 	Opcache    *OpcacheStatus
 }
 
-func GetPHPStats(ctx context.Context, cfg config.FPMPoolConfig) (*Info, error) {
+// ShortVersion returns the version number alone, also for the first line of
+// "php -v" output.
+func (i Info) ShortVersion() string {
+	fields := strings.Fields(i.Version)
+	if len(fields) >= 2 && fields[0] == "PHP" {
+		return fields[1]
+	}
+	return i.Version
+}
+
+// GetPHPStats runs the pool's binary with -v and -m. Results are cached per
+// binary and master PID (0 when unknown), so pools running different PHP
+// versions side by side are each reported correctly. The binary is run again
+// when its master restarts, when it is replaced on disk, and at least hourly.
+// A run cut short by ctx is not cached.
+func GetPHPStats(ctx context.Context, cfg config.FPMPoolConfig, masterPID int) (*Info, error) {
+	key := phpInfoKey{binary: cfg.Binary, masterPID: masterPID}
+	modTime := binaryModTime(cfg.Binary)
+
 	phpInfoMu.Lock()
-	defer phpInfoMu.Unlock()
+	// Entries of masters that are gone are dropped once they expire
+	for k, entry := range phpInfoCache {
+		if !entry.fetched.IsZero() && time.Since(entry.fetched) >= phpInfoRefreshInterval {
+			delete(phpInfoCache, k)
+		}
+	}
+	entry, ok := phpInfoCache[key]
+	if !ok {
+		entry = &phpInfoEntry{}
+		phpInfoCache[key] = entry
+	}
+	phpInfoMu.Unlock()
+
+	entry.run.Lock()
+	defer entry.run.Unlock()
 
-	if time.Since(lastPHPInfoTime) < time.Hour && cachedPHPInfo != nil {
-		return cachedPHPInfo, phpInfoErr
+	phpInfoMu.Lock()
+	if !entry.fetched.IsZero() && entry.modTime.Equal(modTime) {
+		age := time.Since(entry.fetched)
+		if entry.err == nil && age < phpInfoRefreshInterval {
+			phpInfoMu.Unlock()
+			return entry.info, nil
+		}
+		if entry.err != nil && age < phpInfoRetryInterval {
+			phpInfoMu.Unlock()
+			return nil, entry.err
+		}
 	}
+	phpInfoMu.Unlock()
 
-	version, err := getPHPVersion(cfg.Binary)
-	if err != nil {
-		phpInfoErr = err
+	info, err := runPHPInfo(ctx, cfg.Binary)
+	if ctx.Err() != nil {
 		return nil, err
 	}
 
-	ext, err := getPHPExtensions(cfg.Binary)
+	phpInfoMu.Lock()
+	entry.modTime = modTime
+	entry.fetched = time.Now()
+	entry.info = info
+	entry.err = err
+	phpInfoMu.Unlock()
+	return info, err
+}
+
+// runPHPInfo runs bin with -v and -m.
+func runPHPInfo(ctx context.Context, bin string) (*Info, error) {
+	version, err := getPHPVersion(ctx, bin)
 	if err != nil {
-		phpInfoErr = err
 		return nil, err
 	}
-
-	cachedPHPInfo = &Info{
-		Version:    version,
-		Extensions: ext,
+	ext, err := getPHPExtensions(ctx, bin)
+	if err != nil {
+		return nil, err
 	}
-	lastPHPInfoTime = time.Now()
-	phpInfoErr = nil
+	return &Info{Version: version, Extensions: ext}, nil
+}
 
-	return cachedPHPInfo, nil
+// binaryModTime returns the modification time of bin, or the zero time when
+// it cannot be read.
+func binaryModTime(bin string) time.Time {
+	info, err := os.Stat(bin)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
 }
 
-func getPHPVersion(bin string) (string, error) {
-	out, err := exec.Command(bin, "-v").Output()
+func getPHPVersion(ctx context.Context, bin string) (string, error) {
+	out, err := exec.CommandContext(ctx, bin, "-v").Output()
 	if err != nil {
 		return "", err
 	}
@@ -71,8 +148,8 @@ func getPHPVersion(bin string) (string, error) {
 	return "unknown", nil
 }
 
-func getPHPExtensions(bin string) ([]string, error) {
-	out, err := exec.Command(bin, "-m").Output()
+func getPHPExtensions(ctx context.Context, bin string) ([]string, error) {
+	out, err := exec.CommandContext(ctx, bin, "-m").Output()
 	if err != nil {
 		return nil, err
 	}
@@ -87,50 +164,12 @@ func getPHPExtensions(bin string) ([]string, error) {
 	return exts, nil
 }
 
-func getPHPConfig(ctx context.Context, cfg config.FPMPoolConfig) (map[string]interface{}, error) {
-	scheme, address, _, err := ParseAddress(cfg.StatusSocket, cfg.StatusPath)
-	if err != nil {
-		return nil, fmt.Errorf("invalid FPM socket address: %w", err)
-	}
-
-	client, err := fcgx.DialContext(ctx, scheme, address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial FastCGI: %w", err)
-	}
-	defer client.Close()
-
-	confScript := `<?php header("Content-Type: application/json"); echo json_encode(ini_get_all());`
-	tmpConfFile, err := os.CreateTemp("/tmp", "fpm-config-*.php")
-	defer os.Remove(tmpConfFile.Name())
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp PHP config script: %w", err)
-	}
-	if _, err := tmpConfFile.WriteString(confScript); err != nil {
-		tmpConfFile.Close()
-		return nil, fmt.Errorf("failed to write config PHP script: %w", err)
-	}
-	tmpConfFile.Close()
-
-	scriptPath := tmpConfFile.Name()
-	confEnv := map[string]string{
-		"SCRIPT_FILENAME": scriptPath,
-		"SCRIPT_NAME":     "/" + filepath.Base(scriptPath),
-		"SERVER_SOFTWARE": "phpeek-fpm-exporter",
-		"REMOTE_ADDR":     "127.0.0.1",
-	}
+var iniProbe = Probe{Name: "ini", Script: `<?php header("Content-Type: application/json"); echo json_encode(ini_get_all());`}
 
-	resp, err := client.Get(ctx, confEnv)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, resp.Body); err != nil {
-		return nil, fmt.Errorf("failed to read FastCGI config response: %w", err)
-	}
+func getPHPConfig(ctx context.Context, cfg config.FPMPoolConfig) (map[string]interface{}, error) {
 	var conf map[string]interface{}
-	if err := json.Unmarshal(buf.Bytes(), &conf); err != nil {
-		return nil, fmt.Errorf("FPM Config JSON parse failed: %w", err)
+	if err := iniProbe.Run(ctx, cfg, &conf); err != nil {
+		return nil, err
 	}
 	return conf, nil
 }
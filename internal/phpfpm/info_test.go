@@ -94,9 +94,7 @@ fi
 
 	// Clear cache to ensure fresh call
 	phpInfoMu.Lock()
-	cachedPHPInfo = nil
-	phpInfoErr = nil
-	lastPHPInfoTime = time.Time{}
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
 	phpInfoMu.Unlock()
 
 	// Create test config
@@ -105,7 +103,7 @@ fi
 	}
 
 	ctx := context.Background()
-	info, err := GetPHPStats(ctx, cfg)
+	info, err := GetPHPStats(ctx, cfg, 0)
 	if err != nil {
 		t.Fatalf("GetPHPStats failed: %v", err)
 	}
@@ -154,9 +152,7 @@ fi
 
 	// Clear cache
 	phpInfoMu.Lock()
-	cachedPHPInfo = nil
-	phpInfoErr = nil
-	lastPHPInfoTime = time.Time{}
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
 	phpInfoMu.Unlock()
 
 	cfg := config.FPMPoolConfig{
@@ -166,13 +162,13 @@ fi
 	ctx := context.Background()
 
 	// First call
-	info1, err := GetPHPStats(ctx, cfg)
+	info1, err := GetPHPStats(ctx, cfg, 0)
 	if err != nil {
 		t.Fatalf("First GetPHPStats failed: %v", err)
 	}
 
 	// Second call (should use cache)
-	info2, err := GetPHPStats(ctx, cfg)
+	info2, err := GetPHPStats(ctx, cfg, 0)
 	if err != nil {
 		t.Fatalf("Second GetPHPStats failed: %v", err)
 	}
@@ -184,20 +180,20 @@ fi
 
 	// Verify cache is working by checking time
 	phpInfoMu.Lock()
-	cacheTime := lastPHPInfoTime
+	entry := phpInfoCache[phpInfoKey{binary: mockPhpPath}]
 	phpInfoMu.Unlock()
 
-	if cacheTime.IsZero() {
-		t.Errorf("Expected cache time to be set")
+	if entry == nil || entry.fetched.IsZero() {
+		t.Fatalf("Expected cache time to be set")
 	}
 
 	// Test cache expiry by setting old time
 	phpInfoMu.Lock()
-	lastPHPInfoTime = time.Now().Add(-2 * time.Hour)
+	entry.fetched = time.Now().Add(-2 * time.Hour)
 	phpInfoMu.Unlock()
 
 	// Third call (should refresh cache)
-	info3, err := GetPHPStats(ctx, cfg)
+	info3, err := GetPHPStats(ctx, cfg, 0)
 	if err != nil {
 		t.Fatalf("Third GetPHPStats failed: %v", err)
 	}
@@ -266,7 +262,7 @@ EOF`
 				t.Fatalf("Failed to create mock PHP binary: %v", err)
 			}
 
-			result, err := getPHPVersion(mockPhpPath)
+			result, err := getPHPVersion(context.Background(), mockPhpPath)
 
 			if tt.expectError {
 				if err == nil {
@@ -361,7 +357,7 @@ EOF`
 				t.Fatalf("Failed to create mock PHP binary: %v", err)
 			}
 
-			result, err := getPHPExtensions(mockPhpPath)
+			result, err := getPHPExtensions(context.Background(), mockPhpPath)
 
 			if tt.expectError {
 				if err == nil {
@@ -392,9 +388,7 @@ func TestGetPHPStats_ErrorHandling(t *testing.T) {
 
 	// Clear cache
 	phpInfoMu.Lock()
-	cachedPHPInfo = nil
-	phpInfoErr = nil
-	lastPHPInfoTime = time.Time{}
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
 	phpInfoMu.Unlock()
 
 	// Test with non-existent binary
@@ -403,14 +397,14 @@ func TestGetPHPStats_ErrorHandling(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := GetPHPStats(ctx, cfg)
+	_, err := GetPHPStats(ctx, cfg, 0)
 	if err == nil {
 		t.Errorf("Expected error for non-existent binary")
 	}
 
 	// Test that error is cached
 	phpInfoMu.Lock()
-	cachedErr := phpInfoErr
+	cachedErr := phpInfoCache[phpInfoKey{binary: cfg.Binary}].err
 	phpInfoMu.Unlock()
 
 	if cachedErr == nil {
@@ -418,7 +412,7 @@ func TestGetPHPStats_ErrorHandling(t *testing.T) {
 	}
 
 	// Second call should return cached error
-	_, err2 := GetPHPStats(ctx, cfg)
+	_, err2 := GetPHPStats(ctx, cfg, 0)
 	if err2 == nil {
 		t.Errorf("Expected cached error on second call")
 	}
@@ -482,9 +476,7 @@ sleep 0.1
 
 	// Clear cache
 	phpInfoMu.Lock()
-	cachedPHPInfo = nil
-	phpInfoErr = nil
-	lastPHPInfoTime = time.Time{}
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
 	phpInfoMu.Unlock()
 
 	cfg := config.FPMPoolConfig{
@@ -499,7 +491,7 @@ sleep 0.1
 
 	for i := 0; i < 5; i++ {
 		go func() {
-			info, err := GetPHPStats(ctx, cfg)
+			info, err := GetPHPStats(ctx, cfg, 0)
 			if err != nil {
 				errors <- err
 				return
@@ -528,3 +520,169 @@ sleep 0.1
 		}
 	}
 }
+
+// writeMockPHP writes a binary that reports version and a single extension.
+func writeMockPHP(t *testing.T, path, version, extension string) {
+	t.Helper()
+
+	script := `#!/bin/bash
+if [[ "$1" == "-v" ]]; then
+    echo "PHP ` + version + ` (cli)"
+elif [[ "$1" == "-m" ]]; then
+    echo "[PHP Modules]"
+    echo "` + extension + `"
+fi
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create mock PHP binary: %v", err)
+	}
+}
+
+func TestGetPHPStats_PerBinary(t *testing.T) {
+	phpInfoMu.Lock()
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
+	phpInfoMu.Unlock()
+
+	tempDir := t.TempDir()
+	writeMockPHP(t, tempDir+"/php-fpm7.4", "7.4.33", "json")
+	writeMockPHP(t, tempDir+"/php-fpm8.3", "8.3.4", "random")
+
+	ctx := context.Background()
+	old, err := GetPHPStats(ctx, config.FPMPoolConfig{Binary: tempDir + "/php-fpm7.4"}, 100)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+	current, err := GetPHPStats(ctx, config.FPMPoolConfig{Binary: tempDir + "/php-fpm8.3"}, 200)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+
+	if old.ShortVersion() != "7.4.33" || old.Extensions[0] != "json" {
+		t.Errorf("Expected PHP 7.4.33 with json, got %+v", old)
+	}
+	if current.ShortVersion() != "8.3.4" || current.Extensions[0] != "random" {
+		t.Errorf("Expected PHP 8.3.4 with random, got %+v", current)
+	}
+}
+
+func TestGetPHPStats_Context(t *testing.T) {
+	phpInfoMu.Lock()
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
+	phpInfoMu.Unlock()
+
+	tempDir := t.TempDir()
+	slow := tempDir + "/php-fpm-slow"
+	if err := os.WriteFile(slow, []byte("#!/bin/bash\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatalf("Failed to create mock PHP binary: %v", err)
+	}
+	fast := tempDir + "/php-fpm"
+	writeMockPHP(t, fast, "8.3.4", "json")
+
+	// A hanging binary holds up neither the scrape nor other binaries
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := GetPHPStats(ctx, config.FPMPoolConfig{Binary: slow}, 0)
+		done <- err
+	}()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		phpInfoMu.Lock()
+		_, running := phpInfoCache[phpInfoKey{binary: slow}]
+		phpInfoMu.Unlock()
+		if running {
+			break
+		}
+	}
+
+	start := time.Now()
+	if _, err := GetPHPStats(context.Background(), config.FPMPoolConfig{Binary: fast}, 0); err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected another binary not to wait for the hanging one, took %s", elapsed)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the hanging binary to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the hanging binary to be killed with the context")
+	}
+
+	// A run cut short by the context is not remembered as a failure
+	phpInfoMu.Lock()
+	entry := phpInfoCache[phpInfoKey{binary: slow}]
+	phpInfoMu.Unlock()
+	if entry != nil && !entry.fetched.IsZero() {
+		t.Errorf("Expected the cancelled run not to be cached, got %+v", entry)
+	}
+}
+
+func TestGetPHPStats_Invalidation(t *testing.T) {
+	phpInfoMu.Lock()
+	phpInfoCache = make(map[phpInfoKey]*phpInfoEntry)
+	phpInfoMu.Unlock()
+
+	bin := t.TempDir() + "/php-fpm"
+	writeMockPHP(t, bin, "8.2.10", "json")
+	cfg := config.FPMPoolConfig{Binary: bin}
+	ctx := context.Background()
+
+	first, err := GetPHPStats(ctx, cfg, 100)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+
+	// Replacing the binary, e.g. by a package upgrade, runs it again
+	writeMockPHP(t, bin, "8.2.11", "json")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(bin, future, future); err != nil {
+		t.Fatalf("Failed to touch binary: %v", err)
+	}
+
+	upgraded, err := GetPHPStats(ctx, cfg, 100)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+	if upgraded == first || upgraded.ShortVersion() != "8.2.11" {
+		t.Errorf("Expected the replaced binary to be run again, got %+v", upgraded)
+	}
+
+	// A new master PID is run again as well
+	restarted, err := GetPHPStats(ctx, cfg, 101)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+	if restarted == upgraded {
+		t.Errorf("Expected a new master to be looked up again")
+	}
+
+	// The same master and binary are served from the cache
+	again, err := GetPHPStats(ctx, cfg, 101)
+	if err != nil {
+		t.Fatalf("GetPHPStats failed: %v", err)
+	}
+	if again != restarted {
+		t.Errorf("Expected the cached result for an unchanged master")
+	}
+}
+
+func TestInfo_ShortVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"PHP 8.2.10 (cli) (built: Sep  1 2023 10:30:45) (NTS)", "8.2.10"},
+		{"8.3.4", "8.3.4"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := (Info{Version: tt.version}).ShortVersion(); got != tt.want {
+			t.Errorf("ShortVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package phpfpm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+const (
+	// iniRefreshInterval bounds how long values are cached for a master that
+	// has not restarted; a restart always refetches them.
+	iniRefreshInterval = 5 * time.Minute
+	// iniRetryInterval is how long a failed probe is remembered.
+	iniRetryInterval = time.Minute
+)
+
+type iniCacheEntry struct {
+	startTime int64
+	fetched   time.Time
+	values    map[string]string
+	err       error
+}
+
+var (
+	iniCacheMu sync.Mutex
+	iniCache   = make(map[string]iniCacheEntry)
+)
+
+// GetPoolIni returns the effective value of each of cfg.IniDirectives as seen
+// by the pool's workers, which can differ from the CLI binary through
+// php_admin_value or a separate php.ini. Directives that are not known to the
+// pool, e.g. of an extension that is not loaded, are left out.
+//
+// Values are cached per pool until its master restarts (startTime changes).
+func GetPoolIni(ctx context.Context, cfg config.FPMPoolConfig, startTime int64) (map[string]string, error) {
+	if len(cfg.IniDirectives) == 0 {
+		return nil, nil
+	}
+
+	iniCacheMu.Lock()
+	entry, ok := iniCache[cfg.Socket]
+	iniCacheMu.Unlock()
+
+	if ok && entry.startTime == startTime {
+		age := time.Since(entry.fetched)
+		if entry.err == nil && age < iniRefreshInterval {
+			return entry.values, nil
+		}
+		if entry.err != nil && age < iniRetryInterval {
+			return nil, entry.err
+		}
+	}
+
+	entry = iniCacheEntry{startTime: startTime, fetched: time.Now()}
+	all, err := getPHPConfig(ctx, cfg)
+	if err != nil {
+		entry.err = fmt.Errorf("failed to read pool ini: %w", err)
+	} else {
+		entry.values = filterIni(all, cfg.IniDirectives)
+	}
+
+	iniCacheMu.Lock()
+	iniCache[cfg.Socket] = entry
+	iniCacheMu.Unlock()
+
+	return entry.values, entry.err
+}
+
+// filterIni picks the allowlisted directives from ini_get_all() output.
+func filterIni(all map[string]interface{}, directives []string) map[string]string {
+	values := make(map[string]string, len(directives))
+	for _, directive := range directives {
+		raw, ok := all[directive]
+		if !ok {
+			continue
+		}
+		values[directive] = iniValue(raw)
+	}
+	return values
+}
+
+// iniValue returns the local value of a directive, which includes the pool's
+// php_value and php_admin_value overrides. ini_get_all() reports each
+// directive as {global_value, local_value, access} unless details are off.
+func iniValue(raw interface{}) string {
+	if detail, ok := raw.(map[string]interface{}); ok {
+		raw = detail["local_value"]
+	}
+
+	switch v := raw.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "1"
+		}
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ParseIniNumber interprets an ini value the way PHP does for numeric and
+// boolean settings: "128M" is 134217728, "On" is 1 and an empty value is 0.
+// It reports false for values that are plain strings, such as opcache.jit=tracing.
+func ParseIniNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(value) {
+	case "", "off", "no", "false", "none":
+		return 0, true
+	case "on", "yes", "true":
+		return 1, true
+	}
+
+	multiplier := 1.0
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * multiplier, true
+}
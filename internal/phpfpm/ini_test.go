@@ -0,0 +1,174 @@
+package phpfpm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+)
+
+// iniGetAllJSON is trimmed ini_get_all() output of a pool that sets
+// php_admin_value[memory_limit] = 256M over the global 128M.
+const iniGetAllJSON = `{
+	"memory_limit": {"global_value": "128M", "local_value": "256M", "access": 7},
+	"max_execution_time": {"global_value": "30", "local_value": "30", "access": 7},
+	"opcache.jit": {"global_value": "tracing", "local_value": "tracing", "access": 7},
+	"opcache.validate_timestamps": {"global_value": "", "local_value": "", "access": 7},
+	"opcache.enable": {"global_value": "1", "local_value": "1", "access": 7},
+	"display_errors": {"global_value": "1", "local_value": "1", "access": 7}
+}`
+
+func iniPoolConfig(socket string) config.FPMPoolConfig {
+	return config.FPMPoolConfig{
+		Socket:        socket,
+		StatusSocket:  socket,
+		StatusPath:    "/status",
+		IniDirectives: []string{"memory_limit", "max_execution_time", "opcache.jit", "opcache.validate_timestamps", "apc.shm_size"},
+	}
+}
+
+func resetIniCache() {
+	iniCacheMu.Lock()
+	iniCache = make(map[string]iniCacheEntry)
+	iniCacheMu.Unlock()
+}
+
+func TestGetPoolIni(t *testing.T) {
+	resetIniCache()
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-type: application/json\r\n\r\n" + iniGetAllJSON
+	})
+	cfg := iniPoolConfig(fpm.Socket)
+	cfg.ProbeDir = t.TempDir()
+
+	values, err := GetPoolIni(context.Background(), cfg, 1700000000)
+	if err != nil {
+		t.Fatalf("GetPoolIni failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"memory_limit":                "256M",
+		"max_execution_time":          "30",
+		"opcache.jit":                 "tracing",
+		"opcache.validate_timestamps": "",
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %d directives, got %v", len(expected), values)
+	}
+	for directive, value := range expected {
+		if got, ok := values[directive]; !ok || got != value {
+			t.Errorf("Expected %s = %q, got %q", directive, value, got)
+		}
+	}
+
+	requests := fpm.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Expected a single probe request, got %d", len(requests))
+	}
+	if script := filepath.Base(requests[0]["SCRIPT_FILENAME"]); !strings.HasPrefix(script, "phpeek-") {
+		t.Errorf("Expected the probe script to be recognised as the exporter's own, got %s", script)
+	}
+
+	// Cached until the master restarts
+	if _, err := GetPoolIni(context.Background(), cfg, 1700000000); err != nil {
+		t.Fatalf("GetPoolIni failed: %v", err)
+	}
+	if n := len(fpm.Requests()); n != 1 {
+		t.Errorf("Expected cached values to be used, got %d requests", n)
+	}
+
+	if _, err := GetPoolIni(context.Background(), cfg, 1700000500); err != nil {
+		t.Fatalf("GetPoolIni failed: %v", err)
+	}
+	if n := len(fpm.Requests()); n != 2 {
+		t.Errorf("Expected a restart to refetch the values, got %d requests", n)
+	}
+}
+
+func TestGetPoolIni_Disabled(t *testing.T) {
+	resetIniCache()
+
+	cfg := iniPoolConfig("unix:///nonexistent/ini.sock")
+	cfg.IniDirectives = nil
+
+	values, err := GetPoolIni(context.Background(), cfg, 0)
+	if err != nil || values != nil {
+		t.Errorf("Expected no values and no error without directives, got %v (%v)", values, err)
+	}
+}
+
+func TestGetPoolIni_ErrorIsCached(t *testing.T) {
+	resetIniCache()
+
+	cfg := iniPoolConfig("unix:///nonexistent/ini.sock")
+
+	_, err := GetPoolIni(context.Background(), cfg, 0)
+	if err == nil {
+		t.Fatalf("Expected an error for an unreachable pool")
+	}
+
+	iniCacheMu.Lock()
+	entry, ok := iniCache[cfg.Socket]
+	iniCacheMu.Unlock()
+	if !ok || entry.err == nil {
+		t.Errorf("Expected the failure to be cached")
+	}
+}
+
+func TestIniValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      interface{}
+		expected string
+	}{
+		{"detailed", map[string]interface{}{"global_value": "128M", "local_value": "256M", "access": 7.0}, "256M"},
+		{"detailed null", map[string]interface{}{"global_value": nil, "local_value": nil}, ""},
+		{"flat string", "64M", "64M"},
+		{"number", 30.0, "30"},
+		{"true", true, "1"},
+		{"false", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := iniValue(tt.raw); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseIniNumber(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+		ok       bool
+	}{
+		{"128M", 128 << 20, true},
+		{"4096K", 4096 << 10, true},
+		{"4096k", 4096 << 10, true},
+		{"1G", 1 << 30, true},
+		{"30", 30, true},
+		{"-1", -1, true},
+		{"0.5", 0.5, true},
+		{"On", 1, true},
+		{"off", 0, true},
+		{"", 0, true},
+		{"1255", 1255, true},
+		{"tracing", 0, false},
+		{"/var/log/php.log", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := ParseIniNumber(tt.value)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("ParseIniNumber(%q) = %v, %v; expected %v, %v", tt.value, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
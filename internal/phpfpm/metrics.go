@@ -2,31 +2,40 @@ package phpfpm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
-	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/gophpeek/fcgx"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
 )
 
+const (
+	// DefaultPoolTimeout bounds a pool scrape when FPMPoolConfig.Timeout is unset.
+	DefaultPoolTimeout = 2 * time.Second
+	// DefaultMaxConcurrency bounds concurrent pool scrapes when unset.
+	DefaultMaxConcurrency = 8
+)
+
 type PoolProcess struct {
-	PID               int     `json:"pid"`
-	State             string  `json:"state"`
-	StartTime         int64   `json:"start time"`
-	StartSince        int64   `json:"start since"`
-	Requests          int64   `json:"requests"`
-	RequestDuration   int64   `json:"request duration"`
-	RequestMethod     string  `json:"request method"`
-	RequestURI        string  `json:"request uri"`
-	ContentLength     int64   `json:"content length"`
-	User              string  `json:"user"`
-	Script            string  `json:"script"`
-	LastRequestCPU    float64 `json:"last request cpu"`
-	LastRequestMemory float64 `json:"last request memory"`
-	CurrentRSS        int64   `json:"current_rss"`
+	PID               int        `json:"pid"`
+	State             string     `json:"state"`
+	StartTime         int64      `json:"start time"`
+	StartSince        int64      `json:"start since"`
+	Requests          int64      `json:"requests"`
+	RequestDuration   int64      `json:"request duration"`
+	RequestMethod     string     `json:"request method"`
+	RequestURI        string     `json:"request uri"`
+	ContentLength     int64      `json:"content length"`
+	User              string     `json:"user"`
+	Script            string     `json:"script"`
+	LastRequestCPU    float64    `json:"last request cpu"`
+	LastRequestMemory float64    `json:"last request memory"`
+	CurrentRSS        int64      `json:"current_rss"`
+	Proc              *ProcStats `json:"proc,omitempty"`
 }
 
 type Pool struct {
@@ -52,145 +61,139 @@ type Pool struct {
 	ProcessesMemory     *float64          `json:"processes_memory"`
 	Config              map[string]string `json:"config,omitempty"`
 	OpcacheStatus       OpcacheStatus     `json:"opcache_status,omitempty"`
+	Apcu                *ApcuStatus       `json:"apcu,omitempty"`    // nil when the probe failed
+	Runtime             *RuntimeStatus    `json:"runtime,omitempty"` // nil when the probe failed
 	PhpInfo             Info              `json:"php_info,omitempty"`
+	Ini                 map[string]string `json:"ini,omitempty"`        // effective php.ini values of the workers
+	MasterPID           int               `json:"master_pid,omitempty"` // 0 when not visible to the exporter
+	Ping                *PingResult       `json:"ping,omitempty"`       // nil when the pool sets no ping.path
+	// ProbeErrors holds the stage each failed probe of the poll stopped at, by
+	// one of ProbeNames. It is nil when the pool's probes are skipped.
+	ProbeErrors map[string]string `json:"probe_errors,omitempty"`
 }
 
+// ProbeNames are the probes collectProbes runs, as named in Pool.ProbeErrors.
+var ProbeNames = []string{"runtime", "opcache", "apcu", "ini"}
+
 type Result struct {
 	Timestamp time.Time
 	Pools     map[string]Pool
 	Global    map[string]string `json:"global_config,omitempty"`
+	// Name is the pool the result is attributed to when Pools is empty
+	// because the scrape failed or the pool has no status page.
+	Name string `json:"name,omitempty"`
+	// Errors holds the message of each stage that failed during the scrape.
+	Errors map[string]string `json:"errors,omitempty"`
+	// Root is the master's filesystem root as seen by the exporter, for
+	// reading paths from its config; see HostPath.
+	Root string `json:"root,omitempty"`
+	// Namespace and Pod locate a pool discovered in Kubernetes.
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	// StatusUnavailable is why the pool was not scraped, see
+	// StatusUnavailable; Pools is empty then.
+	StatusUnavailable string `json:"status_unavailable,omitempty"`
+	// StatusHint holds the php-fpm.conf lines the pool is missing for a
+	// status page on its own socket, see StatusConfigHint.
+	StatusHint string `json:"status_hint,omitempty"`
+	// Ping is the pool's ping when Pools is empty; see Pool.Ping otherwise.
+	Ping *PingResult `json:"ping,omitempty"`
 }
 
+// GetMetrics scrapes all configured pools concurrently, at most
+// cfg.PHPFpm.MaxConcurrency at a time, each bounded by its own timeout.
+// Every pool produces a result; failed pools are reported via NewFailedResult.
 func GetMetrics(ctx context.Context, cfg *config.Config) (map[string]*Result, error) {
-	results := map[string]*Result{}
-
-	for _, poolCfg := range cfg.PHPFpm.Pools {
-		result := &Result{
-			Timestamp: time.Now(),
-			Pools:     make(map[string]Pool),
-			Global:    make(map[string]string),
-		}
-
-		scheme, address, path, err := ParseAddress(poolCfg.StatusSocket, poolCfg.StatusPath)
-		if err != nil {
-			logging.L().Error("PHPeek Invalid FPM socket address: %v", slog.Any("err", err))
-			continue
-		}
-
-		dialCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-		logging.L().Debug("PHPeek Dialing FastCGI", "scheme", scheme, "address", address, "status_path", path)
-		client, err := fcgx.DialContext(dialCtx, scheme, address)
-		cancel()
-		if err != nil {
-			logging.L().Debug("PHPeek failed to dial FastCGI", "error", err)
-			continue
-		}
-		defer client.Close()
-
-		env := map[string]string{
-			"SCRIPT_FILENAME": path,
-			"SCRIPT_NAME":     path,
-			"SERVER_SOFTWARE": "phpeek-fpm-exporter",
-			"REMOTE_ADDR":     "127.0.0.1",
-			"QUERY_STRING":    "json&full",
-		}
-		logging.L().Debug("PHPeek Sending FCGI request", "env", env)
-
-		resp, err := client.Get(ctx, env)
-		if err != nil {
-			logging.L().Debug("PHPeek fcgi GET failed", "error", err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		var pool Pool
-		err = fcgx.ReadJSON(resp, &pool)
+	pools := cfg.PHPFpm.Pools
+	scraped := make([]*Result, len(pools))
 
-		if err != nil {
-			logging.L().Error("PHPeek failed to parse FPM JSON: %v", slog.Any("err", err))
-			continue
-		}
-
-		pool.Address = address
-		pool.Path = path
+	workers := cfg.PHPFpm.MaxConcurrency
+	if workers <= 0 {
+		workers = DefaultMaxConcurrency
+	}
+	sem := make(chan struct{}, workers)
 
-		if conf, err := ParseFPMConfig(poolCfg.Binary, poolCfg.ConfigPath); err == nil {
-			for section, values := range conf.Pools {
-				if strings.EqualFold(section, pool.Name) {
-					pool.Config = values
-				}
-			}
-			for k, v := range conf.Global {
-				result.Global[k] = v
-			}
-		}
+	var wg sync.WaitGroup
+	for i, poolCfg := range pools {
+		wg.Add(1)
+		go func(i int, poolCfg config.FPMPoolConfig) {
+			defer wg.Done()
 
-		// Process counting and CPU/mem parsing from actual process list
-		var totalCPU, totalMem float64
-		var count int
-		var activeCount, idleCount int64
-
-		for _, proc := range pool.Processes {
-			// Count processes by state
-			switch strings.ToLower(proc.State) {
-			case "running", "reading headers", "info", "finishing", "ending":
-				activeCount++
-			case "idle":
-				idleCount++
-			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-			// CPU/memory calculation (exclude status and opcache requests)
-			if !strings.HasPrefix(proc.RequestURI, poolCfg.StatusPath) &&
-				!strings.HasPrefix(proc.RequestURI, "/opcache-status-") {
+			poolCtx, cancel := context.WithTimeout(ctx, PoolTimeout(poolCfg))
+			defer cancel()
 
-				totalCPU += float64(proc.LastRequestCPU)
-				totalMem += float64(proc.LastRequestMemory)
-				count++
+			result, err := GetMetricsForPool(poolCtx, poolCfg)
+			if err != nil {
+				logging.L().Debug("PHPeek failed to scrape FPM pool", "socket", poolCfg.Socket, "error", err)
+				result = NewFailedResult(poolCfg, err)
 			}
-		}
-
-		// Recalculate process counts from actual process list
-		pool.ActiveProcesses = activeCount
-		pool.IdleProcesses = idleCount
-		pool.TotalProcesses = int64(len(pool.Processes))
+			scraped[i] = result
+		}(i, poolCfg)
+	}
+	wg.Wait()
 
-		if count > 0 {
-			pool.ProcessesCpu = ptr(totalCPU / float64(count))
-			pool.ProcessesMemory = ptr(totalMem / float64(count))
-		}
+	// Merge in configuration order so duplicate sockets resolve the same way
+	// on every scrape.
+	results := make(map[string]*Result, len(pools))
+	for i, poolCfg := range pools {
+		results[poolCfg.Socket] = scraped[i]
+	}
 
-		phpStatus, err := GetPHPStats(ctx, poolCfg)
-		if err == nil && phpStatus != nil {
-			pool.PhpInfo = *phpStatus
-		} else {
-			logging.L().Debug("PHPeek failed to get PHP info", "error", err)
-		}
+	return results, nil
+}
 
-		opcacheStatus, err := GetOpcacheStatus(ctx, poolCfg)
-		if err == nil && opcacheStatus != nil {
-			pool.OpcacheStatus = *opcacheStatus
-		} else {
-			logging.L().Debug("PHPeek failed to get Opcache info", "error", err)
-		}
+// PoolTimeout returns the configured scrape timeout of a pool, or
+// DefaultPoolTimeout when none is set.
+func PoolTimeout(poolCfg config.FPMPoolConfig) time.Duration {
+	if poolCfg.Timeout > 0 {
+		return poolCfg.Timeout
+	}
+	return DefaultPoolTimeout
+}
 
-		result.Pools[pool.Name] = pool
-		results[poolCfg.Socket] = result
+// GetMetricsForPool scrapes a single pool: its ping.path, the status page, its
+// parsed FPM config, PHP info and opcache status. Failures are returned as
+// *ScrapeError, carrying the ping, and counted in ScrapeFailures. A pool
+// without a status page is not scraped; its result only carries the reason,
+// a config hint and the ping.
+func GetMetricsForPool(ctx context.Context, poolCfg config.FPMPoolConfig) (*Result, error) {
+	result := &Result{
+		Timestamp: time.Now(),
+		Pools:     make(map[string]Pool),
+		Global:    make(map[string]string),
+		Errors:    make(map[string]string),
+		Root:      poolCfg.Root,
+		Namespace: poolCfg.Namespace,
+		Pod:       poolCfg.Pod,
 	}
 
-	return results, nil
-}
+	// The ping is cheap and independent of the status page, so a pool that
+	// is down or has no status page still reports whether it answers
+	pingCfg := pingConfig(poolCfg)
+	ping := PingPool(ctx, poolCfg, pingCfg)
+	fail := func(stage string, err error) (*Result, error) {
+		scrapeErr := scrapeFailed(poolCfg, stage, err)
+		scrapeErr.Ping = ping
+		return nil, scrapeErr
+	}
 
-func GetMetricsForPool(ctx context.Context, pool config.FPMPoolConfig) (*Result, error) {
-	scheme, address, path, err := ParseAddress(pool.StatusSocket, pool.StatusPath)
-	if err != nil {
-		return nil, fmt.Errorf("invalid FPM socket address: %w", err)
+	reason := StatusUnavailable(poolCfg)
+	result.StatusHint = StatusConfigHint(poolCfg)
+	logStatusHint(poolCfg, reason, result.StatusHint)
+	if reason != "" {
+		result.Name = PoolName(poolCfg)
+		result.StatusUnavailable = reason
+		result.Ping = ping
+		return result, nil
 	}
 
-	client, err := fcgx.DialContext(ctx, scheme, address)
+	scheme, address, path, err := ParseAddress(poolCfg.StatusSocket, poolCfg.StatusPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial FastCGI: %w", err)
+		return fail(StageConfig, fmt.Errorf("invalid FPM socket address: %w", err))
 	}
-	defer client.Close()
 
 	env := map[string]string{
 		"SCRIPT_FILENAME": path,
@@ -199,39 +202,191 @@ func GetMetricsForPool(ctx context.Context, pool config.FPMPoolConfig) (*Result,
 		"REMOTE_ADDR":     "127.0.0.1",
 		"QUERY_STRING":    "json&full",
 	}
+	logging.L().Debug("PHPeek Sending FCGI request", "scheme", scheme, "address", address, "env", env)
 
-	resp, err := client.Get(ctx, env)
+	resp, err := poolGet(ctx, poolCfg, poolCfg.StatusSocket, env)
+	var dialErr *dialError
+	if errors.As(err, &dialErr) {
+		return fail(StageDial, fmt.Errorf("failed to dial FastCGI: %w", err))
+	}
 	if err != nil {
-		return nil, err
+		return fail(StageRequest, fmt.Errorf("fcgi GET failed: %w", err))
 	}
-	defer resp.Body.Close()
 
-	var poolData Pool
-	err = fcgx.ReadJSON(resp, &poolData)
+	var pool Pool
+	if err := json.Unmarshal(resp.Body, &pool); err != nil {
+		return fail(StageParse, fmt.Errorf("failed to parse FPM JSON: %w", err))
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse FPM JSON: %w", err)
+	pool.Address = address
+	pool.Path = path
+	rememberPoolName(poolCfg, pool.Name)
+
+	// The PIDs of a pool in another PID namespace mean nothing in our /proc
+	local := localProcesses(poolCfg)
+
+	// A restarted master may run with a changed configuration. A transient
+	// scrape has no earlier one to compare with.
+	if local {
+		pool.MasterPID = FindMasterPID(pool.Processes)
+	}
+	if !poolCfg.Transient {
+		if reason := detectRestart(poolCfg.Socket, pool.Name, pool.StartTime, pool.MasterPID); reason != "" {
+			logging.L().Info("PHPeek detected FPM master restart", "socket", poolCfg.Socket, "pool", pool.Name, "reason", reason)
+			InvalidateFPMConfig(poolCfg.Binary, poolCfg.ConfigPath, poolCfg.Root)
+		}
 	}
 
-	// Recalculate process counts from actual process list
+	// Without a binary and config path there is nothing to parse; a failure
+	// here degrades the result but the pool itself is still up.
+	if poolCfg.Binary != "" && poolCfg.ConfigPath != "" {
+		conf, err := ReadFPMConfig(poolCfg.Binary, poolCfg.ConfigPath, poolCfg.Root, pool.MasterPID)
+		if err != nil {
+			recordScrapeFailure(poolCfg, StageConfig)
+			result.Errors[StageConfig] = err.Error()
+		} else {
+			for section, values := range conf.Pools {
+				if strings.EqualFold(section, pool.Name) {
+					pool.Config = values
+				}
+			}
+			for k, v := range conf.Global {
+				result.Global[k] = v
+			}
+		}
+	}
+
+	// Probe scripts of a chrooted pool must be placed inside its chroot
+	if poolCfg.Chroot == "" {
+		poolCfg.Chroot = pool.Config["chroot"]
+	}
+
+	// On the first poll of a pool whose ping.path is only in its FPM config,
+	// the config was not known before the status page
+	if pingCfg == nil {
+		pingCfg = pool.Config
+		ping = PingPool(ctx, poolCfg, pingCfg)
+	}
+	// A failed ping does not fail the scrape, it is exported on its own
+	pool.Ping = ping
+	if pool.Ping != nil && !pool.Ping.Success {
+		logging.L().Debug("PHPeek FPM ping failed", "socket", poolCfg.Socket, "pool", pool.Name, "error", pool.Ping.Error)
+	}
+
+	// Process counting and CPU/mem parsing from actual process list
+	var totalCPU, totalMem float64
+	var count int
 	var activeCount, idleCount int64
-	for _, proc := range poolData.Processes {
+
+	for _, proc := range pool.Processes {
+		// Count processes by state
 		switch strings.ToLower(proc.State) {
 		case "running", "reading headers", "info", "finishing", "ending":
 			activeCount++
 		case "idle":
 			idleCount++
 		}
+
+		// CPU/memory calculation (exclude status and opcache requests)
+		if !IsExporterRequest(proc, poolCfg.StatusPath, pingCfg["ping.path"]) {
+			totalCPU += float64(proc.LastRequestCPU)
+			totalMem += float64(proc.LastRequestMemory)
+			count++
+		}
 	}
 
-	poolData.ActiveProcesses = activeCount
-	poolData.IdleProcesses = idleCount
-	poolData.TotalProcesses = int64(len(poolData.Processes))
+	// OS-level footprint; LastRequestMemory is only the peak of one request
+	if local {
+		for i := range pool.Processes {
+			stats, err := ReadProcStats(pool.Processes[i].PID)
+			if err != nil {
+				continue
+			}
+			pool.Processes[i].Proc = stats
+			pool.Processes[i].CurrentRSS = stats.RSS
+		}
+	}
 
-	return &Result{
-		Timestamp: time.Now(),
-		Pools:     map[string]Pool{poolData.Name: poolData},
-	}, nil
+	// Recalculate process counts from actual process list
+	pool.ActiveProcesses = activeCount
+	pool.IdleProcesses = idleCount
+	pool.TotalProcesses = int64(len(pool.Processes))
+
+	if count > 0 {
+		pool.ProcessesCpu = ptr(totalCPU / float64(count))
+		pool.ProcessesMemory = ptr(totalMem / float64(count))
+	}
+
+	if !poolCfg.SkipProbes {
+		collectProbes(ctx, poolCfg, &pool)
+	} else if poolCfg.Binary != "" {
+		// Without the runtime probe, PHP info can only come from the binary
+		if phpStatus, err := GetPHPStats(ctx, poolCfg, pool.MasterPID); err == nil && phpStatus != nil {
+			pool.PhpInfo = *phpStatus
+		}
+	}
+
+	result.Pools[pool.Name] = pool
+
+	return result, nil
+}
+
+// collectProbes fills in what only the pool's workers can tell: the PHP
+// runtime, opcache, APCu and ini values. A failed probe leaves its part out
+// and is recorded in pool.ProbeErrors.
+func collectProbes(ctx context.Context, poolCfg config.FPMPoolConfig, pool *Pool) {
+	pool.ProbeErrors = make(map[string]string)
+	failed := func(probe string, err error) {
+		stage := probeStage(err)
+		pool.ProbeErrors[probe] = stage
+		if stage == ProbeStageInstall {
+			warnProbeInstall(poolCfg, err)
+		}
+	}
+
+	// Prefer what the running master reports over the binary on disk
+	runtimeStatus, err := GetRuntimeStatus(ctx, poolCfg)
+	if err == nil {
+		pool.Runtime = runtimeStatus
+		pool.PhpInfo = Info{
+			Version:    runtimeStatus.Version,
+			Sapi:       runtimeStatus.Sapi,
+			Extensions: runtimeStatus.Extensions,
+		}
+	} else {
+		failed("runtime", err)
+		logging.L().Debug("PHPeek failed to get runtime info, falling back to the binary", "error", err)
+		phpStatus, err := GetPHPStats(ctx, poolCfg, pool.MasterPID)
+		if err == nil && phpStatus != nil {
+			pool.PhpInfo = *phpStatus
+		} else {
+			logging.L().Debug("PHPeek failed to get PHP info", "error", err)
+		}
+	}
+
+	opcacheStatus, err := GetOpcacheStatus(ctx, poolCfg)
+	if err == nil && opcacheStatus != nil {
+		pool.OpcacheStatus = *opcacheStatus
+	} else {
+		failed("opcache", err)
+		logging.L().Debug("PHPeek failed to get Opcache info", "error", err)
+	}
+
+	apcuStatus, err := GetApcuStatus(ctx, poolCfg)
+	if err == nil {
+		pool.Apcu = apcuStatus
+	} else {
+		failed("apcu", err)
+		logging.L().Debug("PHPeek failed to get APCu info", "error", err)
+	}
+
+	ini, err := GetPoolIni(ctx, poolCfg, pool.StartTime)
+	if err == nil {
+		pool.Ini = ini
+	} else {
+		failed("ini", err)
+		logging.L().Debug("PHPeek failed to get pool ini values", "error", err)
+	}
 }
 
 func ptr[T any](v T) *T {
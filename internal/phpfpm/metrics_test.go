@@ -2,11 +2,16 @@ package phpfpm
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 )
 
@@ -238,9 +243,12 @@ func TestGetMetrics_ErrorHandling(t *testing.T) {
 		t.Errorf("Expected no error (should continue on individual pool failures), got: %v", err)
 	}
 
-	// Should return empty results since all pools failed
-	if len(results) != 0 {
-		t.Errorf("Expected empty results with invalid config, got %d", len(results))
+	// Failed pools are reported instead of dropped
+	if len(results) != 1 {
+		t.Fatalf("Expected one failed result with invalid config, got %d", len(results))
+	}
+	if failed := results["invalid-socket"]; len(failed.Pools) != 0 || failed.Errors[StageConfig] == "" {
+		t.Errorf("Expected invalid socket to fail at config stage, got %+v", failed)
 	}
 
 	// Test with non-existent socket
@@ -262,9 +270,12 @@ func TestGetMetrics_ErrorHandling(t *testing.T) {
 		t.Errorf("Expected no error (should continue on connection failures), got: %v", err)
 	}
 
-	// Should return empty results since connection failed
-	if len(results) != 0 {
-		t.Errorf("Expected empty results with non-existent socket, got %d", len(results))
+	// Should report the pool as failed at the dial stage
+	if len(results) != 1 {
+		t.Fatalf("Expected one failed result with non-existent socket, got %d", len(results))
+	}
+	if failed := results["non-existent"]; len(failed.Pools) != 0 || failed.Errors[StageDial] == "" {
+		t.Errorf("Expected non-existent socket to fail at dial stage, got %+v", failed)
 	}
 }
 
@@ -710,3 +721,272 @@ func TestPool_ProcessStateRecognition(t *testing.T) {
 		})
 	}
 }
+
+// hangingListener accepts FastCGI connections but never answers, simulating a
+// pool whose workers are all stuck.
+func hangingListener(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	return "tcp://" + ln.Addr().String()
+}
+
+func TestGetMetrics_ConcurrentWithPerPoolTimeout(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	var pools []config.FPMPoolConfig
+	for i := 0; i < 4; i++ {
+		socket := hangingListener(t)
+		pools = append(pools, config.FPMPoolConfig{
+			Socket:       socket,
+			StatusSocket: socket,
+			StatusPath:   "/status",
+			Timeout:      300 * time.Millisecond,
+		})
+	}
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			MaxConcurrency: 4,
+			Pools:          pools,
+		},
+	}
+
+	start := time.Now()
+	results, err := GetMetrics(context.Background(), cfg)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Serial scraping would take 4 * 300ms
+	if elapsed > 900*time.Millisecond {
+		t.Errorf("Expected pools to be scraped concurrently, took %v", elapsed)
+	}
+
+	if len(results) != len(pools) {
+		t.Fatalf("Expected %d results, got %d", len(pools), len(results))
+	}
+
+	for _, pool := range pools {
+		result, ok := results[pool.Socket]
+		if !ok {
+			t.Errorf("Expected result for %s", pool.Socket)
+			continue
+		}
+		if len(result.Pools) != 0 || len(result.Errors) == 0 {
+			t.Errorf("Expected %s to be reported as failed, got %+v", pool.Socket, result)
+		}
+	}
+}
+
+func TestGetMetrics_BoundedConcurrency(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	var pools []config.FPMPoolConfig
+	for i := 0; i < 4; i++ {
+		socket := hangingListener(t)
+		pools = append(pools, config.FPMPoolConfig{
+			Socket:       socket,
+			StatusSocket: socket,
+			StatusPath:   "/status",
+			Timeout:      200 * time.Millisecond,
+		})
+	}
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			MaxConcurrency: 1,
+			Pools:          pools,
+		},
+	}
+
+	start := time.Now()
+	if _, err := GetMetrics(context.Background(), cfg); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// With a single worker the pools time out one after another
+	if elapsed := time.Since(start); elapsed < 700*time.Millisecond {
+		t.Errorf("Expected a single worker to scrape pools serially, took %v", elapsed)
+	}
+}
+
+func TestGetMetrics_DuplicateSocketsAreDeterministic(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Pools: []config.FPMPoolConfig{
+				{Name: "first", Socket: "shared", StatusSocket: "invalid://first"},
+				{Name: "second", Socket: "shared", StatusSocket: "invalid://second"},
+			},
+		},
+	}
+
+	for i := 0; i < 10; i++ {
+		results, _ := GetMetrics(context.Background(), cfg)
+		if results["shared"].Name != "second" {
+			t.Fatalf("Expected the last configured pool to win, got %q", results["shared"].Name)
+		}
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	if got := PoolTimeout(config.FPMPoolConfig{}); got != DefaultPoolTimeout {
+		t.Errorf("Expected default timeout %v, got %v", DefaultPoolTimeout, got)
+	}
+	if got := PoolTimeout(config.FPMPoolConfig{Timeout: 5 * time.Second}); got != 5*time.Second {
+		t.Errorf("Expected configured timeout to be used, got %v", got)
+	}
+}
+
+func TestGetMetricsForPool_RuntimeFromPool(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		switch params["SCRIPT_NAME"] {
+		case "/status":
+			return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "process manager": "static", "start time": 1700000000, "processes": []}`
+		case "/phpeek-runtime.php":
+			return "Content-Type: application/json\r\n\r\n" + runtimeJSON
+		}
+		return "Status: 404 Not Found\r\n\r\nFile not found."
+	})
+
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		ProbeDir:     t.TempDir(),
+		Binary:       "/nonexistent/php-fpm",
+	}
+
+	result, err := GetMetricsForPool(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+
+	pool, ok := result.Pools["www"]
+	if !ok {
+		t.Fatalf("Expected pool www, got %v", result.Pools)
+	}
+	if pool.PhpInfo.Version != "8.3.4" || pool.PhpInfo.Sapi != "fpm-fcgi" {
+		t.Errorf("Expected the version reported by the pool, got %+v", pool.PhpInfo)
+	}
+	if pool.Runtime == nil || pool.Runtime.RealpathCacheEntries != 120 {
+		t.Errorf("Expected the runtime status of the pool, got %+v", pool.Runtime)
+	}
+	if pool.Apcu != nil {
+		t.Errorf("Expected no APCu status when the probe fails, got %+v", pool.Apcu)
+	}
+}
+
+func TestGetMetricsForPool_SkipProbes(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "process manager": "static", "processes": []}`
+	})
+
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		ProbeDir:     t.TempDir(),
+		SkipProbes:   true,
+	}
+
+	result, err := GetMetricsForPool(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+	if _, ok := result.Pools["www"]; !ok {
+		t.Fatalf("Expected pool www, got %v", result.Pools)
+	}
+	if requests := fpm.Requests(); len(requests) != 1 || requests[0]["SCRIPT_NAME"] != "/status" {
+		t.Errorf("Expected only the status page to be requested, got %d requests", len(requests))
+	}
+}
+
+func TestGetMetricsForPool_RestartRereadsConfig(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	tempDir := t.TempDir()
+	binary := tempDir + "/php-fpm"
+	childrenPath := tempDir + "/max_children"
+	mockScript := `#!/bin/bash
+echo "[www]"
+echo "pm.max_children = $(cat ` + childrenPath + `)"
+`
+	if err := os.WriteFile(binary, []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary: %v", err)
+	}
+	os.WriteFile(childrenPath, []byte("5"), 0644)
+
+	var startTime atomic.Int64
+	startTime.Store(1700000000)
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		if params["SCRIPT_NAME"] != "/status" {
+			return "Status: 404 Not Found\r\n\r\nFile not found."
+		}
+		return "Content-Type: application/json\r\n\r\n" + fmt.Sprintf(`{"pool": "www", "start time": %d, "processes": []}`, startTime.Load())
+	})
+
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		ProbeDir:     tempDir,
+		Binary:       binary,
+		ConfigPath:   tempDir + "/php-fpm.conf",
+	}
+	maxChildren := func() string {
+		t.Helper()
+		result, err := GetMetricsForPool(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("GetMetricsForPool failed: %v", err)
+		}
+		return result.Pools["www"].Config["pm.max_children"]
+	}
+
+	if got := maxChildren(); got != "5" {
+		t.Fatalf("Expected pm.max_children 5, got %q", got)
+	}
+
+	// The file changes, but the running master still uses the old value
+	os.WriteFile(childrenPath, []byte("10"), 0644)
+	if got := maxChildren(); got != "5" {
+		t.Errorf("Expected the config to be kept until the master restarts, got %q", got)
+	}
+
+	startTime.Store(1700000600)
+	if got := maxChildren(); got != "10" {
+		t.Errorf("Expected the config to be read again after the restart, got %q", got)
+	}
+	if n := MasterRestarts()[RestartKey{Socket: fpm.Socket, Pool: "www", Reason: RestartStartTime}]; n != 1 {
+		t.Errorf("Expected one restart, got %d", n)
+	}
+}
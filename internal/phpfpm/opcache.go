@@ -4,16 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/gophpeek/fcgx"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
-	"os"
-	"path/filepath"
+	"sort"
+	"time"
 )
 
 type OpcacheStatus struct {
-	Enabled     bool   `json:"opcache_enabled"`
-	MemoryUsage Memory `json:"memory_usage"`
-	Statistics  Stats  `json:"opcache_statistics"`
+	Enabled           bool            `json:"opcache_enabled"`
+	CacheFull         bool            `json:"cache_full"`
+	RestartPending    bool            `json:"restart_pending"`
+	RestartInProgress bool            `json:"restart_in_progress"`
+	MemoryUsage       Memory          `json:"memory_usage"`
+	InternedStrings   InternedStrings `json:"interned_strings_usage"`
+	Statistics        Stats           `json:"opcache_statistics"`
+	Preload           *PreloadStats   `json:"preload_statistics,omitempty"`
+	JIT               *JIT            `json:"jit,omitempty"`
+	TopScripts        []OpcacheScript `json:"top_scripts,omitempty"`
 }
 
 type Memory struct {
@@ -23,8 +29,17 @@ type Memory struct {
 	CurrentWastedPct float64 `json:"current_wasted_percentage"`
 }
 
+type InternedStrings struct {
+	BufferSize      uint64 `json:"buffer_size"`
+	UsedMemory      uint64 `json:"used_memory"`
+	FreeMemory      uint64 `json:"free_memory"`
+	NumberOfStrings uint64 `json:"number_of_strings"`
+}
+
 type Stats struct {
 	NumCachedScripts uint64  `json:"num_cached_scripts"`
+	NumCachedKeys    uint64  `json:"num_cached_keys"`
+	MaxCachedKeys    uint64  `json:"max_cached_keys"`
 	Hits             uint64  `json:"hits"`
 	Misses           uint64  `json:"misses"`
 	BlacklistMisses  uint64  `json:"blacklist_misses"`
@@ -32,57 +47,163 @@ type Stats struct {
 	HashRestarts     uint64  `json:"hash_restarts"`
 	ManualRestarts   uint64  `json:"manual_restarts"`
 	HitRate          float64 `json:"opcache_hit_rate"`
+	StartTime        int64   `json:"start_time"`
+	LastRestartTime  int64   `json:"last_restart_time"` // 0 when never restarted
 }
 
-func GetOpcacheStatus(ctx context.Context, cfg config.FPMPoolConfig) (*OpcacheStatus, error) {
-	tmpPath := "/tmp/phpeek-opcache-status.php"
-	if _, err := os.Stat(tmpPath); os.IsNotExist(err) {
-		scriptContent := `<?php
-error_reporting(0);
-ini_set('display_errors', 0);
-header("Status: 200 OK");
-header("Content-Type: application/json");
-echo json_encode(opcache_get_status());
-exit;`
-		if err := os.WriteFile(tmpPath, []byte(scriptContent), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write PHP script: %w", err)
+// PreloadStats summarizes opcache.preload. Only the number of preloaded
+// scripts, functions and classes is kept, not the lists themselves.
+type PreloadStats struct {
+	MemoryConsumption uint64 `json:"memory_consumption"`
+	Scripts           int    `json:"scripts"`
+	Functions         int    `json:"functions"`
+	Classes           int    `json:"classes"`
+}
+
+// UnmarshalJSON accepts both the lists reported by PHP and plain counts, as
+// PreloadStats encodes to on /json, so the exporter's own JSON decodes too.
+func (p *PreloadStats) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MemoryConsumption uint64          `json:"memory_consumption"`
+		Scripts           json.RawMessage `json:"scripts"`
+		Functions         json.RawMessage `json:"functions"`
+		Classes           json.RawMessage `json:"classes"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.MemoryConsumption = raw.MemoryConsumption
+	for _, field := range []struct {
+		raw   json.RawMessage
+		count *int
+	}{{raw.Scripts, &p.Scripts}, {raw.Functions, &p.Functions}, {raw.Classes, &p.Classes}} {
+		n, err := countOrLen(field.raw)
+		if err != nil {
+			return err
 		}
+		*field.count = n
 	}
+	return nil
+}
 
-	scheme, address, _, err := ParseAddress(cfg.StatusSocket, "")
-	if err != nil {
-		return nil, fmt.Errorf("invalid socket: %w", err)
+// countOrLen returns the length of a JSON list, or the value of a number.
+func countOrLen(raw json.RawMessage) (int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
 	}
+	if raw[0] == '[' {
+		var list []json.RawMessage
+		err := json.Unmarshal(raw, &list)
+		return len(list), err
+	}
+	var n int
+	err := json.Unmarshal(raw, &n)
+	return n, err
+}
 
-	client, err := fcgx.DialContext(ctx, scheme, address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial FPM: %w", err)
+type JIT struct {
+	Enabled    bool   `json:"enabled"`
+	On         bool   `json:"on"`
+	Kind       int    `json:"kind"`
+	OptLevel   int    `json:"opt_level"`
+	OptFlags   int    `json:"opt_flags"`
+	BufferSize uint64 `json:"buffer_size"`
+	BufferFree uint64 `json:"buffer_free"`
+}
+
+// OpcacheScript is one entry of the per-script list of opcache_get_status().
+type OpcacheScript struct {
+	Path              string `json:"full_path"`
+	Hits              uint64 `json:"hits"`
+	MemoryConsumption uint64 `json:"memory_consumption"`
+	LastUsedTimestamp int64  `json:"last_used_timestamp"`
+}
+
+// SecondsSinceRestart returns the seconds since opcache was last restarted,
+// or since it started when it never was.
+func (s OpcacheStatus) SecondsSinceRestart(now time.Time) (float64, bool) {
+	since := s.Statistics.LastRestartTime
+	if since == 0 {
+		since = s.Statistics.StartTime
 	}
-	defer client.Close()
-
-	scriptPath := tmpPath
-	env := map[string]string{
-		"SCRIPT_FILENAME": scriptPath,
-		"SCRIPT_NAME":     "/" + filepath.Base(scriptPath),
-		"SERVER_SOFTWARE": "phpeek-fpm-exporter",
-		"REMOTE_ADDR":     "127.0.0.1",
+	if since == 0 {
+		return 0, false
 	}
+	return now.Sub(time.Unix(since, 0)).Seconds(), true
+}
 
-	resp, err := client.Get(ctx, env)
-	if err != nil {
-		return nil, fmt.Errorf("fcgi GET failed: %w", err)
+// topScripts returns the n scripts using the most memory. PHP encodes an
+// empty script list as [] rather than {}, which yields no scripts.
+func topScripts(raw json.RawMessage, n int) ([]OpcacheScript, error) {
+	if n <= 0 || len(raw) == 0 || raw[0] != '{' {
+		return nil, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := fcgx.ReadBody(resp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read opcache response: %w", err)
+	var scripts map[string]OpcacheScript
+	if err := json.Unmarshal(raw, &scripts); err != nil {
+		return nil, err
+	}
+
+	top := make([]OpcacheScript, 0, len(scripts))
+	for path, script := range scripts {
+		if script.Path == "" {
+			script.Path = path
+		}
+		top = append(top, script)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].MemoryConsumption != top[j].MemoryConsumption {
+			return top[i].MemoryConsumption > top[j].MemoryConsumption
+		}
+		return top[i].Path < top[j].Path
+	})
+
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top, nil
+}
+
+// opcacheProbe leaves out the per-script list, which holds an entry for every
+// cached file and runs to megabytes on large codebases. opcacheScriptsProbe
+// includes it, for pools with opcache_top_scripts.
+var (
+	opcacheProbe        = Probe{Name: "opcache-status", Script: opcacheScript("false")}
+	opcacheScriptsProbe = Probe{Name: "opcache-scripts", Script: opcacheScript("true")}
+)
+
+func opcacheScript(includeScripts string) string {
+	return `<?php
+error_reporting(0);
+ini_set('display_errors', 0);
+header("Status: 200 OK");
+header("Content-Type: application/json");
+echo json_encode(opcache_get_status(` + includeScripts + `));
+exit;`
+}
+
+func GetOpcacheStatus(ctx context.Context, cfg config.FPMPoolConfig) (*OpcacheStatus, error) {
+	// The per-script list is only decoded when top scripts are requested
+	var raw struct {
+		OpcacheStatus
+		Scripts json.RawMessage `json:"scripts"`
+	}
+	probe := opcacheProbe
+	if cfg.OpcacheTopScripts > 0 {
+		probe = opcacheScriptsProbe
+	}
+	if err := probe.Run(ctx, cfg, &raw); err != nil {
+		return nil, err
 	}
 
-	var status OpcacheStatus
-	if err := json.Unmarshal(body, &status); err != nil {
-		return nil, fmt.Errorf("failed to parse opcache JSON: %w", err)
+	status := raw.OpcacheStatus
+	top, err := topScripts(raw.Scripts, cfg.OpcacheTopScripts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse opcache scripts: %w", err)
 	}
+	status.TopScripts = top
 
 	return &status, nil
 }
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 )
 
@@ -295,11 +298,9 @@ func TestGetOpcacheStatus_ErrorHandling(t *testing.T) {
 }
 
 func TestGetOpcacheStatus_ScriptCreation(t *testing.T) {
-	// Test that the opcache status script is created
-	expectedPath := "/tmp/phpeek-opcache-status.php"
-
-	// Remove the file if it exists
-	_ = os.Remove(expectedPath)
+	// Test that the opcache status script is created in the pool's probe dir
+	probeDir := t.TempDir()
+	expectedPath := filepath.Join(probeDir, "phpeek-opcache-status.php")
 
 	// Initialize logging to prevent panic
 	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
@@ -307,6 +308,7 @@ func TestGetOpcacheStatus_ScriptCreation(t *testing.T) {
 	ctx := context.Background()
 	cfg := config.FPMPoolConfig{
 		StatusSocket: "unix:///non/existent/socket",
+		ProbeDir:     probeDir,
 	}
 
 	// This will fail to connect, but should create the script file
@@ -329,11 +331,12 @@ func TestGetOpcacheStatus_ScriptCreation(t *testing.T) {
 	scriptContent := string(content)
 	expectedContent := []string{
 		"<?php",
+		"hash_hmac('sha256', $_SERVER['PHPEEK_NONCE']",
 		"error_reporting(0)",
 		"ini_set('display_errors', 0)",
 		"header(\"Status: 200 OK\")",
 		"header(\"Content-Type: application/json\")",
-		"echo json_encode(opcache_get_status())",
+		"echo json_encode(opcache_get_status(false))",
 		"exit;",
 	}
 
@@ -342,14 +345,12 @@ func TestGetOpcacheStatus_ScriptCreation(t *testing.T) {
 			t.Errorf("Expected script to contain '%s', but it was not found", expected)
 		}
 	}
-
-	// Clean up
-	_ = os.Remove(expectedPath)
 }
 
-func TestGetOpcacheStatus_ScriptReuse(t *testing.T) {
-	// Test that the script is reused if it already exists
-	expectedPath := "/tmp/phpeek-opcache-status.php"
+func TestGetOpcacheStatus_ScriptReplaced(t *testing.T) {
+	// Test that a script that does not match the expected content is replaced
+	probeDir := t.TempDir()
+	expectedPath := filepath.Join(probeDir, "phpeek-opcache-status.php")
 
 	// Create a custom script first
 	customContent := `<?php echo "custom script";`
@@ -364,26 +365,23 @@ func TestGetOpcacheStatus_ScriptReuse(t *testing.T) {
 	ctx := context.Background()
 	cfg := config.FPMPoolConfig{
 		StatusSocket: "unix:///non/existent/socket",
+		ProbeDir:     probeDir,
 	}
 
-	// This will fail to connect, but should NOT overwrite the existing script
+	// This will fail to connect, but should overwrite the existing script first
 	_, err = GetOpcacheStatus(ctx, cfg)
 	if err == nil {
 		t.Errorf("Expected error due to non-existent socket")
 	}
 
-	// Check that the script content is unchanged
 	content, err := os.ReadFile(expectedPath)
 	if err != nil {
 		t.Fatalf("Failed to read script: %v", err)
 	}
 
-	if string(content) != customContent {
-		t.Errorf("Expected script content to be unchanged, but it was modified")
+	if string(content) == customContent || !strings.Contains(string(content), "opcache_get_status(false)") {
+		t.Errorf("Expected the custom script to be replaced, got %q", content)
 	}
-
-	// Clean up
-	_ = os.Remove(expectedPath)
 }
 
 func TestOpcacheStatus_EmptyValues(t *testing.T) {
@@ -484,3 +482,153 @@ func TestOpcacheStatus_LargeValues(t *testing.T) {
 		t.Errorf("HitRate precision lost: expected ~%f, got %f", expectedHitRate, actualHitRate)
 	}
 }
+
+// opcacheStatusJSON is trimmed opcache_get_status() output of PHP 8.3 with
+// preloading and the JIT enabled.
+const opcacheStatusJSON = `{
+	"opcache_enabled": true,
+	"cache_full": false,
+	"restart_pending": false,
+	"restart_in_progress": false,
+	"memory_usage": {"used_memory": 1000, "free_memory": 3000, "wasted_memory": 0, "current_wasted_percentage": 0},
+	"interned_strings_usage": {"buffer_size": 8388608, "used_memory": 2097152, "free_memory": 6291456, "number_of_strings": 12000},
+	"opcache_statistics": {"num_cached_scripts": 3, "num_cached_keys": 5, "max_cached_keys": 16229, "hits": 10, "start_time": 1700000000, "last_restart_time": 0, "oom_restarts": 0, "hash_restarts": 0, "manual_restarts": 0, "misses": 3, "blacklist_misses": 0, "blacklist_miss_ratio": 0, "opcache_hit_rate": 76.9},
+	"preload_statistics": {"memory_consumption": 524288, "functions": ["helper"], "classes": ["App\\Kernel", "App\\User"], "scripts": ["/app/preload.php", "/app/Kernel.php", "/app/User.php"]},
+	"jit": {"enabled": true, "on": true, "kind": 5, "opt_level": 5, "opt_flags": 6, "buffer_size": 67108864, "buffer_free": 60000000},
+	"scripts": {
+		"/app/index.php": {"full_path": "/app/index.php", "hits": 9, "memory_consumption": 2000, "last_used_timestamp": 1700000100},
+		"/app/Kernel.php": {"full_path": "/app/Kernel.php", "hits": 1, "memory_consumption": 9000, "last_used_timestamp": 1700000050},
+		"/app/User.php": {"full_path": "/app/User.php", "hits": 0, "memory_consumption": 4000, "last_used_timestamp": 1700000010}
+	}
+}`
+
+func TestOpcacheStatus_DeepFields(t *testing.T) {
+	var status OpcacheStatus
+	if err := json.Unmarshal([]byte(opcacheStatusJSON), &status); err != nil {
+		t.Fatalf("Failed to unmarshal opcache status: %v", err)
+	}
+
+	if status.InternedStrings.BufferSize != 8388608 || status.InternedStrings.UsedMemory != 2097152 || status.InternedStrings.NumberOfStrings != 12000 {
+		t.Errorf("Unexpected interned strings usage: %+v", status.InternedStrings)
+	}
+	if status.Statistics.NumCachedKeys != 5 || status.Statistics.MaxCachedKeys != 16229 {
+		t.Errorf("Expected 5 of 16229 cached keys, got %d of %d", status.Statistics.NumCachedKeys, status.Statistics.MaxCachedKeys)
+	}
+	if status.JIT == nil || !status.JIT.On || status.JIT.BufferSize != 67108864 || status.JIT.BufferFree != 60000000 {
+		t.Errorf("Unexpected JIT status: %+v", status.JIT)
+	}
+	if status.Preload == nil {
+		t.Fatalf("Expected preload statistics")
+	}
+	if *status.Preload != (PreloadStats{MemoryConsumption: 524288, Scripts: 3, Functions: 1, Classes: 2}) {
+		t.Errorf("Unexpected preload statistics: %+v", *status.Preload)
+	}
+
+	// The exporter's own JSON must decode back to the same counts
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("Failed to marshal opcache status: %v", err)
+	}
+	var roundTrip OpcacheStatus
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Failed to unmarshal marshaled opcache status: %v", err)
+	}
+	if roundTrip.Preload == nil || *roundTrip.Preload != *status.Preload {
+		t.Errorf("Preload statistics changed after JSON round-trip: %+v", roundTrip.Preload)
+	}
+}
+
+func TestOpcacheStatus_WithoutPreloadAndJIT(t *testing.T) {
+	var status OpcacheStatus
+	if err := json.Unmarshal([]byte(`{"opcache_enabled": true}`), &status); err != nil {
+		t.Fatalf("Failed to unmarshal opcache status: %v", err)
+	}
+	if status.Preload != nil || status.JIT != nil {
+		t.Errorf("Expected no preload or JIT status, got %+v and %+v", status.Preload, status.JIT)
+	}
+}
+
+func TestOpcacheStatus_SecondsSinceRestart(t *testing.T) {
+	now := time.Unix(1700000600, 0)
+
+	tests := []struct {
+		name     string
+		stats    Stats
+		expected float64
+		ok       bool
+	}{
+		{"never restarted", Stats{StartTime: 1700000000}, 600, true},
+		{"restarted", Stats{StartTime: 1700000000, LastRestartTime: 1700000500}, 100, true},
+		{"unknown", Stats{}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age, ok := OpcacheStatus{Statistics: tt.stats}.SecondsSinceRestart(now)
+			if ok != tt.ok || age != tt.expected {
+				t.Errorf("Expected %v (%v), got %v (%v)", tt.expected, tt.ok, age, ok)
+			}
+		})
+	}
+}
+
+func TestTopScripts(t *testing.T) {
+	var raw struct {
+		Scripts json.RawMessage `json:"scripts"`
+	}
+	if err := json.Unmarshal([]byte(opcacheStatusJSON), &raw); err != nil {
+		t.Fatalf("Failed to unmarshal opcache status: %v", err)
+	}
+
+	top, err := topScripts(raw.Scripts, 2)
+	if err != nil {
+		t.Fatalf("topScripts failed: %v", err)
+	}
+	if len(top) != 2 || top[0].Path != "/app/Kernel.php" || top[1].Path != "/app/User.php" {
+		t.Errorf("Expected Kernel.php and User.php by memory, got %+v", top)
+	}
+
+	if top, _ := topScripts(raw.Scripts, 0); top != nil {
+		t.Errorf("Expected no scripts when disabled, got %+v", top)
+	}
+
+	// PHP encodes an empty script list as an array
+	if top, err := topScripts(json.RawMessage(`[]`), 5); err != nil || top != nil {
+		t.Errorf("Expected no scripts for an empty list, got %+v (%v)", top, err)
+	}
+}
+
+func TestGetOpcacheStatus_ScriptsOnlyForTopScripts(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Status: 200 OK\r\nContent-Type: application/json\r\n\r\n" + opcacheStatusJSON
+	})
+	cfg := config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()}
+
+	if _, err := GetOpcacheStatus(context.Background(), cfg); err != nil {
+		t.Fatalf("GetOpcacheStatus failed: %v", err)
+	}
+	cfg.OpcacheTopScripts = 2
+	status, err := GetOpcacheStatus(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("GetOpcacheStatus failed: %v", err)
+	}
+	if len(status.TopScripts) != 2 {
+		t.Errorf("Expected 2 top scripts, got %+v", status.TopScripts)
+	}
+
+	requests := fpm.Requests()
+	if len(requests) != 2 || requests[0]["SCRIPT_NAME"] != "/phpeek-opcache-status.php" || requests[1]["SCRIPT_NAME"] != "/phpeek-opcache-scripts.php" {
+		t.Fatalf("Expected the script list to be requested only for top scripts, got %v", requests)
+	}
+	for _, probe := range []struct {
+		file, call string
+	}{
+		{"phpeek-opcache-status.php", "opcache_get_status(false)"},
+		{"phpeek-opcache-scripts.php", "opcache_get_status(true)"},
+	} {
+		content, err := os.ReadFile(filepath.Join(cfg.ProbeDir, probe.file))
+		if err != nil || !strings.Contains(string(content), probe.call) {
+			t.Errorf("Expected %s to call %s, got %q (%v)", probe.file, probe.call, content, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// DefaultPingResponse is what php-fpm answers on ping.path when the pool sets
+// no ping.response.
+const DefaultPingResponse = "pong"
+
+// PingResult is the outcome of a request to the pool's ping.path.
+type PingResult struct {
+	Success         bool    `json:"success"`
+	DurationSeconds float64 `json:"duration_seconds"` // round trip, including a dial
+	Error           string  `json:"error,omitempty"`
+}
+
+// pingConfig returns the ping.path and ping.response to ping the pool with:
+// those set on the pool, or else those of its FPM config when an earlier poll
+// read it. It returns nil when neither is known. The config is not read here,
+// as that may need the master's PID from the status page.
+func pingConfig(poolCfg config.FPMPoolConfig) map[string]string {
+	if poolCfg.PingPath != "" {
+		return map[string]string{"ping.path": poolCfg.PingPath, "ping.response": poolCfg.PingResponse}
+	}
+	if poolCfg.Binary == "" || poolCfg.ConfigPath == "" {
+		return nil
+	}
+	conf, ok := cachedFPMConfig(fpmConfigKey(poolCfg.Binary, poolCfg.ConfigPath, poolCfg.Root))
+	if !ok {
+		return nil
+	}
+	name := PoolName(poolCfg)
+	for section, values := range conf.Pools {
+		if strings.EqualFold(section, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// PingPool requests the pool's ping.path, as set in its parsed FPM config,
+// and checks the reply against ping.response. The ping goes to the listen
+// socket, the way traffic reaches the pool, so its duration is the latency of
+// a request that does no work. It returns nil when the pool has no ping.path.
+func PingPool(ctx context.Context, poolCfg config.FPMPoolConfig, poolConfig map[string]string) *PingResult {
+	path := poolConfig["ping.path"]
+	if path == "" {
+		return nil
+	}
+	want := poolConfig["ping.response"]
+	if want == "" {
+		want = DefaultPingResponse
+	}
+
+	env := map[string]string{
+		"SCRIPT_FILENAME": path,
+		"SCRIPT_NAME":     path,
+		"SERVER_SOFTWARE": "phpeek-fpm-exporter",
+		"REMOTE_ADDR":     "127.0.0.1",
+	}
+
+	// Failed pings are timed as a whole. A successful one is timed by its round
+	// trip, without the liveness check of a kept connection.
+	start := time.Now()
+	resp, err := poolGet(ctx, poolCfg, poolCfg.Socket, env)
+	result := &PingResult{DurationSeconds: time.Since(start).Seconds()}
+	if err == nil {
+		result.DurationSeconds = resp.Duration.Seconds()
+	}
+
+	var dialErr *dialError
+	switch {
+	case errors.As(err, &dialErr):
+		result.Error = fmt.Sprintf("failed to dial FastCGI: %v", err)
+	case err != nil:
+		result.Error = fmt.Sprintf("fcgi GET failed: %v", err)
+	case resp.StatusCode != http.StatusOK:
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	case strings.TrimSpace(string(resp.Body)) != want:
+		got := strings.TrimSpace(string(resp.Body))
+		if len(got) > 64 {
+			got = got[:64] + "..."
+		}
+		result.Error = fmt.Sprintf("unexpected response %q, expected %q", got, want)
+	default:
+		result.Success = true
+	}
+	return result
+}
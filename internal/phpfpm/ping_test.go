@@ -0,0 +1,165 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func TestPingPool(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		switch params["SCRIPT_NAME"] {
+		case "/ping":
+			return "Content-type: text/plain\r\n\r\npong"
+		case "/health":
+			return "Content-type: text/plain\r\n\r\nalive\n"
+		default:
+			return "Status: 404 Not Found\r\n\r\nFile not found."
+		}
+	})
+	poolCfg := config.FPMPoolConfig{Socket: fpm.Socket, StatusSocket: fpm.Socket}
+
+	tests := []struct {
+		name       string
+		poolConfig map[string]string
+		success    bool
+		err        string
+	}{
+		{"default response", map[string]string{"ping.path": "/ping"}, true, ""},
+		{"custom response", map[string]string{"ping.path": "/health", "ping.response": "alive"}, true, ""},
+		{"wrong response", map[string]string{"ping.path": "/ping", "ping.response": "alive"}, false, `unexpected response "pong"`},
+		{"not a ping path", map[string]string{"ping.path": "/missing"}, false, "unexpected status 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PingPool(context.Background(), poolCfg, tt.poolConfig)
+			if got == nil {
+				t.Fatal("Expected a ping result")
+			}
+			if got.Success != tt.success {
+				t.Errorf("Expected success %v, got %+v", tt.success, got)
+			}
+			if !strings.Contains(got.Error, tt.err) {
+				t.Errorf("Expected error containing %q, got %q", tt.err, got.Error)
+			}
+			if got.DurationSeconds <= 0 {
+				t.Errorf("Expected the round trip to be measured, got %v", got.DurationSeconds)
+			}
+		})
+	}
+}
+
+func TestPingPool_NoPingPath(t *testing.T) {
+	if got := PingPool(context.Background(), config.FPMPoolConfig{Socket: "unix:///nonexistent.sock"}, map[string]string{"pm": "static"}); got != nil {
+		t.Errorf("Expected no ping for a pool without ping.path, got %+v", got)
+	}
+}
+
+func TestPingPool_Unreachable(t *testing.T) {
+	poolCfg := config.FPMPoolConfig{Socket: "unix://" + filepath.Join(t.TempDir(), "gone.sock")}
+
+	got := PingPool(context.Background(), poolCfg, map[string]string{"ping.path": "/ping"})
+	if got == nil || got.Success || !strings.Contains(got.Error, "failed to dial FastCGI") {
+		t.Errorf("Expected a failed ping, got %+v", got)
+	}
+}
+
+func TestGetMetricsForPool_Ping(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	tempDir := t.TempDir()
+	confPath := filepath.Join(tempDir, "php-fpm.conf")
+	conf := "[www]\nlisten = /run/php/www.sock\nping.path = /ping\nping.response = ok\n"
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		if params["SCRIPT_NAME"] == "/ping" {
+			return "Content-type: text/plain\r\n\r\nok"
+		}
+		return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "processes": [{"pid": 1, "state": "Idle", "request uri": "/ping", "last request cpu": 50}]}`
+	})
+
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		Binary:       filepath.Join(tempDir, "php-fpm"), // missing, so the config files are parsed
+		ConfigPath:   confPath,
+		SkipProbes:   true,
+	}
+
+	result, err := GetMetricsForPool(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+	pool := result.Pools["www"]
+	if pool.Ping == nil || !pool.Ping.Success {
+		t.Fatalf("Expected a successful ping, got %+v", pool.Ping)
+	}
+	if pool.ProcessesCpu != nil {
+		t.Errorf("Expected the ping request to be left out of the CPU average, got %v", *pool.ProcessesCpu)
+	}
+	if requests := fpm.Requests(); len(requests) != 2 || requests[1]["SCRIPT_NAME"] != "/ping" {
+		t.Errorf("Expected the status page and the ping to be requested, got %v", requests)
+	}
+
+	// Once the config is known, the ping goes first
+	if _, err := GetMetricsForPool(context.Background(), cfg); err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+	if requests := fpm.Requests(); len(requests) != 4 || requests[2]["SCRIPT_NAME"] != "/ping" {
+		t.Errorf("Expected the ping before the status page, got %v", requests)
+	}
+}
+
+func TestGetMetricsForPool_PingWithoutStatus(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		if params["SCRIPT_NAME"] == "/ping" {
+			return "Content-type: text/plain\r\n\r\npong"
+		}
+		return "Status: 404 Not Found\r\n\r\nFile not found."
+	})
+	cfg := config.FPMPoolConfig{
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		StatusPath:   "/status",
+		PingPath:     "/ping",
+		SkipProbes:   true,
+	}
+
+	_, err := GetMetricsForPool(context.Background(), cfg)
+	var scrapeErr *ScrapeError
+	if !errors.As(err, &scrapeErr) {
+		t.Fatalf("Expected a scrape error for the missing status page, got %v", err)
+	}
+	if result := NewFailedResult(cfg, err); result.Ping == nil || !result.Ping.Success {
+		t.Errorf("Expected the ping to succeed without the status page, got %+v", result.Ping)
+	}
+	if requests := fpm.Requests(); len(requests) == 0 || requests[0]["SCRIPT_NAME"] != "/ping" {
+		t.Errorf("Expected the ping before the status page, got %v", requests)
+	}
+
+	// A pool without a status page is still pinged
+	cfg.StatusPath = ""
+	result, err := GetMetricsForPool(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+	if result.StatusUnavailable == "" || result.Ping == nil || !result.Ping.Success {
+		t.Errorf("Expected an unavailable status page and a successful ping, got %+v", result)
+	}
+}
@@ -0,0 +1,332 @@
+package phpfpm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+// DefaultProbeDir is used for pools without a probe_dir. A chrooted pool
+// uses it below its chroot. It is not in the temp directory, which php-fpm
+// often does not share with the exporter (containers, PrivateTmp=).
+const DefaultProbeDir = "/var/lib/phpeek-fpm-exporter"
+
+// Probe stages reported in Pool.ProbeErrors.
+const (
+	ProbeStageInstall = "install" // the probe dir or script could not be written
+	ProbeStageRequest = "request"
+	ProbeStageParse   = "parse"
+)
+
+// ProbeStages lists every probe stage in the order a probe goes through them.
+var ProbeStages = []string{ProbeStageInstall, ProbeStageRequest, ProbeStageParse}
+
+// ProbeError is returned when a probe fails at a given stage.
+type ProbeError struct {
+	Stage string
+	Err   error
+}
+
+func (e *ProbeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// probeStage returns the stage err failed at. Errors that did not come from
+// running the probe are the caller's reading of its output.
+func probeStage(err error) string {
+	var probeErr *ProbeError
+	if errors.As(err, &probeErr) {
+		return probeErr.Stage
+	}
+	return ProbeStageParse
+}
+
+var (
+	probeDirWarnedMu sync.Mutex
+	probeDirWarned   = make(map[string]bool) // by socket
+)
+
+// probeTokenMaxAge is how far the timestamp of a probe request may be off
+// the worker's clock, so a captured token cannot be replayed later.
+const probeTokenMaxAge = 30 * time.Second
+
+var (
+	probeSecretOnce sync.Once
+	probeSecret     string
+)
+
+// Probe is a PHP script run inside a pool over FastCGI, for state that is
+// only visible from a worker: opcache, APCu, effective ini values and the
+// runtime itself. Scripts print JSON.
+//
+// Scripts are written to a directory owned by the exporter and compared
+// against their expected content before every run. Each request carries a
+// nonce, a timestamp and their HMAC under a secret embedded in the script, so
+// the scripts refuse to run when reached through the web server or with a
+// token older than probeTokenMaxAge.
+type Probe struct {
+	Name   string // the script is phpeek-<Name>.php, see IsExporterRequest
+	Script string
+}
+
+// FileName returns the name of the probe script.
+func (p Probe) FileName() string {
+	return "phpeek-" + p.Name + ".php"
+}
+
+// Run executes the probe in one of the pool's workers and decodes its output
+// into out.
+func (p Probe) Run(ctx context.Context, cfg config.FPMPoolConfig, out any) error {
+	body, err := p.Output(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return &ProbeError{Stage: ProbeStageParse, Err: fmt.Errorf("failed to parse %s JSON: %w", p.Name, err)}
+	}
+	return nil
+}
+
+// Output executes the probe and returns its raw output. Failures are
+// returned as *ProbeError.
+func (p Probe) Output(ctx context.Context, cfg config.FPMPoolConfig) ([]byte, error) {
+	hostDir, workerDir, err := probeLocation(cfg)
+	if err != nil {
+		return nil, &ProbeError{Stage: ProbeStageInstall, Err: err}
+	}
+	if err := ensureProbeDir(hostDir); err != nil {
+		return nil, &ProbeError{Stage: ProbeStageInstall, Err: err}
+	}
+
+	secret := getProbeSecret()
+	if err := installProbeScript(filepath.Join(hostDir, p.FileName()), guardProbeScript(p.Script, secret)); err != nil {
+		return nil, &ProbeError{Stage: ProbeStageInstall, Err: err}
+	}
+
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, &ProbeError{Stage: ProbeStageRequest, Err: fmt.Errorf("failed to create probe nonce: %w", err)}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body, err := runProbeScript(ctx, cfg, filepath.Join(workerDir, p.FileName()), map[string]string{
+		"PHPEEK_NONCE": nonce,
+		"PHPEEK_TIME":  timestamp,
+		"PHPEEK_TOKEN": probeToken(secret, nonce, timestamp),
+	})
+	if err != nil {
+		return nil, &ProbeError{Stage: ProbeStageRequest, Err: err}
+	}
+	return body, nil
+}
+
+// warnProbeInstall logs once per pool that its probe scripts cannot be
+// written, as its opcache, APCu, ini and runtime metrics are missing until
+// probe_dir is fixed. There is no fallback directory: none is known to be
+// reachable by both the exporter and the pool's workers.
+func warnProbeInstall(cfg config.FPMPoolConfig, err error) {
+	if cfg.Transient {
+		logging.L().Debug("PHPeek probe scripts cannot be written", "socket", cfg.Socket, "error", err)
+		return
+	}
+
+	probeDirWarnedMu.Lock()
+	warned := probeDirWarned[cfg.Socket]
+	probeDirWarned[cfg.Socket] = true
+	probeDirWarnedMu.Unlock()
+	if warned {
+		return
+	}
+	logging.L().Warn("PHPeek probe scripts cannot be written, set probe_dir to a directory the exporter can write and the pool can read",
+		"socket", cfg.Socket, "pool", PoolName(cfg), "error", err)
+}
+
+func forgetProbeWarning(socket string) {
+	probeDirWarnedMu.Lock()
+	delete(probeDirWarned, socket)
+	probeDirWarnedMu.Unlock()
+}
+
+// probeLocation returns the probe directory as seen by the exporter and as
+// seen by the pool's workers, which differ when the pool is chrooted or runs
+// with another filesystem root.
+func probeLocation(cfg config.FPMPoolConfig) (hostDir, workerDir string, err error) {
+	base := cfg.Chroot
+	if cfg.Root != "" {
+		base = filepath.Join(cfg.Root, cfg.Chroot)
+	}
+
+	hostDir = cfg.ProbeDir
+	if hostDir == "" {
+		hostDir = filepath.Join(base, DefaultProbeDir)
+	}
+	hostDir = filepath.Clean(hostDir)
+
+	if base == "" {
+		return hostDir, hostDir, nil
+	}
+
+	rel, err := filepath.Rel(filepath.Clean(base), hostDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", "", fmt.Errorf("probe dir %s is outside the pool's root %s", hostDir, base)
+	}
+	return hostDir, filepath.Join("/", rel), nil
+}
+
+// ensureProbeDir creates the probe directory and makes sure only the exporter
+// can change its contents, so a verified script cannot be swapped before the
+// worker runs it.
+func ensureProbeDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create probe dir: %w", err)
+		}
+		// Workers usually run as another user and need to read the scripts
+		if err := os.Chmod(dir, 0755); err != nil {
+			return fmt.Errorf("failed to set probe dir permissions: %w", err)
+		}
+		info, err = os.Lstat(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat probe dir: %w", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("probe dir %s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("probe dir %s is owned by uid %d, not the exporter", dir, st.Uid)
+	}
+	if perm := info.Mode().Perm(); perm&0022 != 0 {
+		if err := os.Chmod(dir, perm&^0022); err != nil {
+			return fmt.Errorf("failed to restrict probe dir permissions: %w", err)
+		}
+	}
+	return nil
+}
+
+// installProbeScript makes sure path holds exactly content, replacing
+// whatever is there otherwise. The file is swapped in with a rename, so a
+// symlink at path is replaced rather than followed.
+func installProbeScript(path string, content []byte) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+		if current, err := os.ReadFile(path); err == nil && sha256.Sum256(current) == sha256.Sum256(content) {
+			return nil
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".phpeek-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write PHP script: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write PHP script: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write PHP script: %w", err)
+	}
+	// Workers usually run as another user, so the script must be world-readable
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set PHP script permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install PHP script: %w", err)
+	}
+	return nil
+}
+
+// guardProbeScript prepends the token check to a probe script.
+func guardProbeScript(script, secret string) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?php\n")
+	fmt.Fprintf(&b, `if (!isset($_SERVER['PHPEEK_NONCE'], $_SERVER['PHPEEK_TIME'], $_SERVER['PHPEEK_TOKEN'])
+    || abs(time() - (int) $_SERVER['PHPEEK_TIME']) > %d
+    || !hash_equals(hash_hmac('sha256', $_SERVER['PHPEEK_NONCE'] . '|' . $_SERVER['PHPEEK_TIME'], '%s'), $_SERVER['PHPEEK_TOKEN'])) {
+    header('Status: 403 Forbidden');
+    exit;
+}
+`, int(probeTokenMaxAge.Seconds()), secret)
+	b.WriteString(strings.TrimPrefix(strings.TrimSpace(script), "<?php"))
+	return b.Bytes()
+}
+
+func getProbeSecret() string {
+	probeSecretOnce.Do(func() {
+		secret, err := randomHex(32)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create probe secret: %v", err))
+		}
+		probeSecret = secret
+	})
+	return probeSecret
+}
+
+// probeToken signs the nonce and the Unix timestamp of a probe request.
+func probeToken(secret, nonce, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce + "|" + timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// runProbeScript executes the PHP script at scriptPath, as seen by the
+// workers, in one of the pool's workers over FastCGI and returns its output.
+// A probe refused by the script's token check is an error.
+func runProbeScript(ctx context.Context, cfg config.FPMPoolConfig, scriptPath string, params map[string]string) ([]byte, error) {
+	if _, _, _, err := ParseAddress(cfg.StatusSocket, ""); err != nil {
+		return nil, fmt.Errorf("invalid socket: %w", err)
+	}
+
+	env := map[string]string{
+		"SCRIPT_FILENAME": scriptPath,
+		"SCRIPT_NAME":     "/" + filepath.Base(scriptPath),
+		"SERVER_SOFTWARE": "phpeek-fpm-exporter",
+		"REMOTE_ADDR":     "127.0.0.1",
+	}
+	for k, v := range params {
+		env[k] = v
+	}
+
+	resp, err := poolGet(ctx, cfg, cfg.StatusSocket, env)
+	var dialErr *dialError
+	if errors.As(err, &dialErr) {
+		return nil, fmt.Errorf("failed to dial FPM: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fcgi GET failed: %w", err)
+	}
+	if resp.StatusCode == 403 {
+		return nil, fmt.Errorf("%s refused the request: token check failed", filepath.Base(scriptPath))
+	}
+	return resp.Body, nil
+}
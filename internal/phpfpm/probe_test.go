@@ -0,0 +1,281 @@
+package phpfpm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+// probeHandler answers probe requests like a guarded probe script: requests
+// without a valid token are refused.
+func probeHandler(t *testing.T, name, body string) func(map[string]string) string {
+	return func(params map[string]string) string {
+		if params["SCRIPT_NAME"] != "/phpeek-"+name+".php" {
+			return "Status: 404 Not Found\r\n\r\nFile not found."
+		}
+		if params["PHPEEK_TOKEN"] != probeToken(getProbeSecret(), params["PHPEEK_NONCE"], params["PHPEEK_TIME"]) {
+			return "Status: 403 Forbidden\r\n\r\n"
+		}
+		return "Content-Type: application/json\r\n\r\n" + body
+	}
+}
+
+func TestProbe_Run(t *testing.T) {
+	fpm := fcgitest.Start(t, probeHandler(t, "answer", `{"answer": 42}`))
+	cfg := config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()}
+
+	probe := Probe{Name: "answer", Script: "<?php echo json_encode(['answer' => 42]);"}
+	var out struct {
+		Answer int `json:"answer"`
+	}
+	if err := probe.Run(context.Background(), cfg, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.Answer != 42 {
+		t.Errorf("Expected 42, got %d", out.Answer)
+	}
+
+	path := filepath.Join(cfg.ProbeDir, "phpeek-answer.php")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the probe script to be written: %v", err)
+	}
+	if !strings.Contains(string(content), "echo json_encode(['answer' => 42]);") || !strings.Contains(string(content), getProbeSecret()) {
+		t.Errorf("Expected the guarded probe script, got %q", content)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the script to be readable by the workers, got %v", info.Mode().Perm())
+	}
+
+	params := fpm.Requests()[0]
+	if params["SCRIPT_FILENAME"] != path || params["PHPEEK_NONCE"] == "" {
+		t.Errorf("Unexpected request params %v", params)
+	}
+	if ts, err := strconv.ParseInt(params["PHPEEK_TIME"], 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("Expected the current time to be signed, got %q", params["PHPEEK_TIME"])
+	}
+
+	// Each request carries a new nonce
+	if err := probe.Run(context.Background(), cfg, &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if requests := fpm.Requests(); requests[0]["PHPEEK_NONCE"] == requests[1]["PHPEEK_NONCE"] {
+		t.Errorf("Expected a new nonce for every request")
+	}
+
+	missing := Probe{Name: "missing", Script: "<?php"}
+	if err := missing.Run(context.Background(), cfg, &out); err == nil || !strings.Contains(err.Error(), "missing JSON") {
+		t.Errorf("Expected a JSON error naming the probe, got %v", err)
+	}
+}
+
+func TestProbe_Refused(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Status: 403 Forbidden\r\n\r\n"
+	})
+	cfg := config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()}
+
+	_, err := Probe{Name: "answer", Script: "<?php"}.Output(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "token check failed") {
+		t.Errorf("Expected a refused probe to fail, got %v", err)
+	}
+}
+
+func TestCollectProbes_ProbeErrors(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, probeHandler(t, "runtime", `{"version": "8.3.0"}`))
+	// A regular file where the probe dir should be, as unusable as a dir the exporter may not create
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	cfg := config.FPMPoolConfig{Socket: fpm.Socket, StatusSocket: fpm.Socket, ProbeDir: filepath.Join(blocked, "probes"), IniDirectives: []string{"memory_limit"}}
+	t.Cleanup(func() { ForgetPool(cfg) })
+
+	var pool Pool
+	collectProbes(context.Background(), cfg, &pool)
+	for _, probe := range ProbeNames {
+		if stage := pool.ProbeErrors[probe]; stage != ProbeStageInstall {
+			t.Errorf("Expected probe %s to fail at %s, got %q", probe, ProbeStageInstall, stage)
+		}
+	}
+	probeDirWarnedMu.Lock()
+	warned := probeDirWarned[cfg.Socket]
+	probeDirWarnedMu.Unlock()
+	if !warned {
+		t.Error("Expected the unusable probe dir to be warned about")
+	}
+
+	// Only the runtime probe is answered; the others are not found
+	cfg.ProbeDir = t.TempDir()
+	pool = Pool{}
+	collectProbes(context.Background(), cfg, &pool)
+	if _, failed := pool.ProbeErrors["runtime"]; failed || pool.Runtime == nil {
+		t.Errorf("Expected the runtime probe to succeed, got %v", pool.ProbeErrors)
+	}
+	if stage := pool.ProbeErrors["apcu"]; stage != ProbeStageParse {
+		t.Errorf("Expected the APCu probe to fail at %s, got %q", ProbeStageParse, stage)
+	}
+
+	ForgetPool(cfg)
+	probeDirWarnedMu.Lock()
+	_, kept := probeDirWarned[cfg.Socket]
+	probeDirWarnedMu.Unlock()
+	if kept {
+		t.Error("Expected the warning to be forgotten with the pool")
+	}
+}
+
+func TestProbeLocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.FPMPoolConfig
+		hostDir    string
+		workerDir  string
+		shouldFail bool
+	}{
+		{"default", config.FPMPoolConfig{}, DefaultProbeDir, DefaultProbeDir, false},
+		{"configured", config.FPMPoolConfig{ProbeDir: "/srv/phpeek/"}, "/srv/phpeek", "/srv/phpeek", false},
+		{"chroot default", config.FPMPoolConfig{Chroot: "/var/www/jail"}, filepath.Join("/var/www/jail", DefaultProbeDir), DefaultProbeDir, false},
+		{"chroot configured", config.FPMPoolConfig{Chroot: "/var/www/jail", ProbeDir: "/var/www/jail/probes"}, "/var/www/jail/probes", "/probes", false},
+		{"outside chroot", config.FPMPoolConfig{Chroot: "/var/www/jail", ProbeDir: "/var/www/jail-other"}, "", "", true},
+		{"root default", config.FPMPoolConfig{Root: "/proc/2000/root"}, filepath.Join("/proc/2000/root", DefaultProbeDir), DefaultProbeDir, false},
+		{"root and chroot", config.FPMPoolConfig{Root: "/proc/2000/root", Chroot: "/var/www/jail"}, filepath.Join("/proc/2000/root/var/www/jail", DefaultProbeDir), DefaultProbeDir, false},
+		{"outside root", config.FPMPoolConfig{Root: "/proc/2000/root", ProbeDir: "/tmp/probes"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostDir, workerDir, err := probeLocation(tt.cfg)
+			if tt.shouldFail {
+				if err == nil {
+					t.Errorf("Expected an error, got %s and %s", hostDir, workerDir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeLocation failed: %v", err)
+			}
+			if hostDir != tt.hostDir || workerDir != tt.workerDir {
+				t.Errorf("Expected %s and %s, got %s and %s", tt.hostDir, tt.workerDir, hostDir, workerDir)
+			}
+		})
+	}
+}
+
+func TestEnsureProbeDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "probes")
+
+	if err := ensureProbeDir(dir); err != nil {
+		t.Fatalf("ensureProbeDir failed: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the probe dir to be created with 0755, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// Others must not be able to swap scripts
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	if err := ensureProbeDir(dir); err != nil {
+		t.Fatalf("ensureProbeDir failed: %v", err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0755 {
+		t.Errorf("Expected group and other write access to be removed, got %v", info.Mode().Perm())
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if err := ensureProbeDir(file); err == nil {
+		t.Errorf("Expected an error for a probe dir that is a file")
+	}
+}
+
+func TestInstallProbeScript(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "phpeek-test.php")
+
+	if err := installProbeScript(path, []byte("<?php echo 1;")); err != nil {
+		t.Fatalf("installProbeScript failed: %v", err)
+	}
+	info, _ := os.Stat(path)
+
+	// Matching content is left alone
+	if err := installProbeScript(path, []byte("<?php echo 1;")); err != nil {
+		t.Fatalf("installProbeScript failed: %v", err)
+	}
+	if again, _ := os.Stat(path); !os.SameFile(info, again) {
+		t.Errorf("Expected a matching script not to be rewritten")
+	}
+
+	// Tampered content is replaced
+	os.WriteFile(path, []byte("<?php system($_GET['cmd']);"), 0644)
+	if err := installProbeScript(path, []byte("<?php echo 1;")); err != nil {
+		t.Fatalf("installProbeScript failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "<?php echo 1;" {
+		t.Errorf("Expected the tampered script to be replaced, got %q", content)
+	}
+
+	// A symlink is replaced, not followed
+	target := filepath.Join(t.TempDir(), "target.php")
+	os.WriteFile(target, []byte("untouched"), 0644)
+	os.Remove(path)
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := installProbeScript(path, []byte("<?php echo 1;")); err != nil {
+		t.Fatalf("installProbeScript failed: %v", err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "untouched" {
+		t.Errorf("Expected the symlink target to be untouched, got %q", content)
+	}
+	if info, _ := os.Lstat(path); !info.Mode().IsRegular() {
+		t.Errorf("Expected the symlink to be replaced by a regular file")
+	}
+}
+
+func TestGuardProbeScript(t *testing.T) {
+	script := string(guardProbeScript("<?php\necho 1;", "s3cret"))
+
+	if !strings.HasPrefix(script, "<?php\n") || strings.Count(script, "<?php") != 1 {
+		t.Errorf("Expected a single opening tag, got %q", script)
+	}
+	if !strings.Contains(script, "hash_hmac('sha256', $_SERVER['PHPEEK_NONCE'] . '|' . $_SERVER['PHPEEK_TIME'], 's3cret')") {
+		t.Errorf("Expected the token check, got %q", script)
+	}
+	if !strings.Contains(script, "abs(time() - (int) $_SERVER['PHPEEK_TIME']) > 30") {
+		t.Errorf("Expected the freshness check, got %q", script)
+	}
+	if !strings.HasSuffix(script, "echo 1;") {
+		t.Errorf("Expected the probe body after the check, got %q", script)
+	}
+}
+
+func TestProbeToken(t *testing.T) {
+	token := probeToken("s3cret", "abc", "1700000000")
+	if token != probeToken("s3cret", "abc", "1700000000") {
+		t.Errorf("Expected the token to be deterministic")
+	}
+	// A captured nonce and token must not be valid at another time
+	if token == probeToken("s3cret", "abc", "1700000060") {
+		t.Errorf("Expected the timestamp to be signed")
+	}
+}
+
+func TestRunProbeScript_DialError(t *testing.T) {
+	_, err := runProbeScript(context.Background(), config.FPMPoolConfig{StatusSocket: "unix:///nonexistent/fpm.sock"}, "/tmp/phpeek-test.php", nil)
+	if err == nil {
+		t.Errorf("Expected an error for an unreachable pool")
+	}
+}
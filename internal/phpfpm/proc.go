@@ -0,0 +1,225 @@
+package phpfpm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// procRoot is where process information is read from, replaced in tests.
+var procRoot = "/proc"
+
+// userHZ is the unit of CPU times in /proc/<pid>/stat.
+const userHZ = 100
+
+// ErrNotFPMProcess is returned when a PID does not belong to a PHP-FPM
+// process, e.g. because the exporter runs in another PID namespace.
+var ErrNotFPMProcess = errors.New("not a php-fpm process")
+
+// ProcStats holds the OS-level footprint of a worker read from /proc.
+// Pointer fields are nil when the file behind them could not be read,
+// which usually means the exporter runs as another user.
+type ProcStats struct {
+	RSS                    int64   `json:"rss"`
+	Swap                   int64   `json:"swap"`
+	VoluntaryCtxSwitches   int64   `json:"voluntary_ctxt_switches"`
+	InvoluntaryCtxSwitches int64   `json:"nonvoluntary_ctxt_switches"`
+	CPUSeconds             float64 `json:"cpu_seconds"`
+	PSS                    *int64  `json:"pss,omitempty"`
+	OpenFDs                *int64  `json:"open_fds,omitempty"`
+	ReadBytes              *int64  `json:"read_bytes,omitempty"`
+	WriteBytes             *int64  `json:"write_bytes,omitempty"`
+}
+
+// ReadProcStats reads the status, stat, io, smaps_rollup and fd entries of a
+// PHP-FPM worker.
+func ReadProcStats(pid int) (*ProcStats, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cmdline of pid %d: %w", pid, err)
+	}
+	if !bytes.Contains(cmdline, []byte("php-fpm")) {
+		return nil, fmt.Errorf("pid %d: %w", pid, ErrNotFPMProcess)
+	}
+
+	status, err := readKeyValues(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status of pid %d: %w", pid, err)
+	}
+
+	stats := &ProcStats{
+		RSS:                    kilobytes(status["VmRSS"]),
+		Swap:                   kilobytes(status["VmSwap"]),
+		VoluntaryCtxSwitches:   number(status["voluntary_ctxt_switches"]),
+		InvoluntaryCtxSwitches: number(status["nonvoluntary_ctxt_switches"]),
+	}
+
+	if cpu, err := readCPUSeconds(filepath.Join(dir, "stat")); err == nil {
+		stats.CPUSeconds = cpu
+	}
+
+	if rollup, err := readKeyValues(filepath.Join(dir, "smaps_rollup")); err == nil {
+		if v, ok := rollup["Pss"]; ok {
+			stats.PSS = ptr(kilobytes(v))
+		}
+	}
+
+	if io, err := readKeyValues(filepath.Join(dir, "io")); err == nil {
+		stats.ReadBytes = ptr(number(io["read_bytes"]))
+		stats.WriteBytes = ptr(number(io["write_bytes"]))
+	}
+
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		stats.OpenFDs = ptr(int64(len(fds)))
+	}
+
+	return stats, nil
+}
+
+// localProcesses reports whether the pool's workers can be looked up in the
+// exporter's /proc. A pool in another pod or reached over TCP on another host
+// runs in another PID namespace, where its PIDs may belong to unrelated
+// processes here. Masters found by autodiscovery were seen in /proc.
+func localProcesses(poolCfg config.FPMPoolConfig) bool {
+	if poolCfg.Pod != "" {
+		return false
+	}
+	if poolCfg.Discovered || poolCfg.Root != "" {
+		return true
+	}
+	scheme, address, _, err := ParseAddress(poolCfg.Socket, "")
+	if err != nil || scheme != "tcp" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified()))
+}
+
+// ReadEnviron returns the environment a process was started with, from
+// /proc/<pid>/environ.
+func ReadEnviron(pid int) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environ of pid %d: %w", pid, err)
+	}
+
+	env := make(map[string]string)
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if key, value, ok := strings.Cut(string(entry), "="); ok && key != "" {
+			env[key] = value
+		}
+	}
+	return env, nil
+}
+
+// ReadCmdline returns the command line arguments of a process, from
+// /proc/<pid>/cmdline. A php-fpm master replaces them with its process title.
+func ReadCmdline(pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cmdline of pid %d: %w", pid, err)
+	}
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00"), nil
+}
+
+// readKeyValues parses "Key: value" files such as status, io and smaps_rollup.
+func readKeyValues(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values, scanner.Err()
+}
+
+// readCPUSeconds returns utime + stime from /proc/<pid>/stat.
+func readCPUSeconds(path string) (float64, error) {
+	fields, err := readStatFields(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed stat: %s", path)
+	}
+
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(utime+stime) / userHZ, nil
+}
+
+// readStatFields returns the fields of /proc/<pid>/stat after the command
+// name, starting with the state.
+func readStatFields(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name may contain spaces and parentheses; fields start after the last ")"
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("malformed stat: %s", path)
+	}
+	return strings.Fields(string(data[end+1:])), nil
+}
+
+// FindMasterPID returns the PID of the master process that forked the given
+// workers, or 0 when it cannot be determined, e.g. because the exporter runs
+// in another PID namespace.
+func FindMasterPID(workers []PoolProcess) int {
+	for _, worker := range workers {
+		fields, err := readStatFields(filepath.Join(procRoot, strconv.Itoa(worker.PID), "stat"))
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil || ppid <= 1 {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(ppid), "cmdline"))
+		if err == nil && bytes.Contains(cmdline, []byte("php-fpm: master")) {
+			return ppid
+		}
+	}
+	return 0
+}
+
+// kilobytes converts a "1234 kB" value to bytes.
+func kilobytes(v string) int64 {
+	return number(strings.TrimSuffix(v, " kB")) * 1024
+}
+
+func number(v string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n
+}
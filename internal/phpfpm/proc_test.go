@@ -0,0 +1,163 @@
+package phpfpm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// useProcFixture points procRoot at testdata/proc for the duration of a test.
+func useProcFixture(t *testing.T) {
+	t.Helper()
+
+	orig := procRoot
+	procRoot = "testdata/proc"
+	t.Cleanup(func() { procRoot = orig })
+}
+
+func TestReadProcStats(t *testing.T) {
+	useProcFixture(t)
+
+	stats, err := ReadProcStats(1234)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if stats.RSS != 45632*1024 {
+		t.Errorf("Expected RSS %d, got %d", 45632*1024, stats.RSS)
+	}
+	if stats.Swap != 512*1024 {
+		t.Errorf("Expected swap %d, got %d", 512*1024, stats.Swap)
+	}
+	if stats.VoluntaryCtxSwitches != 1520 || stats.InvoluntaryCtxSwitches != 37 {
+		t.Errorf("Expected context switches 1520/37, got %d/%d", stats.VoluntaryCtxSwitches, stats.InvoluntaryCtxSwitches)
+	}
+	// utime 250 + stime 75 ticks at 100 Hz
+	if stats.CPUSeconds != 3.25 {
+		t.Errorf("Expected 3.25 CPU seconds, got %v", stats.CPUSeconds)
+	}
+
+	if stats.PSS == nil || *stats.PSS != 18944*1024 {
+		t.Errorf("Expected PSS %d, got %v", 18944*1024, stats.PSS)
+	}
+	if stats.OpenFDs == nil || *stats.OpenFDs != 5 {
+		t.Errorf("Expected 5 open fds, got %v", stats.OpenFDs)
+	}
+	if stats.ReadBytes == nil || *stats.ReadBytes != 40960 {
+		t.Errorf("Expected 40960 read bytes, got %v", stats.ReadBytes)
+	}
+	if stats.WriteBytes == nil || *stats.WriteBytes != 8192 {
+		t.Errorf("Expected 8192 write bytes, got %v", stats.WriteBytes)
+	}
+}
+
+func TestReadProcStats_PartialAccess(t *testing.T) {
+	useProcFixture(t)
+
+	// Only status and stat are readable, as for a worker owned by another user
+	stats, err := ReadProcStats(1300)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if stats.RSS != 30720*1024 {
+		t.Errorf("Expected RSS %d, got %d", 30720*1024, stats.RSS)
+	}
+	// A command name with spaces and parentheses must not shift the stat fields
+	if stats.CPUSeconds != 0.2 {
+		t.Errorf("Expected 0.2 CPU seconds, got %v", stats.CPUSeconds)
+	}
+	if stats.PSS != nil || stats.OpenFDs != nil || stats.ReadBytes != nil || stats.WriteBytes != nil {
+		t.Errorf("Expected unreadable stats to be nil, got %+v", stats)
+	}
+}
+
+func TestReadProcStats_NotFPM(t *testing.T) {
+	useProcFixture(t)
+
+	// A PID from another namespace may belong to an unrelated process
+	_, err := ReadProcStats(4321)
+	if !errors.Is(err, ErrNotFPMProcess) {
+		t.Errorf("Expected ErrNotFPMProcess, got %v", err)
+	}
+}
+
+func TestReadProcStats_Missing(t *testing.T) {
+	useProcFixture(t)
+
+	if _, err := ReadProcStats(99999); err == nil {
+		t.Errorf("Expected error for missing process")
+	}
+}
+
+func TestFindMasterPID(t *testing.T) {
+	useProcFixture(t)
+
+	// 1300's parent is init and 99999 is gone, 1234 was forked by master 1200
+	workers := []PoolProcess{{PID: 99999}, {PID: 1300}, {PID: 1234}}
+	if pid := FindMasterPID(workers); pid != 1200 {
+		t.Errorf("Expected master PID 1200, got %d", pid)
+	}
+
+	if pid := FindMasterPID(workers[:2]); pid != 0 {
+		t.Errorf("Expected 0 without a known master, got %d", pid)
+	}
+}
+
+func TestLocalProcesses(t *testing.T) {
+	tests := []struct {
+		name     string
+		poolCfg  config.FPMPoolConfig
+		expected bool
+	}{
+		{"unix socket", config.FPMPoolConfig{Socket: "unix:///run/php/www.sock"}, true},
+		{"loopback", config.FPMPoolConfig{Socket: "tcp://127.0.0.1:9000"}, true},
+		{"localhost", config.FPMPoolConfig{Socket: "tcp://localhost:9000"}, true},
+		{"other host", config.FPMPoolConfig{Socket: "tcp://php-fpm:9000"}, false},
+		{"discovered master", config.FPMPoolConfig{Socket: "tcp://10.0.0.5:9000", Discovered: true}, true},
+		{"pod", config.FPMPoolConfig{Socket: "tcp://10.0.0.1:9000", Pod: "web-1", Discovered: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localProcesses(tt.poolCfg); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadEnviron(t *testing.T) {
+	useProcFixture(t)
+
+	env, err := ReadEnviron(2000)
+	if err != nil {
+		t.Fatalf("ReadEnviron failed: %v", err)
+	}
+	if env["APP_ENV"] != "staging" || env["HOSTNAME"] != "app-7d9f" || len(env) != 3 {
+		t.Errorf("Expected the master's environment, got %v", env)
+	}
+
+	if _, err := ReadEnviron(99999); err == nil {
+		t.Errorf("Expected error for missing process")
+	}
+}
+
+func TestKilobytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1024 kB", 1024 * 1024},
+		{"0 kB", 0},
+		{"", 0},
+		{"garbage", 0},
+	}
+
+	for _, tt := range tests {
+		if got := kilobytes(tt.in); got != tt.want {
+			t.Errorf("kilobytes(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package phpfpm
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompletedRequest describes a request a worker finished between two polls,
+// taken from the "last request" fields of the full status page.
+type CompletedRequest struct {
+	PID      int
+	Method   string
+	URI      string
+	Script   string
+	Duration time.Duration
+	Memory   float64 // peak memory in bytes
+	CPU      float64 // percent of one CPU
+}
+
+// RequestTracker detects completed requests by remembering each worker's
+// request counter across polls. When a worker served several requests between
+// two polls only the last one is visible, so the result is a sample.
+type RequestTracker struct {
+	mu   sync.Mutex
+	seen map[string]map[int]int64
+}
+
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{
+		seen: make(map[string]map[int]int64),
+	}
+}
+
+// Observe returns the requests completed in pool since the previous call with
+// the same key. Workers seen for the first time only establish a baseline.
+func (t *RequestTracker) Observe(key string, pool Pool) []CompletedRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev := t.seen[key]
+	current := make(map[int]int64, len(pool.Processes))
+	var completed []CompletedRequest
+
+	for _, proc := range pool.Processes {
+		current[proc.PID] = proc.Requests
+
+		before, ok := prev[proc.PID]
+		if !ok || proc.Requests <= before {
+			continue
+		}
+
+		// A busy worker reports the request it is serving, not the one it finished
+		if !strings.EqualFold(proc.State, "idle") || IsExporterRequest(proc, pool.Path, pool.Config["ping.path"]) {
+			continue
+		}
+
+		completed = append(completed, CompletedRequest{
+			PID:      proc.PID,
+			Method:   proc.RequestMethod,
+			URI:      proc.RequestURI,
+			Script:   proc.Script,
+			Duration: time.Duration(proc.RequestDuration) * time.Microsecond,
+			Memory:   proc.LastRequestMemory,
+			CPU:      proc.LastRequestCPU,
+		})
+	}
+
+	t.seen[key] = current
+	return completed
+}
+
+// Forget drops the workers seen for keys that start with prefix.
+func (t *RequestTracker) Forget(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.seen {
+		if strings.HasPrefix(key, prefix) {
+			delete(t.seen, key)
+		}
+	}
+}
+
+// IsExporterRequest reports whether the worker's last request was one of our
+// own status, ping or probe requests, which would skew request statistics.
+// paths are the pool's status and ping paths; empty ones are ignored. The
+// URI must be the path itself, with or without a query string, so that
+// /statusboard is not taken for /status.
+func IsExporterRequest(proc PoolProcess, paths ...string) bool {
+	for _, path := range paths {
+		if path != "" && (proc.RequestURI == path || strings.HasPrefix(proc.RequestURI, path+"?")) {
+			return true
+		}
+	}
+	if strings.HasPrefix(proc.RequestURI, "/opcache-status-") {
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(proc.Script), "phpeek-")
+}
@@ -0,0 +1,159 @@
+package phpfpm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestTracker_Observe(t *testing.T) {
+	tracker := NewRequestTracker()
+
+	first := Pool{
+		Path: "/status",
+		Processes: []PoolProcess{
+			{PID: 100, State: "Idle", Requests: 5, RequestURI: "/index.php"},
+			{PID: 101, State: "Running", Requests: 3, RequestURI: "/slow.php"},
+		},
+	}
+
+	// The first poll only establishes a baseline
+	if got := tracker.Observe("pool", first); len(got) != 0 {
+		t.Fatalf("Expected no completed requests on first poll, got %d", len(got))
+	}
+
+	second := Pool{
+		Path: "/status",
+		Processes: []PoolProcess{
+			{
+				PID: 100, State: "Idle", Requests: 6,
+				RequestMethod: "GET", RequestURI: "/users", Script: "/app/index.php",
+				RequestDuration: 250000, LastRequestMemory: 2097152, LastRequestCPU: 12.5,
+			},
+			// Still busy with a new request: the last request fields are not final
+			{PID: 101, State: "Running", Requests: 4, RequestURI: "/slow.php"},
+			// New worker: baseline only
+			{PID: 102, State: "Idle", Requests: 1, RequestURI: "/index.php"},
+		},
+	}
+
+	got := tracker.Observe("pool", second)
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 completed request, got %d: %+v", len(got), got)
+	}
+
+	req := got[0]
+	if req.PID != 100 || req.Method != "GET" || req.URI != "/users" || req.Script != "/app/index.php" {
+		t.Errorf("Unexpected request identity: %+v", req)
+	}
+	if req.Duration != 250*time.Millisecond {
+		t.Errorf("Expected duration 250ms, got %v", req.Duration)
+	}
+	if req.Memory != 2097152 {
+		t.Errorf("Expected memory 2097152, got %v", req.Memory)
+	}
+	if req.CPU != 12.5 {
+		t.Errorf("Expected CPU 12.5, got %v", req.CPU)
+	}
+
+	// No counter change means nothing new completed
+	if got := tracker.Observe("pool", second); len(got) != 0 {
+		t.Errorf("Expected no completed requests without counter change, got %d", len(got))
+	}
+}
+
+func TestRequestTracker_SkipsExporterRequests(t *testing.T) {
+	tracker := NewRequestTracker()
+
+	pool := func(requests int64, uri, script string) Pool {
+		return Pool{
+			Path:   "/status",
+			Config: map[string]string{"ping.path": "/ping"},
+			Processes: []PoolProcess{
+				{PID: 200, State: "Idle", Requests: requests, RequestURI: uri, Script: script},
+			},
+		}
+	}
+
+	tracker.Observe("pool", pool(1, "/index.php", "/app/index.php"))
+
+	tests := []struct {
+		name   string
+		uri    string
+		script string
+	}{
+		{"status page", "/status?json&full", "/status"},
+		{"ping", "/ping", "/ping"},
+		{"opcache probe", "/opcache-status-123", ""},
+		{"probe script", "", "/tmp/phpeek-opcache-status.php"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tracker.Observe("pool", pool(int64(i+2), tt.uri, tt.script))
+			if len(got) != 0 {
+				t.Errorf("Expected exporter request to be skipped, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestIsExporterRequest(t *testing.T) {
+	tests := []struct {
+		uri      string
+		exporter bool
+	}{
+		{"/status", true},
+		{"/status?json&full", true},
+		{"/ping", true},
+		{"/statusboard", false},
+		{"/status/orders", false},
+		{"/pingback?id=1", false},
+		{"/index.php", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsExporterRequest(PoolProcess{RequestURI: tt.uri, Script: "/app/index.php"}, "/status", "/ping", ""); got != tt.exporter {
+			t.Errorf("IsExporterRequest(%q) = %v, expected %v", tt.uri, got, tt.exporter)
+		}
+	}
+}
+
+func TestRequestTracker_KeysAreIndependent(t *testing.T) {
+	tracker := NewRequestTracker()
+
+	pool := func(requests int64) Pool {
+		return Pool{Processes: []PoolProcess{{PID: 300, State: "Idle", Requests: requests}}}
+	}
+
+	tracker.Observe("a", pool(1))
+	tracker.Observe("b", pool(10))
+
+	if got := tracker.Observe("a", pool(2)); len(got) != 1 {
+		t.Errorf("Expected 1 completed request for key a, got %d", len(got))
+	}
+
+	// A reused PID with a lower counter is a new worker, not a completion
+	if got := tracker.Observe("b", pool(1)); len(got) != 0 {
+		t.Errorf("Expected counter reset to be ignored, got %d", len(got))
+	}
+}
+
+func TestRequestTracker_Forget(t *testing.T) {
+	tracker := NewRequestTracker()
+
+	pool := func(requests int64) Pool {
+		return Pool{Processes: []PoolProcess{{PID: 300, State: "Idle", Requests: requests}}}
+	}
+
+	tracker.Observe("a|www", pool(1))
+	tracker.Observe("b|www", pool(1))
+	tracker.Forget("a|")
+
+	// A forgotten key starts over with a baseline
+	if got := tracker.Observe("a|www", pool(2)); len(got) != 0 {
+		t.Errorf("Expected no completed requests after Forget, got %d", len(got))
+	}
+	if got := tracker.Observe("b|www", pool(2)); len(got) != 1 {
+		t.Errorf("Expected other keys to be kept, got %d", len(got))
+	}
+}
@@ -0,0 +1,95 @@
+package phpfpm
+
+import (
+	"sync"
+)
+
+// Reasons a master restart was detected, reported by MasterRestarts.
+const (
+	// RestartStartTime means the master's start time changed while its PID
+	// stayed the same, as on a reload (SIGUSR2).
+	RestartStartTime = "start_time"
+	// RestartMasterPID means a new master process replaced the previous one.
+	RestartMasterPID = "master_pid"
+)
+
+// RestartReasons lists every reason a restart is counted under.
+var RestartReasons = []string{RestartStartTime, RestartMasterPID}
+
+// RestartKey identifies a master restart counter.
+type RestartKey struct {
+	Socket string
+	Pool   string
+	Reason string
+}
+
+type masterState struct {
+	startTime int64
+	pid       int // 0 when not visible to the exporter
+}
+
+var (
+	restartsMu sync.Mutex
+	masters    = make(map[string]masterState) // by socket
+	restarts   = make(map[RestartKey]uint64)
+)
+
+// MasterRestarts returns a copy of the restart counters. Every pool that has
+// been scraped has a counter for each reason, starting at 0.
+func MasterRestarts() map[RestartKey]uint64 {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	out := make(map[RestartKey]uint64, len(restarts))
+	for k, v := range restarts {
+		out[k] = v
+	}
+	return out
+}
+
+func forgetRestarts(socket string) {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	delete(masters, socket)
+	for key := range restarts {
+		if key.Socket == socket {
+			delete(restarts, key)
+		}
+	}
+}
+
+// detectRestart compares the master behind socket with the one seen on the
+// previous scrape and returns why it restarted, or "" when it did not.
+func detectRestart(socket, pool string, startTime int64, pid int) string {
+	restartsMu.Lock()
+	defer restartsMu.Unlock()
+
+	prev, seen := masters[socket]
+	if pid == 0 {
+		pid = prev.pid
+	}
+	masters[socket] = masterState{startTime: startTime, pid: pid}
+
+	for _, reason := range RestartReasons {
+		key := RestartKey{Socket: socket, Pool: pool, Reason: reason}
+		if _, ok := restarts[key]; !ok {
+			restarts[key] = 0
+		}
+	}
+	if !seen {
+		return ""
+	}
+
+	reason := ""
+	switch {
+	case prev.pid != 0 && prev.pid != pid:
+		reason = RestartMasterPID
+	case prev.startTime != startTime:
+		reason = RestartStartTime
+	default:
+		return ""
+	}
+	restarts[RestartKey{Socket: socket, Pool: pool, Reason: reason}]++
+	return reason
+}
@@ -0,0 +1,50 @@
+package phpfpm
+
+import (
+	"testing"
+)
+
+func TestDetectRestart(t *testing.T) {
+	socket := "unix:///run/restarts-test.sock"
+
+	steps := []struct {
+		name      string
+		startTime int64
+		pid       int
+		want      string
+	}{
+		{"first scrape", 1700000000, 100, ""},
+		{"unchanged", 1700000000, 100, ""},
+		{"reload keeps the pid", 1700000500, 100, RestartStartTime},
+		{"pid not visible", 1700000500, 0, ""},
+		{"new master", 1700000900, 200, RestartMasterPID},
+		{"start time without a pid", 1700001000, 0, RestartStartTime},
+	}
+
+	for _, step := range steps {
+		if got := detectRestart(socket, "www", step.startTime, step.pid); got != step.want {
+			t.Errorf("%s: expected %q, got %q", step.name, step.want, got)
+		}
+	}
+
+	counts := MasterRestarts()
+	if n := counts[RestartKey{Socket: socket, Pool: "www", Reason: RestartStartTime}]; n != 2 {
+		t.Errorf("Expected 2 start time restarts, got %d", n)
+	}
+	if n := counts[RestartKey{Socket: socket, Pool: "www", Reason: RestartMasterPID}]; n != 1 {
+		t.Errorf("Expected 1 master PID restart, got %d", n)
+	}
+}
+
+func TestDetectRestart_InitializesCounters(t *testing.T) {
+	socket := "unix:///run/restarts-init-test.sock"
+	detectRestart(socket, "www", 1700000000, 0)
+
+	counts := MasterRestarts()
+	for _, reason := range RestartReasons {
+		n, ok := counts[RestartKey{Socket: socket, Pool: "www", Reason: reason}]
+		if !ok || n != 0 {
+			t.Errorf("Expected a zero %s counter after the first scrape, got %d (%v)", reason, n, ok)
+		}
+	}
+}
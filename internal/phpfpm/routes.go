@@ -0,0 +1,98 @@
+package phpfpm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+type routeRule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// RouteNormalizer maps request URIs to low-cardinality route names.
+type RouteNormalizer struct {
+	stripQuery  bool
+	collapseIDs bool
+	rules       []routeRule
+}
+
+// NewRouteNormalizer compiles the configured rewrite rules.
+func NewRouteNormalizer(cfg config.RoutesConfig) (*RouteNormalizer, error) {
+	n := &RouteNormalizer{
+		stripQuery:  cfg.StripQuery,
+		collapseIDs: cfg.CollapseIDs,
+	}
+
+	for i, rule := range cfg.Rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route rule %d %q: %w", i, rule.Match, err)
+		}
+		n.rules = append(n.rules, routeRule{match: re, replace: rule.Replace})
+	}
+
+	return n, nil
+}
+
+// Route returns the route name of a request. Rules are applied in order to
+// the URI, then ID-like path segments are collapsed. Requests without a URI
+// fall back to the script name.
+func (n *RouteNormalizer) Route(uri, script string) string {
+	if uri == "" {
+		if script == "" {
+			return "unknown"
+		}
+		return path.Base(script)
+	}
+
+	if n.stripQuery {
+		if i := strings.IndexByte(uri, '?'); i >= 0 {
+			uri = uri[:i]
+		}
+	}
+
+	for _, rule := range n.rules {
+		uri = rule.match.ReplaceAllString(uri, rule.replace)
+	}
+
+	if n.collapseIDs {
+		uri = collapseSegments(uri)
+	}
+
+	if uri == "" {
+		return "/"
+	}
+	return uri
+}
+
+func collapseSegments(uri string) string {
+	query := ""
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		uri, query = uri[:i], uri[i:]
+	}
+
+	segments := strings.Split(uri, "/")
+	for i, seg := range segments {
+		switch {
+		case numericSegment.MatchString(seg):
+			segments[i] = ":id"
+		case uuidSegment.MatchString(seg):
+			segments[i] = ":uuid"
+		case hashSegment.MatchString(seg):
+			segments[i] = ":hash"
+		}
+	}
+
+	return strings.Join(segments, "/") + query
+}
@@ -0,0 +1,69 @@
+package phpfpm
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+func TestRouteNormalizer_Route(t *testing.T) {
+	n, err := NewRouteNormalizer(config.RoutesConfig{
+		StripQuery:  true,
+		CollapseIDs: true,
+		Rules: []config.RouteRule{
+			{Match: `^/api/v[0-9]+/`, Replace: "/api/"},
+			{Match: `^/(en|de|fr)/`, Replace: "/:lang/"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		uri    string
+		script string
+		want   string
+	}{
+		{"plain path", "/users", "", "/users"},
+		{"query stripped", "/search?q=foo&page=2", "", "/search"},
+		{"numeric id", "/users/123/posts/456", "", "/users/:id/posts/:id"},
+		{"uuid", "/orders/3f2b8c1e-9a4d-4e2f-8b1a-0c9d8e7f6a5b", "", "/orders/:uuid"},
+		{"hash", "/assets/d41d8cd98f00b204e9800998ecf8427e", "", "/assets/:hash"},
+		{"short hex kept", "/colors/fff", "", "/colors/fff"},
+		{"version rule", "/api/v2/users/7", "", "/api/users/:id"},
+		{"capture rule", "/de/products/9", "", "/:lang/products/:id"},
+		{"root", "/", "", "/"},
+		{"script fallback", "", "/var/www/html/index.php", "index.php"},
+		{"nothing known", "", "", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Route(tt.uri, tt.script); got != tt.want {
+				t.Errorf("Route(%q, %q) = %q, want %q", tt.uri, tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteNormalizer_Disabled(t *testing.T) {
+	n, err := NewRouteNormalizer(config.RoutesConfig{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Without strip_query and collapse_ids the URI is kept as is
+	if got := n.Route("/users/1?tab=2", ""); got != "/users/1?tab=2" {
+		t.Errorf("Expected URI to be unchanged, got %q", got)
+	}
+}
+
+func TestNewRouteNormalizer_InvalidRule(t *testing.T) {
+	_, err := NewRouteNormalizer(config.RoutesConfig{
+		Rules: []config.RouteRule{{Match: "(", Replace: ""}},
+	})
+	if err == nil {
+		t.Errorf("Expected error for invalid regular expression")
+	}
+}
@@ -0,0 +1,72 @@
+package phpfpm
+
+import (
+	"context"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// RuntimeStatus is PHP as seen by a worker of the pool. Unlike the FPM binary
+// on disk, it reflects the code the running master has loaded, so it stays
+// correct after an in-place upgrade that has not been reloaded yet.
+//
+// The realpath cache and garbage collector are per worker; the values are
+// those of whichever worker served the probe.
+type RuntimeStatus struct {
+	Version    string   `json:"version"`
+	Sapi       string   `json:"sapi"`
+	Extensions []string `json:"extensions"`
+
+	RealpathCacheUsed    uint64 `json:"realpath_cache_used"`    // bytes, realpath_cache_size()
+	RealpathCacheLimit   string `json:"realpath_cache_limit"`   // ini value, e.g. "4096K"
+	RealpathCacheEntries uint64 `json:"realpath_cache_entries"` // cached paths
+
+	GC *GCStatus `json:"gc,omitempty"` // nil before PHP 7.3
+}
+
+// GCStatus is the output of gc_status().
+type GCStatus struct {
+	Runs      uint64 `json:"runs"`
+	Collected uint64 `json:"collected"`
+	Threshold uint64 `json:"threshold"`
+	Roots     uint64 `json:"roots"`
+}
+
+var runtimeProbe = Probe{Name: "runtime", Script: `<?php
+error_reporting(0);
+ini_set('display_errors', 0);
+header("Status: 200 OK");
+header("Content-Type: application/json");
+$gc = function_exists('gc_status') ? gc_status() : null;
+echo json_encode([
+    'version' => PHP_VERSION,
+    'sapi' => php_sapi_name(),
+    'extensions' => get_loaded_extensions(),
+    'realpath_cache_used' => realpath_cache_size(),
+    'realpath_cache_limit' => ini_get('realpath_cache_size'),
+    'realpath_cache_entries' => count(realpath_cache_get()),
+    'gc' => $gc === null ? null : [
+        'runs' => $gc['runs'],
+        'collected' => $gc['collected'],
+        'threshold' => $gc['threshold'],
+        'roots' => $gc['roots'],
+    ],
+]);
+exit;`}
+
+// GetRuntimeStatus runs the runtime probe in the pool.
+func GetRuntimeStatus(ctx context.Context, cfg config.FPMPoolConfig) (*RuntimeStatus, error) {
+	var status RuntimeStatus
+	if err := runtimeProbe.Run(ctx, cfg, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RealpathCacheLimitBytes returns the realpath_cache_size setting in bytes.
+func (s RuntimeStatus) RealpathCacheLimitBytes() (float64, bool) {
+	if s.RealpathCacheLimit == "" {
+		return 0, false
+	}
+	return ParseIniNumber(s.RealpathCacheLimit)
+}
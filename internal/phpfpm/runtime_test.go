@@ -0,0 +1,67 @@
+package phpfpm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+)
+
+const runtimeJSON = `{
+	"version": "8.3.4",
+	"sapi": "fpm-fcgi",
+	"extensions": ["Core", "date", "json", "Zend OPcache", "apcu"],
+	"realpath_cache_used": 51200,
+	"realpath_cache_limit": "4096K",
+	"realpath_cache_entries": 120,
+	"gc": {"runs": 3, "collected": 40, "threshold": 10001, "roots": 12}
+}`
+
+func TestGetRuntimeStatus(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Status: 200 OK\r\nContent-Type: application/json\r\n\r\n" + runtimeJSON
+	})
+
+	status, err := GetRuntimeStatus(context.Background(), config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("GetRuntimeStatus failed: %v", err)
+	}
+
+	if status.Version != "8.3.4" || status.Sapi != "fpm-fcgi" {
+		t.Errorf("Expected PHP 8.3.4 on fpm-fcgi, got %s on %s", status.Version, status.Sapi)
+	}
+	if len(status.Extensions) != 5 || status.Extensions[3] != "Zend OPcache" {
+		t.Errorf("Unexpected extensions %v", status.Extensions)
+	}
+	if status.RealpathCacheUsed != 51200 || status.RealpathCacheEntries != 120 {
+		t.Errorf("Unexpected realpath cache usage %+v", status)
+	}
+	if limit, ok := status.RealpathCacheLimitBytes(); !ok || limit != 4096*1024 {
+		t.Errorf("Expected a realpath cache limit of 4 MiB, got %v (%v)", limit, ok)
+	}
+	if status.GC == nil || *status.GC != (GCStatus{Runs: 3, Collected: 40, Threshold: 10001, Roots: 12}) {
+		t.Errorf("Unexpected GC status %+v", status.GC)
+	}
+
+	if requests := fpm.Requests(); requests[0]["SCRIPT_NAME"] != "/phpeek-runtime.php" {
+		t.Errorf("Expected the runtime probe to be requested, got %v", requests[0])
+	}
+}
+
+func TestGetRuntimeStatus_WithoutGCStatus(t *testing.T) {
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-Type: application/json\r\n\r\n" + `{"version": "7.2.34", "sapi": "fpm-fcgi", "gc": null}`
+	})
+
+	status, err := GetRuntimeStatus(context.Background(), config.FPMPoolConfig{StatusSocket: fpm.Socket, ProbeDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("GetRuntimeStatus failed: %v", err)
+	}
+	if status.GC != nil {
+		t.Errorf("Expected no GC status before PHP 7.3, got %+v", status.GC)
+	}
+	if _, ok := status.RealpathCacheLimitBytes(); ok {
+		t.Errorf("Expected no realpath cache limit when it was not reported")
+	}
+}
@@ -0,0 +1,167 @@
+package phpfpm
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health score factors and the most points each can take off the score of 100.
+const (
+	FactorUtilization = "utilization"
+	FactorQueue       = "queue"
+	FactorMaxChildren = "max_children"
+
+	utilizationWeight = 40.0
+	queueWeight       = 30.0
+	maxChildrenWeight = 30.0
+
+	// maxChildrenWindow is how far back the max_children rate looks, so it
+	// does not swing with the poll interval or the timing of single polls.
+	maxChildrenWindow = time.Minute
+)
+
+// HealthFactors lists every factor of the health score.
+var HealthFactors = []string{FactorUtilization, FactorQueue, FactorMaxChildren}
+
+// Saturation holds the derived load metrics of a pool.
+type Saturation struct {
+	// Utilization is busy workers / pm.max_children, excluding the worker
+	// serving the exporter's own status request.
+	Utilization      float64 `json:"utilization"`
+	UtilizationKnown bool    `json:"utilization_known"`
+	// QueuePressure is listen queue / listen queue length.
+	QueuePressure      float64 `json:"queue_pressure"`
+	QueuePressureKnown bool    `json:"queue_pressure_known"`
+	// MaxChildrenRate is pm.max_children hits per second over the last
+	// minute, or since the first poll of the master when it is younger.
+	MaxChildrenRate      float64 `json:"max_children_rate"`
+	MaxChildrenRateKnown bool    `json:"max_children_rate_known"`
+	// Score is 100 minus the penalty of every factor.
+	Score     float64            `json:"score"`
+	Penalties map[string]float64 `json:"penalties"`
+}
+
+type maxChildrenSample struct {
+	count     int64
+	startTime int64
+	at        time.Time
+}
+
+// SaturationTracker computes Saturation per pool, remembering the
+// max_children_reached counters of the last minute to turn them into a rate.
+type SaturationTracker struct {
+	mu      sync.Mutex
+	history map[string][]maxChildrenSample // oldest first
+}
+
+func NewSaturationTracker() *SaturationTracker {
+	return &SaturationTracker{
+		history: make(map[string][]maxChildrenSample),
+	}
+}
+
+// Observe computes the saturation of pool at the time of the poll.
+func (t *SaturationTracker) Observe(key string, pool Pool, at time.Time) Saturation {
+	s := Saturation{Penalties: make(map[string]float64, len(HealthFactors))}
+
+	if maxChildren := poolMaxChildren(pool); maxChildren > 0 {
+		s.Utilization = float64(busyWorkers(pool)) / float64(maxChildren)
+		s.UtilizationKnown = true
+	}
+
+	// Unix sockets on some platforms report no queue length
+	if pool.ListenQueueLength > 0 {
+		s.QueuePressure = float64(pool.ListenQueue) / float64(pool.ListenQueueLength)
+		s.QueuePressureKnown = true
+	}
+
+	sample := maxChildrenSample{count: pool.MaxChildrenReached, startTime: pool.StartTime, at: at}
+
+	t.mu.Lock()
+	history := t.history[key]
+	// A restarted master resets the counter; start over from the new baseline
+	if n := len(history); n > 0 && (history[n-1].startTime != sample.startTime || history[n-1].count > sample.count) {
+		history = nil
+	}
+
+	// The baseline is the newest sample at least a window old, or the
+	// oldest one while the history is shorter than the window. Older
+	// samples are no longer needed.
+	base := 0
+	for i, prev := range history {
+		if at.Sub(prev.at) < maxChildrenWindow {
+			break
+		}
+		base = i
+	}
+	history = history[base:]
+
+	if len(history) > 0 {
+		if elapsed := at.Sub(history[0].at).Seconds(); elapsed > 0 {
+			s.MaxChildrenRate = float64(sample.count-history[0].count) / elapsed
+			s.MaxChildrenRateKnown = true
+		}
+	}
+	t.history[key] = append(history, sample)
+	t.mu.Unlock()
+
+	// Penalties start at 70% utilization, grow with the share of the listen
+	// queue in use and reach their maximum at one max_children hit per minute.
+	s.Penalties[FactorUtilization] = utilizationWeight * clamp((s.Utilization-0.7)/0.3)
+	s.Penalties[FactorQueue] = queueWeight * clamp(s.QueuePressure*4)
+	s.Penalties[FactorMaxChildren] = maxChildrenWeight * clamp(s.MaxChildrenRate*60)
+
+	s.Score = 100
+	for _, p := range s.Penalties {
+		s.Score -= p
+	}
+	s.Score = math.Round(s.Score*10) / 10
+
+	return s
+}
+
+// Forget drops the state of pools whose key starts with prefix.
+func (t *SaturationTracker) Forget(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.history {
+		if strings.HasPrefix(key, prefix) {
+			delete(t.history, key)
+		}
+	}
+}
+
+// poolMaxChildren returns pm.max_children from the pool config. A static pool
+// always runs exactly that many workers, so its size is used when the
+// config is not available.
+func poolMaxChildren(pool Pool) int64 {
+	if v, err := strconv.ParseInt(strings.TrimSpace(pool.Config["pm.max_children"]), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	if strings.EqualFold(pool.ProcessManager, "static") {
+		return pool.TotalProcesses
+	}
+	return 0
+}
+
+// busyWorkers counts workers serving a request other than the exporter's.
+func busyWorkers(pool Pool) int64 {
+	if len(pool.Processes) == 0 {
+		return pool.ActiveProcesses
+	}
+
+	var busy int64
+	for _, proc := range pool.Processes {
+		if !strings.EqualFold(proc.State, "idle") && !IsExporterRequest(proc, pool.Path, pool.Config["ping.path"]) {
+			busy++
+		}
+	}
+	return busy
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
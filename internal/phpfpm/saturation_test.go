@@ -0,0 +1,175 @@
+package phpfpm
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSaturationTracker_Utilization(t *testing.T) {
+	tests := []struct {
+		name  string
+		pool  Pool
+		want  float64
+		known bool
+	}{
+		{
+			name: "configured max_children",
+			pool: Pool{
+				Path:   "/status",
+				Config: map[string]string{"pm.max_children": "4"},
+				Processes: []PoolProcess{
+					{State: "Running", RequestURI: "/index.php"},
+					{State: "Running", RequestURI: "/index.php"},
+					// The worker answering the exporter is not load
+					{State: "Running", RequestURI: "/status?json&full"},
+					{State: "Idle"},
+				},
+			},
+			want:  0.5,
+			known: true,
+		},
+		{
+			name: "static pool without config",
+			pool: Pool{
+				ProcessManager:  "static",
+				TotalProcesses:  10,
+				ActiveProcesses: 3,
+			},
+			want:  0.3,
+			known: true,
+		},
+		{
+			name: "dynamic pool without config",
+			pool: Pool{
+				ProcessManager:  "dynamic",
+				TotalProcesses:  10,
+				ActiveProcesses: 3,
+			},
+			known: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSaturationTracker().Observe("pool", tt.pool, time.Now())
+			if s.UtilizationKnown != tt.known {
+				t.Fatalf("Expected utilization known=%v, got %v", tt.known, s.UtilizationKnown)
+			}
+			if s.Utilization != tt.want {
+				t.Errorf("Expected utilization %v, got %v", tt.want, s.Utilization)
+			}
+		})
+	}
+}
+
+func TestSaturationTracker_QueuePressure(t *testing.T) {
+	tracker := NewSaturationTracker()
+
+	s := tracker.Observe("a", Pool{ListenQueue: 32, ListenQueueLength: 128}, time.Now())
+	if !s.QueuePressureKnown || s.QueuePressure != 0.25 {
+		t.Errorf("Expected queue pressure 0.25, got %v (known %v)", s.QueuePressure, s.QueuePressureKnown)
+	}
+
+	// Without a queue length the pressure cannot be computed
+	s = tracker.Observe("b", Pool{ListenQueue: 3}, time.Now())
+	if s.QueuePressureKnown {
+		t.Errorf("Expected queue pressure to be unknown without queue length")
+	}
+}
+
+func TestSaturationTracker_MaxChildrenRate(t *testing.T) {
+	tracker := NewSaturationTracker()
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	s := tracker.Observe("pool", Pool{StartTime: 100, MaxChildrenReached: 5}, start)
+	if s.MaxChildrenRateKnown {
+		t.Errorf("Expected no rate on the first poll")
+	}
+
+	s = tracker.Observe("pool", Pool{StartTime: 100, MaxChildrenReached: 8}, start.Add(10*time.Second))
+	if !s.MaxChildrenRateKnown || s.MaxChildrenRate != 0.3 {
+		t.Errorf("Expected rate 0.3/s, got %v (known %v)", s.MaxChildrenRate, s.MaxChildrenRateKnown)
+	}
+
+	// A restarted master resets the counter
+	s = tracker.Observe("pool", Pool{StartTime: 200, MaxChildrenReached: 1}, start.Add(20*time.Second))
+	if s.MaxChildrenRateKnown {
+		t.Errorf("Expected no rate right after a restart, got %v", s.MaxChildrenRate)
+	}
+
+	tracker.Forget("pool")
+	s = tracker.Observe("pool", Pool{StartTime: 200, MaxChildrenReached: 2}, start.Add(30*time.Second))
+	if s.MaxChildrenRateKnown {
+		t.Errorf("Expected no rate after the pool was forgotten")
+	}
+}
+
+func TestSaturationTracker_MaxChildrenRateWindow(t *testing.T) {
+	tracker := NewSaturationTracker()
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	// One hit every 30s, polled every 10s: a rate since the previous poll
+	// would swing between 0 and 0.1/s, the window keeps it steady
+	for i := 0; i <= 18; i++ {
+		count := int64(i / 3)
+		s := tracker.Observe("pool", Pool{StartTime: 100, MaxChildrenReached: count}, start.Add(time.Duration(i)*10*time.Second))
+		if i < 6 {
+			continue
+		}
+		if !s.MaxChildrenRateKnown {
+			t.Fatalf("Expected a rate at poll %d", i)
+		}
+		if math.Abs(s.MaxChildrenRate-2.0/60) > 1e-9 {
+			t.Errorf("Expected 2 hits per minute at poll %d, got %v/s", i, s.MaxChildrenRate)
+		}
+	}
+
+	tracker.mu.Lock()
+	kept := len(tracker.history["pool"])
+	tracker.mu.Unlock()
+	if kept > 8 {
+		t.Errorf("Expected samples older than the window to be dropped, %d kept", kept)
+	}
+}
+
+func TestSaturationTracker_Score(t *testing.T) {
+	tracker := NewSaturationTracker()
+	start := time.Now()
+
+	healthy := tracker.Observe("healthy", Pool{
+		Config:            map[string]string{"pm.max_children": "10"},
+		ActiveProcesses:   2,
+		ListenQueueLength: 128,
+	}, start)
+	if healthy.Score != 100 {
+		t.Errorf("Expected a healthy pool to score 100, got %v (%v)", healthy.Score, healthy.Penalties)
+	}
+
+	tracker.Observe("saturated", Pool{MaxChildrenReached: 0}, start)
+	saturated := tracker.Observe("saturated", Pool{
+		Config:             map[string]string{"pm.max_children": "10"},
+		ActiveProcesses:    10,
+		ListenQueue:        64,
+		ListenQueueLength:  128,
+		MaxChildrenReached: 2,
+	}, start.Add(60*time.Second))
+
+	if saturated.Score != 0 {
+		t.Errorf("Expected a saturated pool to score 0, got %v (%v)", saturated.Score, saturated.Penalties)
+	}
+	for _, factor := range HealthFactors {
+		if saturated.Penalties[factor] == 0 {
+			t.Errorf("Expected factor %s to contribute a penalty", factor)
+		}
+	}
+
+	// 85% utilization is halfway between 70% and 100%
+	partial := tracker.Observe("partial", Pool{
+		Config:          map[string]string{"pm.max_children": "20"},
+		ActiveProcesses: 17,
+	}, start)
+	if math.Abs(partial.Penalties[FactorUtilization]-20) > 1e-9 || partial.Score != 80 {
+		t.Errorf("Expected utilization penalty 20 and score 80, got %v and %v", partial.Penalties[FactorUtilization], partial.Score)
+	}
+}
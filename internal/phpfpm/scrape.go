@@ -0,0 +1,153 @@
+package phpfpm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+)
+
+// Scrape stages reported in Result.Errors and the failure counters.
+const (
+	StageDial    = "dial"
+	StageRequest = "request"
+	StageParse   = "parse"
+	StageConfig  = "config"
+)
+
+// ScrapeStages lists every stage in the order a scrape goes through them.
+var ScrapeStages = []string{StageDial, StageRequest, StageParse, StageConfig}
+
+var (
+	scrapeFailuresMu sync.Mutex
+	scrapeFailures   = make(map[ScrapeFailureKey]uint64)
+
+	poolNamesMu sync.Mutex
+	poolNames   = make(map[string]string)
+)
+
+// ScrapeError is returned when a pool scrape fails at a given stage.
+type ScrapeError struct {
+	Stage string
+	Err   error
+	Ping  *PingResult // the pool's ping, which does not depend on the status page
+}
+
+func (e *ScrapeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ScrapeError) Unwrap() error {
+	return e.Err
+}
+
+// ScrapeFailureKey identifies a cumulative failure counter.
+type ScrapeFailureKey struct {
+	Socket string
+	Stage  string
+}
+
+// ScrapeFailures returns a copy of the cumulative scrape failure counters.
+func ScrapeFailures() map[ScrapeFailureKey]uint64 {
+	scrapeFailuresMu.Lock()
+	defer scrapeFailuresMu.Unlock()
+
+	out := make(map[ScrapeFailureKey]uint64, len(scrapeFailures))
+	for k, v := range scrapeFailures {
+		out[k] = v
+	}
+	return out
+}
+
+func recordScrapeFailure(poolCfg config.FPMPoolConfig, stage string) {
+	if poolCfg.Transient {
+		return
+	}
+	scrapeFailuresMu.Lock()
+	defer scrapeFailuresMu.Unlock()
+	scrapeFailures[ScrapeFailureKey{Socket: poolCfg.Socket, Stage: stage}]++
+}
+
+func scrapeFailed(poolCfg config.FPMPoolConfig, stage string, err error) *ScrapeError {
+	recordScrapeFailure(poolCfg, stage)
+	return &ScrapeError{Stage: stage, Err: err}
+}
+
+// rememberPoolName records the pool name reported by a socket so a later
+// failed scrape can still be attributed to it.
+func rememberPoolName(poolCfg config.FPMPoolConfig, name string) {
+	if poolCfg.Transient {
+		return
+	}
+	poolNamesMu.Lock()
+	defer poolNamesMu.Unlock()
+	poolNames[poolCfg.Socket] = name
+}
+
+// PoolName returns the name used for a pool whose status could not be read:
+// the configured name, the last name the socket reported, or "unknown".
+func PoolName(poolCfg config.FPMPoolConfig) string {
+	if poolCfg.Name != "" {
+		return poolCfg.Name
+	}
+
+	poolNamesMu.Lock()
+	defer poolNamesMu.Unlock()
+	if name, ok := poolNames[poolCfg.Socket]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ForgetPool drops what is kept about a pool that is no longer collected: its
+// failure and restart counters, the name its socket reported, the status hint
+// logged for it and its kept connections.
+func ForgetPool(poolCfg config.FPMPoolConfig) {
+	scrapeFailuresMu.Lock()
+	for key := range scrapeFailures {
+		if key.Socket == poolCfg.Socket {
+			delete(scrapeFailures, key)
+		}
+	}
+	scrapeFailuresMu.Unlock()
+
+	poolNamesMu.Lock()
+	delete(poolNames, poolCfg.Socket)
+	poolNamesMu.Unlock()
+
+	forgetRestarts(poolCfg.Socket)
+	forgetStatusHint(poolCfg.Socket)
+	forgetProbeWarning(poolCfg.Socket)
+	fcgiConns.forget(poolCfg.Socket)
+	if poolCfg.StatusSocket != "" {
+		fcgiConns.forget(poolCfg.StatusSocket)
+	}
+}
+
+// NewFailedResult builds the result reported for a pool that could not be
+// scraped, so the pool stays visible with its failing stage.
+func NewFailedResult(poolCfg config.FPMPoolConfig, err error) *Result {
+	stage := StageRequest
+	var scrapeErr *ScrapeError
+	if errors.As(err, &scrapeErr) {
+		stage = scrapeErr.Stage
+	}
+
+	return &Result{
+		Timestamp: time.Now(),
+		Name:      PoolName(poolCfg),
+		Errors:    map[string]string{stage: err.Error()},
+		Namespace: poolCfg.Namespace,
+		Pod:       poolCfg.Pod,
+		Ping:      pingOf(err),
+	}
+}
+
+func pingOf(err error) *PingResult {
+	var scrapeErr *ScrapeError
+	if errors.As(err, &scrapeErr) {
+		return scrapeErr.Ping
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package phpfpm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func TestScrapeError_Unwrap(t *testing.T) {
+	inner := errors.New("connection refused")
+	err := fmt.Errorf("wrapped: %w", &ScrapeError{Stage: StageDial, Err: inner})
+
+	var scrapeErr *ScrapeError
+	if !errors.As(err, &scrapeErr) {
+		t.Fatalf("Expected errors.As to find ScrapeError")
+	}
+
+	if scrapeErr.Stage != StageDial {
+		t.Errorf("Expected stage %q, got %q", StageDial, scrapeErr.Stage)
+	}
+
+	if !errors.Is(err, inner) {
+		t.Errorf("Expected ScrapeError to unwrap to the inner error")
+	}
+
+	if scrapeErr.Error() != "connection refused" {
+		t.Errorf("Expected Error() to return inner message, got %q", scrapeErr.Error())
+	}
+}
+
+func TestScrapeFailures_Cumulative(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	poolCfg := config.FPMPoolConfig{
+		Socket:       "unix:///nonexistent/scrape-failures.sock",
+		StatusSocket: "unix:///nonexistent/scrape-failures.sock",
+		StatusPath:   "/status",
+	}
+	key := ScrapeFailureKey{Socket: poolCfg.Socket, Stage: StageDial}
+	before := ScrapeFailures()[key]
+
+	for i := 0; i < 3; i++ {
+		_, err := GetMetricsForPool(context.Background(), poolCfg)
+		var scrapeErr *ScrapeError
+		if !errors.As(err, &scrapeErr) || scrapeErr.Stage != StageDial {
+			t.Fatalf("Expected dial stage ScrapeError, got %v", err)
+		}
+	}
+
+	if got := ScrapeFailures()[key] - before; got != 3 {
+		t.Errorf("Expected 3 dial failures to be counted, got %d", got)
+	}
+
+	// Returned map is a copy
+	failures := ScrapeFailures()
+	failures[key] = 0
+	if ScrapeFailures()[key] == 0 {
+		t.Errorf("Expected ScrapeFailures to return a copy")
+	}
+}
+
+func TestPoolName(t *testing.T) {
+	tests := []struct {
+		name     string
+		poolCfg  config.FPMPoolConfig
+		known    string
+		expected string
+	}{
+		{
+			name:     "configured name wins",
+			poolCfg:  config.FPMPoolConfig{Name: "www", Socket: "unix:///tmp/name-configured.sock"},
+			known:    "other",
+			expected: "www",
+		},
+		{
+			name:     "last known name",
+			poolCfg:  config.FPMPoolConfig{Socket: "unix:///tmp/name-known.sock"},
+			known:    "api",
+			expected: "api",
+		},
+		{
+			name:     "unknown",
+			poolCfg:  config.FPMPoolConfig{Socket: "unix:///tmp/name-never-seen.sock"},
+			expected: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.known != "" {
+				rememberPoolName(tt.poolCfg, tt.known)
+			}
+			if got := PoolName(tt.poolCfg); got != tt.expected {
+				t.Errorf("Expected pool name %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewFailedResult(t *testing.T) {
+	poolCfg := config.FPMPoolConfig{Name: "www", Socket: "unix:///tmp/failed.sock"}
+
+	result := NewFailedResult(poolCfg, &ScrapeError{Stage: StageParse, Err: errors.New("bad json")})
+	if result.Name != "www" {
+		t.Errorf("Expected failed result to be named after the pool, got %q", result.Name)
+	}
+	if len(result.Pools) != 0 {
+		t.Errorf("Expected failed result to have no pools")
+	}
+	if result.Errors[StageParse] != "bad json" {
+		t.Errorf("Expected parse stage error, got %v", result.Errors)
+	}
+	if result.Timestamp.IsZero() {
+		t.Errorf("Expected failed result to be timestamped")
+	}
+
+	// Errors without a stage are attributed to the request
+	result = NewFailedResult(poolCfg, errors.New("context deadline exceeded"))
+	if _, ok := result.Errors[StageRequest]; !ok {
+		t.Errorf("Expected unstaged errors to be reported as request failures, got %v", result.Errors)
+	}
+}
+
+func TestForgetPool(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, okHandler)
+	poolCfg := config.FPMPoolConfig{Socket: fpm.Socket, StatusSocket: fpm.Socket}
+
+	recordScrapeFailure(poolCfg, StageDial)
+	rememberPoolName(poolCfg, "www")
+	detectRestart(poolCfg.Socket, "www", 1, 0)
+	logStatusHint(poolCfg, StatusNoPath, StatusConfigHint(poolCfg))
+	if _, err := fcgiGet(context.Background(), poolCfg.StatusSocket, map[string]string{"SCRIPT_NAME": "/status"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	ForgetPool(poolCfg)
+
+	for key := range ScrapeFailures() {
+		if key.Socket == poolCfg.Socket {
+			t.Errorf("Expected the failure counters to be dropped, got %v", key)
+		}
+	}
+	for key := range MasterRestarts() {
+		if key.Socket == poolCfg.Socket {
+			t.Errorf("Expected the restart counters to be dropped, got %v", key)
+		}
+	}
+	if got := PoolName(poolCfg); got != "unknown" {
+		t.Errorf("Expected the reported name to be dropped, got %q", got)
+	}
+	if _, ok := ConnectionStats()[poolCfg.StatusSocket]; ok {
+		t.Errorf("Expected the connection counters to be dropped")
+	}
+	statusHintsMu.Lock()
+	_, ok := statusHints[poolCfg.Socket]
+	statusHintsMu.Unlock()
+	if ok {
+		t.Errorf("Expected the status hint to be dropped")
+	}
+}
+
+func TestGetMetricsForPool_TransientLeavesNoState(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "start time": 1700000000, "processes": [{"pid": 1, "state": "Idle"}]}`
+	})
+	poolCfg := config.FPMPoolConfig{Socket: fpm.Socket, StatusSocket: fpm.Socket, StatusPath: "/status", SkipProbes: true, Transient: true}
+
+	if _, err := GetMetricsForPool(context.Background(), poolCfg); err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+	gone := config.FPMPoolConfig{Socket: "unix://" + filepath.Join(t.TempDir(), "gone.sock"), StatusPath: "/status", SkipProbes: true, Transient: true}
+	gone.StatusSocket = gone.Socket
+	if _, err := GetMetricsForPool(context.Background(), gone); err == nil {
+		t.Fatal("Expected the scrape of a missing socket to fail")
+	}
+	// Without a status path, which would log a hint for a polled pool
+	if _, err := GetMetricsForPool(context.Background(), config.FPMPoolConfig{Socket: fpm.Socket, Transient: true}); err != nil {
+		t.Fatalf("GetMetricsForPool failed: %v", err)
+	}
+
+	for _, socket := range []string{poolCfg.Socket, gone.Socket} {
+		for key := range ScrapeFailures() {
+			if key.Socket == socket {
+				t.Errorf("Expected no failure counters, got %v", key)
+			}
+		}
+		for key := range MasterRestarts() {
+			if key.Socket == socket {
+				t.Errorf("Expected no restart counters, got %v", key)
+			}
+		}
+		if _, ok := ConnectionStats()[socket]; ok {
+			t.Errorf("Expected no connection counters for %s", socket)
+		}
+	}
+	if got := PoolName(config.FPMPoolConfig{Socket: poolCfg.Socket}); got != "unknown" {
+		t.Errorf("Expected the reported name not to be remembered, got %q", got)
+	}
+	restartsMu.Lock()
+	_, ok := masters[poolCfg.Socket]
+	restartsMu.Unlock()
+	if ok {
+		t.Errorf("Expected the master not to be remembered for restart detection")
+	}
+	statusHintsMu.Lock()
+	_, ok = statusHints[poolCfg.Socket]
+	statusHintsMu.Unlock()
+	if ok {
+		t.Errorf("Expected no status hint to be recorded")
+	}
+}
@@ -0,0 +1,106 @@
+package phpfpm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+// Reasons a pool's status page cannot be scraped, reported in
+// Result.StatusUnavailable.
+const (
+	// StatusNoPath means the pool does not set pm.status_path, so php-fpm
+	// serves no status page for it.
+	StatusNoPath = "no_status_path"
+)
+
+// StatusUnavailableReasons lists every reason a pool is reported under.
+var StatusUnavailableReasons = []string{StatusNoPath}
+
+var (
+	statusHintsMu sync.Mutex
+	statusHints   = make(map[string]string) // last hint logged, by socket
+)
+
+// StatusUnavailable returns why the pool has no status page to scrape, or ""
+// when it has one.
+func StatusUnavailable(poolCfg config.FPMPoolConfig) string {
+	if !poolCfg.StatusPathEnabled && poolCfg.StatusPath == "" {
+		return StatusNoPath
+	}
+	return ""
+}
+
+// StatusConfigHint returns the php-fpm.conf lines that give the pool a status
+// page on its own socket, or "" when it has both. Without pm.status_listen
+// the status page is served by the same workers as the traffic on listen,
+// and cannot be read while they are all busy.
+func StatusConfigHint(poolCfg config.FPMPoolConfig) string {
+	needPath := StatusUnavailable(poolCfg) != ""
+	needListen := poolCfg.StatusSocket == "" || poolCfg.StatusSocket == poolCfg.Socket
+	if !needPath && !needListen {
+		return ""
+	}
+
+	name := PoolName(poolCfg)
+	if name == "unknown" {
+		name = "www"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", name)
+	if needPath {
+		b.WriteString("pm.status_path = /status\n")
+	}
+	if needListen {
+		fmt.Fprintf(&b, "pm.status_listen = %s\n", statusListenFor(poolCfg, name))
+	}
+	return b.String()
+}
+
+// statusListenFor suggests a unix socket for pm.status_listen: next to the
+// pool's listen socket, as the master sees it, or named after the pool. A TCP
+// port is never suggested, as the next one is often another pool's listen and
+// the address of a pod changes with every restart.
+func statusListenFor(poolCfg config.FPMPoolConfig, name string) string {
+	scheme, address, _, err := ParseAddress(poolCfg.Socket, "")
+	if err != nil || scheme != "unix" {
+		return "/run/php/" + name + "-status.sock"
+	}
+	if poolCfg.Root != "" {
+		address = "/" + strings.TrimPrefix(strings.TrimPrefix(address, filepath.Clean(poolCfg.Root)), "/")
+	}
+	return strings.TrimSuffix(address, ".sock") + "-status.sock"
+}
+
+func forgetStatusHint(socket string) {
+	statusHintsMu.Lock()
+	defer statusHintsMu.Unlock()
+	delete(statusHints, socket)
+}
+
+// logStatusHint logs the pool's status config hint when it differs from the
+// one logged for its socket before, so a pool is not reported on every poll.
+// Transient scrapes log nothing.
+func logStatusHint(poolCfg config.FPMPoolConfig, reason, hint string) {
+	if poolCfg.Transient {
+		return
+	}
+	statusHintsMu.Lock()
+	changed := statusHints[poolCfg.Socket] != hint
+	statusHints[poolCfg.Socket] = hint
+	statusHintsMu.Unlock()
+
+	if !changed || hint == "" {
+		return
+	}
+	if reason != "" {
+		logging.L().Warn("PHPeek Pool has no status page, add to php-fpm.conf", "socket", poolCfg.Socket, "reason", reason, "config", hint)
+	} else {
+		logging.L().Info("PHPeek Pool status shares the listen socket with traffic, consider adding to php-fpm.conf", "socket", poolCfg.Socket, "config", hint)
+	}
+}
@@ -0,0 +1,102 @@
+package phpfpm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func TestStatusUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.FPMPoolConfig
+		expected string
+	}{
+		{"status path", config.FPMPoolConfig{StatusPath: "/status"}, ""},
+		{"enabled", config.FPMPoolConfig{StatusPath: "/status", StatusPathEnabled: true}, ""},
+		{"no status path", config.FPMPoolConfig{Socket: "unix:///run/php/www.sock"}, StatusNoPath},
+	}
+
+	for _, tt := range tests {
+		if got := StatusUnavailable(tt.cfg); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestStatusConfigHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.FPMPoolConfig
+		expected string
+	}{
+		{
+			"dedicated status listener",
+			config.FPMPoolConfig{Name: "www", Socket: "unix:///run/php/www.sock", StatusSocket: "unix:///run/php/www-status.sock", StatusPath: "/status"},
+			"",
+		},
+		{
+			"no status path",
+			config.FPMPoolConfig{Name: "www", Socket: "unix:///run/php/php8.3-fpm.sock", StatusSocket: "unix:///run/php/php8.3-fpm.sock"},
+			"[www]\npm.status_path = /status\npm.status_listen = /run/php/php8.3-fpm-status.sock\n",
+		},
+		{
+			"status on the listen socket",
+			config.FPMPoolConfig{Name: "api", Socket: "tcp://127.0.0.1:9000", StatusSocket: "tcp://127.0.0.1:9000", StatusPath: "/status"},
+			"[api]\npm.status_listen = /run/php/api-status.sock\n",
+		},
+		{
+			"pod",
+			config.FPMPoolConfig{Name: "www", Socket: "tcp://10.0.0.5:9000", StatusPath: "/status", Namespace: "shop", Pod: "web-0"},
+			"[www]\npm.status_listen = /run/php/www-status.sock\n",
+		},
+		{
+			"other root",
+			config.FPMPoolConfig{Name: "www", Socket: "unix:///proc/42/root/run/php/www.sock", StatusPath: "/status", Root: "/proc/42/root"},
+			"[www]\npm.status_listen = /run/php/www-status.sock\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := StatusConfigHint(tt.cfg); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestGetMetricsForPool_StatusUnavailable(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.Start(t, func(params map[string]string) string {
+		return "Status: 404 Not Found\r\n\r\nFile not found."
+	})
+	cfg := config.FPMPoolConfig{
+		Name:         "cron",
+		Socket:       fpm.Socket,
+		StatusSocket: fpm.Socket,
+		Discovered:   true,
+	}
+
+	result, err := GetMetricsForPool(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error for a pool without a status page, got %v", err)
+	}
+	if result.StatusUnavailable != StatusNoPath || result.Name != "cron" || len(result.Pools) != 0 {
+		t.Errorf("Expected the cron pool reported without a status page, got %+v", result)
+	}
+	if result.StatusHint == "" {
+		t.Error("Expected a config hint")
+	}
+	if n := fpm.Conns(); n != 0 {
+		t.Errorf("Expected the pool not to be scraped, got %d connections", n)
+	}
+	for key := range ScrapeFailures() {
+		if key.Socket == fpm.Socket {
+			t.Errorf("Expected no scrape failure, got %+v", key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package serve
+
+import (
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConnectionCollector exports how FastCGI connections to the status sockets
+// are opened and reused.
+type ConnectionCollector struct {
+	stats func() map[string]phpfpm.ConnStats
+
+	dialDurationDesc *prometheus.Desc
+	requestsDesc     *prometheus.Desc
+	staleDesc        *prometheus.Desc
+	idleDesc         *prometheus.Desc
+}
+
+func NewConnectionCollector() *ConnectionCollector {
+	labels := []string{"socket"}
+
+	return &ConnectionCollector{
+		stats:            phpfpm.ConnectionStats,
+		dialDurationDesc: prometheus.NewDesc("phpfpm_fcgi_dial_duration_seconds", "Time taken to open a FastCGI connection to the status socket.", labels, nil),
+		requestsDesc:     prometheus.NewDesc("phpfpm_fcgi_requests_total", "FastCGI requests sent to the status socket, by whether the connection was new or reused.", []string{"socket", "connection"}, nil),
+		staleDesc:        prometheus.NewDesc("phpfpm_fcgi_stale_connections_total", "Kept FastCGI connections found closed by PHP-FPM before they could be reused.", labels, nil),
+		idleDesc:         prometheus.NewDesc("phpfpm_fcgi_idle_connections", "FastCGI connections kept open for the next request, each holding a worker.", labels, nil),
+	}
+}
+
+func (c *ConnectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.dialDurationDesc
+	ch <- c.requestsDesc
+	ch <- c.staleDesc
+	ch <- c.idleDesc
+}
+
+func (c *ConnectionCollector) Collect(ch chan<- prometheus.Metric) {
+	for socket, stats := range c.stats() {
+		buckets := make(map[float64]uint64, len(phpfpm.DialBuckets))
+		for i, bound := range phpfpm.DialBuckets {
+			buckets[bound] = stats.DialBuckets[i]
+		}
+		ch <- prometheus.MustNewConstHistogram(c.dialDurationDesc, stats.Dials, stats.DialSeconds, buckets, socket)
+
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(stats.Requests-stats.Reused), socket, "new")
+		ch <- prometheus.MustNewConstMetric(c.requestsDesc, prometheus.CounterValue, float64(stats.Reused), socket, "reused")
+		ch <- prometheus.MustNewConstMetric(c.staleDesc, prometheus.CounterValue, float64(stats.Stale), socket)
+		ch <- prometheus.MustNewConstMetric(c.idleDesc, prometheus.GaugeValue, float64(stats.Idle), socket)
+	}
+}
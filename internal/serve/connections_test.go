@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConnectionCollector(t *testing.T) {
+	buckets := make([]uint64, len(phpfpm.DialBuckets))
+	for i, bound := range phpfpm.DialBuckets {
+		if bound >= 0.001 {
+			buckets[i] = 2
+		}
+	}
+
+	c := NewConnectionCollector()
+	c.stats = func() map[string]phpfpm.ConnStats {
+		return map[string]phpfpm.ConnStats{
+			"unix:///run/php/www.sock": {
+				Dials:       2,
+				DialSeconds: 0.0015,
+				DialBuckets: buckets,
+				Requests:    10,
+				Reused:      8,
+				Stale:       1,
+				Idle:        1,
+			},
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["socket"] != "unix:///run/php/www.sock" {
+				t.Errorf("Expected the socket label on %s, got %v", mf.GetName(), labels)
+			}
+			switch mf.GetName() {
+			case "phpfpm_fcgi_dial_duration_seconds":
+				h := m.GetHistogram()
+				values[mf.GetName()] = float64(h.GetSampleCount())
+				for _, b := range h.GetBucket() {
+					if b.GetUpperBound() == 0.0005 && b.GetCumulativeCount() != 0 {
+						t.Errorf("Expected no dials below 0.5ms, got %d", b.GetCumulativeCount())
+					}
+				}
+			case "phpfpm_fcgi_requests_total":
+				values[mf.GetName()+"/"+labels["connection"]] = m.GetCounter().GetValue()
+			case "phpfpm_fcgi_stale_connections_total":
+				values[mf.GetName()] = m.GetCounter().GetValue()
+			case "phpfpm_fcgi_idle_connections":
+				values[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"phpfpm_fcgi_dial_duration_seconds":   2,
+		"phpfpm_fcgi_requests_total/new":      2,
+		"phpfpm_fcgi_requests_total/reused":   8,
+		"phpfpm_fcgi_stale_connections_total": 1,
+		"phpfpm_fcgi_idle_connections":        1,
+	}
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (%v)", name, want, got, ok)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package serve
+
+import (
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DiscoveryCollector exports the state of continuous PHP-FPM autodiscovery.
+type DiscoveryCollector struct {
+	source *metrics.Collector
+
+	poolsDesc  *prometheus.Desc
+	errorsDesc *prometheus.Desc
+}
+
+func NewDiscoveryCollector(source *metrics.Collector) *DiscoveryCollector {
+	return &DiscoveryCollector{
+		source:     source,
+		poolsDesc:  prometheus.NewDesc("phpeek_discovered_pools", "PHP-FPM pools found by autodiscovery and being collected, not counting configured pools.", nil, nil),
+		errorsDesc: prometheus.NewDesc("phpeek_discovery_errors_total", "Autodiscovery runs that failed; the previous pools are kept.", nil, nil),
+	}
+}
+
+func (c *DiscoveryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.poolsDesc
+	ch <- c.errorsDesc
+}
+
+func (c *DiscoveryCollector) Collect(ch chan<- prometheus.Metric) {
+	status := c.source.DiscoveryStatus()
+	ch <- prometheus.MustNewConstMetric(c.poolsDesc, prometheus.GaugeValue, float64(status.Pools))
+	ch <- prometheus.MustNewConstMetric(c.errorsDesc, prometheus.CounterValue, float64(status.Errors))
+}
@@ -0,0 +1,48 @@
+package serve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDiscoveryCollector(t *testing.T) {
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled:      true,
+			Autodiscover: true,
+			Pools: []config.FPMPoolConfig{
+				{Socket: "unix:///run/static.sock"},
+				{Socket: "unix:///run/php/php8.3-fpm.sock", Discovered: true},
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDiscoveryCollector(metrics.NewCollector(cfg, time.Second)))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		if mf.GetName() == "phpeek_discovery_errors_total" {
+			values[mf.GetName()] = m.GetCounter().GetValue()
+		} else {
+			values[mf.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+
+	if v, ok := values["phpeek_discovered_pools"]; !ok || v != 1 {
+		t.Errorf("Expected one discovered pool, got %v (%v)", v, ok)
+	}
+	if v, ok := values["phpeek_discovery_errors_total"]; !ok || v != 0 {
+		t.Errorf("Expected no discovery errors, got %v (%v)", v, ok)
+	}
+}
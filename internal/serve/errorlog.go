@@ -0,0 +1,29 @@
+package serve
+
+import (
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fpmlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrorLogCollector exports the event counters of an ErrorLogMonitor.
+type ErrorLogCollector struct {
+	monitor    *fpmlog.ErrorLogMonitor
+	eventsDesc *prometheus.Desc
+}
+
+func NewErrorLogCollector(monitor *fpmlog.ErrorLogMonitor) *ErrorLogCollector {
+	return &ErrorLogCollector{
+		monitor:    monitor,
+		eventsDesc: prometheus.NewDesc("phpfpm_error_log_events_total", "Number of PHP-FPM error log events (segfault, terminated, timeout, max_children, spawn_failure).", []string{"pool", "event"}, nil),
+	}
+}
+
+func (c *ErrorLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.eventsDesc
+}
+
+func (c *ErrorLogCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, n := range c.monitor.Counts() {
+		ch <- prometheus.MustNewConstMetric(c.eventsDesc, prometheus.CounterValue, float64(n), key.Pool, key.Event)
+	}
+}
@@ -0,0 +1,55 @@
+package serve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fpmlog"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestErrorLogCollector_Collect(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	path := filepath.Join(t.TempDir(), "php-fpm.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to create error log: %v", err)
+	}
+
+	monitor := fpmlog.NewErrorLogMonitor()
+	monitor.Poll(path)
+
+	line := "[16-Oct-2026 10:06:40] WARNING: [pool www] child 1288 exited on signal 11 (SIGSEGV - core dumped) after 3.2 seconds from start\n"
+	if err := os.WriteFile(path, []byte(line+line+line), 0644); err != nil {
+		t.Fatalf("Failed to write error log: %v", err)
+	}
+	monitor.Poll(path)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewErrorLogCollector(monitor))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "phpfpm_error_log_events_total" {
+		t.Fatalf("Expected phpfpm_error_log_events_total, got %v", families)
+	}
+
+	metric := families[0].GetMetric()[0]
+	if metric.GetCounter().GetValue() != 3 {
+		t.Errorf("Expected 3 events, got %v", metric.GetCounter().GetValue())
+	}
+
+	labels := make(map[string]string)
+	for _, lp := range metric.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if labels["pool"] != "www" || labels["event"] != fpmlog.EventSegfault {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
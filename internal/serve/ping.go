@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PingHistograms records the round trip of every successful ping of a pool's
+// ping.path. Failed pings are left out: a dial refused during backoff returns
+// at once and a timed out one only measures the timeout.
+type PingHistograms struct {
+	duration *prometheus.HistogramVec
+
+	mu    sync.Mutex
+	pools map[string]string // socket -> pool name with series
+}
+
+func NewPingHistograms() *PingHistograms {
+	return &PingHistograms{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "phpfpm_ping_duration_seconds",
+			Help:                            "Round trip of successful requests to the pool's ping.path, including the dial of a new connection.",
+			Buckets:                         prometheus.ExponentialBuckets(0.00025, 2, 14),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, []string{"pool", "socket"}),
+		pools: make(map[string]string),
+	}
+}
+
+// Observe records the ping of each pool in result.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (h *PingHistograms) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	// A pool that failed its scrape or has no status page is still pinged
+	if len(result.Pools) == 0 && result.Ping != nil && result.Name != "" {
+		h.track(socket, result.Name)
+		if result.Ping.Success {
+			h.duration.WithLabelValues(result.Name, socket).Observe(result.Ping.DurationSeconds)
+		}
+	}
+	for name, pool := range result.Pools {
+		h.track(socket, name)
+
+		if pool.Ping != nil && pool.Ping.Success {
+			h.duration.WithLabelValues(name, socket).Observe(pool.Ping.DurationSeconds)
+		}
+	}
+}
+
+// track drops the series of a renamed pool instead of exporting it forever.
+func (h *PingHistograms) track(socket, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.pools[socket]; ok && old != name {
+		h.duration.DeleteLabelValues(old, socket)
+	}
+	h.pools[socket] = name
+}
+
+// Forget drops the series of a socket that is no longer collected.
+// It matches metrics.PoolRemovedListener.
+func (h *PingHistograms) Forget(socket string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.duration.DeletePartialMatch(prometheus.Labels{"socket": socket})
+	delete(h.pools, socket)
+}
+
+func (h *PingHistograms) Describe(ch chan<- *prometheus.Desc) {
+	h.duration.Describe(ch)
+}
+
+func (h *PingHistograms) Collect(ch chan<- prometheus.Metric) {
+	h.duration.Collect(ch)
+}
@@ -0,0 +1,94 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func pingResult(name string, ping *phpfpm.PingResult) *phpfpm.Result {
+	return &phpfpm.Result{
+		Pools: map[string]phpfpm.Pool{name: {Name: name, Ping: ping}},
+	}
+}
+
+func TestPingHistograms_Observe(t *testing.T) {
+	h := NewPingHistograms()
+	socket := "unix:///run/php-fpm.sock"
+
+	h.Observe(socket, pingResult("www", &phpfpm.PingResult{Success: true, DurationSeconds: 0.001}))
+	h.Observe(socket, pingResult("www", &phpfpm.PingResult{Success: true, DurationSeconds: 0.003}))
+	// Failed pings and pools without ping.path are not observed
+	h.Observe(socket, pingResult("www", &phpfpm.PingResult{DurationSeconds: 2, Error: "timeout"}))
+	h.Observe(socket, pingResult("www", nil))
+	h.Observe(socket, nil)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "phpfpm_ping_duration_seconds" {
+		t.Fatalf("Expected only phpfpm_ping_duration_seconds, got %v", families)
+	}
+	if len(families[0].GetMetric()) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(families[0].GetMetric()))
+	}
+
+	m := families[0].GetMetric()[0]
+	hist := m.GetHistogram()
+	if hist.GetSampleCount() != 2 || hist.GetSampleSum() != 0.004 {
+		t.Errorf("Expected 2 samples summing to 0.004, got %d and %v", hist.GetSampleCount(), hist.GetSampleSum())
+	}
+	labels := make(map[string]string)
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if labels["pool"] != "www" || labels["socket"] != socket {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
+
+func TestPingHistograms_RenamedPoolDropsSeries(t *testing.T) {
+	h := NewPingHistograms()
+	socket := "unix:///run/php-fpm.sock"
+
+	h.Observe(socket, pingResult("old", &phpfpm.PingResult{Success: true, DurationSeconds: 0.001}))
+	h.Observe(socket, pingResult("new", &phpfpm.PingResult{Success: true, DurationSeconds: 0.001}))
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "pool" && lp.GetValue() == "old" {
+					t.Errorf("Expected series of renamed pool to be removed")
+				}
+			}
+		}
+	}
+}
+
+func TestPingHistograms_Forget(t *testing.T) {
+	h := NewPingHistograms()
+	socket := "unix:///run/php-fpm.sock"
+
+	h.Observe(socket, pingResult("www", &phpfpm.PingResult{Success: true, DurationSeconds: 0.001}))
+	h.Forget(socket)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("Expected the removed socket's series to be dropped, got %v", families)
+	}
+}
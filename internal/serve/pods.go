@@ -0,0 +1,24 @@
+package serve
+
+import (
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+)
+
+// podRef is the Kubernetes namespace and pod a pool runs in, exported as the
+// namespace and pod labels of its metrics. Both are empty for local pools.
+type podRef struct {
+	namespace string
+	pod       string
+}
+
+// podRefs returns the pod of every socket, so metrics keyed by socket alone
+// can be labelled too. Sockets of local pools are left out.
+func podRefs(fpm map[string]*phpfpm.Result) map[string]podRef {
+	pods := make(map[string]podRef)
+	for socket, result := range fpm {
+		if result != nil && result.Pod != "" {
+			pods[socket] = podRef{namespace: result.Namespace, pod: result.Pod}
+		}
+	}
+	return pods
+}
@@ -0,0 +1,68 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheusCollector_PodLabels(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Socket:       "unix:///nonexistent/pod-pool.sock",
+					StatusSocket: "unix:///nonexistent/pod-pool.sock",
+					StatusPath:   "/status",
+					Namespace:    "shop",
+					Pod:          "web-6d9c7",
+				},
+				{
+					Socket:       "unix:///nonexistent/local-pool.sock",
+					StatusSocket: "unix:///nonexistent/local-pool.sock",
+					StatusPath:   "/status",
+				},
+			},
+		},
+	}
+
+	// The pedantic registry checks every metric against its Desc
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(NewPrometheusCollector(cfg))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	checked := 0
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+
+			switch labels["socket"] {
+			case "unix:///nonexistent/pod-pool.sock":
+				if labels["namespace"] != "shop" || labels["pod"] != "web-6d9c7" {
+					t.Errorf("Expected %s of the pod's pool to carry its pod, got %v", mf.GetName(), labels)
+				}
+				checked++
+			case "unix:///nonexistent/local-pool.sock":
+				if labels["namespace"] != "" || labels["pod"] != "" {
+					t.Errorf("Expected %s of the local pool to have an empty pod, got %v", mf.GetName(), labels)
+				}
+			}
+		}
+	}
+	if checked == 0 {
+		t.Error("Expected metrics of the pod's pool")
+	}
+}
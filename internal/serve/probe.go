@@ -0,0 +1,170 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/metrics"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultProbeModule is used when a /probe request names no module.
+const DefaultProbeModule = "fpm"
+
+// ProbeHandler serves /probe, which scrapes the FPM pool given by the target
+// parameter and responds with its metrics alone, in the manner of the
+// blackbox exporter. One exporter can so serve a fleet through Prometheus
+// relabeling. Only targets on the allowlist are scraped.
+type ProbeHandler struct {
+	cfg      *config.Config
+	networks []*net.IPNet
+	patterns []string
+}
+
+// NewProbeHandler returns a handler for cfg.Monitor.Probe. Allowed targets
+// that are not CIDRs must be valid path.Match patterns.
+func NewProbeHandler(cfg *config.Config) (*ProbeHandler, error) {
+	h := &ProbeHandler{cfg: cfg}
+	for _, entry := range cfg.Monitor.Probe.AllowedTargets {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			h.networks = append(h.networks, network)
+			continue
+		}
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, fmt.Errorf("invalid allowed target %q: %w", entry, err)
+		}
+		h.patterns = append(h.patterns, entry)
+	}
+	return h, nil
+}
+
+// Allowed reports whether target may be probed: its address is an IP in one
+// of the allowed networks, or the whole target matches an allowed pattern.
+// Host names are only matched by patterns, never resolved.
+func (h *ProbeHandler) Allowed(target string) bool {
+	for _, pattern := range h.patterns {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	scheme, address, _, err := phpfpm.ParseAddress(target, "")
+	if err != nil || scheme != "tcp" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	target := query.Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(target, "://") {
+		target = "tcp://" + target
+	}
+	if _, _, _, err := phpfpm.ParseAddress(target, ""); err != nil {
+		http.Error(w, fmt.Sprintf("invalid target: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	moduleName := query.Get("module")
+	if moduleName == "" {
+		moduleName = DefaultProbeModule
+	}
+	module, ok := h.cfg.Monitor.Probe.Modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	if !h.Allowed(target) {
+		http.Error(w, fmt.Sprintf("target %q is not allowed", target), http.StatusForbidden)
+		return
+	}
+
+	statusPath := module.StatusPath
+	if statusPath == "" {
+		statusPath = "/status"
+	}
+	// Any other path would run a PHP script of the target's choosing
+	if requested := query.Get("status_path"); requested != "" && requested != statusPath {
+		if !slices.Contains(module.AllowedStatusPaths, requested) {
+			http.Error(w, fmt.Sprintf("status_path %q is not allowed by module %q", requested, moduleName), http.StatusBadRequest)
+			return
+		}
+		statusPath = requested
+	}
+
+	// Configured the way a pool in phpfpm.pools would be
+	fpm := h.cfg.PHPFpm
+	fpm.Pools = []config.FPMPoolConfig{{
+		Socket:       target,
+		StatusSocket: target,
+		StatusPath:   statusPath,
+		Timeout:      module.Timeout,
+		SkipProbes:   !module.Probes,
+		Transient:    true,
+	}}
+	fpm.ApplyPoolDefaults()
+	poolCfg := fpm.Pools[0]
+
+	ctx, cancel := context.WithTimeout(r.Context(), phpfpm.PoolTimeout(poolCfg))
+	defer cancel()
+
+	start := time.Now()
+	result, err := phpfpm.GetMetricsForPool(ctx, poolCfg)
+	duration := time.Since(start)
+	if err != nil {
+		logging.L().Debug("PHPeek probe failed", "target", target, "module", moduleName, "error", err)
+		result = phpfpm.NewFailedResult(poolCfg, err)
+	}
+
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Whether the status page of the target could be scraped.",
+	})
+	success.Set(boolToFloat(err == nil))
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "How long the probe of the target took, in seconds.",
+	})
+	durationGauge.Set(duration.Seconds())
+
+	collector := NewPrometheusCollector(h.cfg)
+	collector.target = &metrics.Metrics{
+		Timestamp: result.Timestamp,
+		Fpm:       map[string]*phpfpm.Result{target: result},
+		Errors:    make(map[string]string),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector, success, durationGauge)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
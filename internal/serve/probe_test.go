@@ -0,0 +1,156 @@
+package serve
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fcgitest"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+)
+
+func probeConfig(allowed ...string) *config.Config {
+	return &config.Config{
+		PHPFpm: config.FPMConfig{Enabled: true, ProbeDir: "/nonexistent/phpeek"},
+		Monitor: config.MonitorConfig{
+			Probe: config.ProbeConfig{
+				Enabled:        true,
+				AllowedTargets: allowed,
+				Modules: map[string]config.ProbeModule{
+					"fpm":  {StatusPath: "/status", AllowedStatusPaths: []string{"/fpm-status"}, Timeout: time.Second},
+					"slow": {StatusPath: "/status", Timeout: 5 * time.Second, Probes: true},
+				},
+			},
+		},
+	}
+}
+
+func TestProbeHandler_Allowed(t *testing.T) {
+	h, err := NewProbeHandler(probeConfig("10.0.0.0/8", "fd00::/8", "tcp://*.web.svc:9000", "unix:///run/php/*.sock"))
+	if err != nil {
+		t.Fatalf("NewProbeHandler failed: %v", err)
+	}
+
+	tests := []struct {
+		target  string
+		allowed bool
+	}{
+		{"tcp://10.0.0.5:9000", true},
+		{"tcp://[fd00::5]:9000", true},
+		{"tcp://192.168.1.5:9000", false},
+		{"tcp://api.web.svc:9000", true},
+		{"tcp://api.web.svc:9001", false},
+		{"tcp://10.0.0.5.nip.io:9000", false},
+		{"unix:///run/php/www.sock", true},
+		{"unix:///run/php/sub/www.sock", false},
+	}
+
+	for _, tt := range tests {
+		if got := h.Allowed(tt.target); got != tt.allowed {
+			t.Errorf("Allowed(%q) = %v, expected %v", tt.target, got, tt.allowed)
+		}
+	}
+
+	if _, err := NewProbeHandler(probeConfig("tcp://[")); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	fpm := fcgitest.StartTCP(t, func(map[string]string) string {
+		return "Content-Type: application/json\r\n\r\n" + `{"pool": "www", "process manager": "dynamic", "accepted conn": 42, "processes": []}`
+	})
+	addr := fpm.Addr
+	h, err := NewProbeHandler(probeConfig("127.0.0.0/8"))
+	if err != nil {
+		t.Fatalf("NewProbeHandler failed: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?target=" + url.QueryEscape(addr) + "&status_path=/fpm-status")
+	if err != nil {
+		t.Fatalf("Failed to probe: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{
+		"probe_success 1",
+		`phpfpm_up{namespace="",pod="",pool="www",socket="tcp://` + addr + `"} 1`,
+		`phpfpm_accepted_connections{namespace="",pod="",pool="www",socket="tcp://` + addr + `"} 42`,
+		"probe_duration_seconds",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in the response:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "system_info") {
+		t.Error("Expected only the target's metrics")
+	}
+
+	// The fpm module does not run probe scripts
+	got := fpm.Requests()
+	if len(got) != 1 || got[0]["SCRIPT_NAME"] != "/fpm-status" {
+		t.Errorf("Expected only the status page to be requested, got %q", got)
+	}
+}
+
+func TestProbeHandler_Errors(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	h, err := NewProbeHandler(probeConfig("127.0.0.0/8"))
+	if err != nil {
+		t.Fatalf("NewProbeHandler failed: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	// A port nothing listens on
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		body   string
+	}{
+		{"missing target", "", http.StatusBadRequest, "target parameter is missing"},
+		{"invalid target", "target=ftp://10.0.0.1", http.StatusBadRequest, "invalid target"},
+		{"unknown module", "target=127.0.0.1:9000&module=http", http.StatusBadRequest, "unknown module"},
+		{"not allowed", "target=10.0.0.5:9000", http.StatusForbidden, "not allowed"},
+		{"script as status path", "target=127.0.0.1:9000&status_path=/var/www/app/index.php", http.StatusBadRequest, "status_path \"/var/www/app/index.php\" is not allowed"},
+		{"status path of another module", "target=127.0.0.1:9000&module=slow&status_path=/fpm-status", http.StatusBadRequest, "is not allowed"},
+		{"unreachable", "target=" + closed, http.StatusOK, "probe_success 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "?" + tt.query)
+			if err != nil {
+				t.Fatalf("Failed to probe: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.body) {
+				t.Errorf("Expected %d with %q, got %d: %s", tt.status, tt.body, resp.StatusCode, body)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fpmlog"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/kubernetes"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/metrics"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log/slog"
@@ -18,6 +21,8 @@ import (
 
 type PrometheusCollector struct {
 	cfg                     *config.Config
+	snapshots               *metrics.Collector
+	target                  *metrics.Metrics // the only metrics exported, set for /probe
 	upDesc                  *prometheus.Desc
 	acceptedConnectionsDesc *prometheus.Desc
 	startSinceDesc          *prometheus.Desc
@@ -33,6 +38,18 @@ type PrometheusCollector struct {
 	processesCpuDesc        *prometheus.Desc
 	processesMemoryDesc     *prometheus.Desc
 	memoryPeakDesc          *prometheus.Desc
+	scrapeAgeDesc           *prometheus.Desc
+	scrapeErrorDesc         *prometheus.Desc
+	scrapeFailuresDesc      *prometheus.Desc
+	masterRestartsDesc      *prometheus.Desc
+	statusUnavailableDesc   *prometheus.Desc
+	configReloadDesc        *prometheus.Desc
+	pingSuccessDesc         *prometheus.Desc
+	probeErrorDesc          *prometheus.Desc
+
+	// Capacity planning
+	recommendedMaxChildrenDesc *prometheus.Desc
+	memoryHeadroomDesc         *prometheus.Desc
 
 	// Opcache metrics
 	opcacheEnabledDesc         *prometheus.Desc
@@ -48,6 +65,51 @@ type PrometheusCollector struct {
 	opcacheHashRestartsDesc    *prometheus.Desc
 	opcacheManualRestartsDesc  *prometheus.Desc
 	opcacheHitRateDesc         *prometheus.Desc
+	opcacheCacheFullDesc       *prometheus.Desc
+	opcacheRestartPendingDesc  *prometheus.Desc
+	opcacheCachedKeysDesc      *prometheus.Desc
+	opcacheMaxCachedKeysDesc   *prometheus.Desc
+	opcacheRestartAgeDesc      *prometheus.Desc
+	opcacheInternedSizeDesc    *prometheus.Desc
+	opcacheInternedUsedDesc    *prometheus.Desc
+	opcacheInternedFreeDesc    *prometheus.Desc
+	opcacheInternedCountDesc   *prometheus.Desc
+	opcacheJITEnabledDesc      *prometheus.Desc
+	opcacheJITBufferSizeDesc   *prometheus.Desc
+	opcacheJITBufferFreeDesc   *prometheus.Desc
+	opcachePreloadScriptsDesc  *prometheus.Desc
+	opcachePreloadMemoryDesc   *prometheus.Desc
+
+	// APCu metrics
+	apcuLoadedDesc        *prometheus.Desc
+	apcuEnabledDesc       *prometheus.Desc
+	apcuHitsDesc          *prometheus.Desc
+	apcuMissesDesc        *prometheus.Desc
+	apcuInsertsDesc       *prometheus.Desc
+	apcuEntriesDesc       *prometheus.Desc
+	apcuExpungesDesc      *prometheus.Desc
+	apcuMemSizeDesc       *prometheus.Desc
+	apcuSegmentsDesc      *prometheus.Desc
+	apcuSegmentSizeDesc   *prometheus.Desc
+	apcuAvailMemoryDesc   *prometheus.Desc
+	apcuFragmentationDesc *prometheus.Desc
+
+	// Runtime of the worker that served the probe
+	realpathCacheUsedDesc    *prometheus.Desc
+	realpathCacheLimitDesc   *prometheus.Desc
+	realpathCacheEntriesDesc *prometheus.Desc
+	gcRunsDesc               *prometheus.Desc
+	gcCollectedDesc          *prometheus.Desc
+	gcThresholdDesc          *prometheus.Desc
+	gcRootsDesc              *prometheus.Desc
+
+	// php.ini values of the workers
+	phpIniValueDesc *prometheus.Desc
+	phpIniInfoDesc  *prometheus.Desc
+
+	// PHP version and extensions of each pool
+	phpInfoDesc            *prometheus.Desc
+	phpExtensionLoadedDesc *prometheus.Desc
 
 	// Pool config metrics
 	// Maximum child processes, limits concurrency and memory use
@@ -80,10 +142,13 @@ type PrometheusCollector struct {
 
 	// Laravel metrics
 	laravelInfoDesc *prometheus.Desc
+
+	// Worker /proc metrics
+	workerStats []workerStat
 }
 
 func NewPrometheusCollector(cfg *config.Config) *PrometheusCollector {
-	labels := []string{"pool", "socket"}
+	labels := []string{"pool", "socket", "namespace", "pod"}
 	return &PrometheusCollector{
 		cfg: cfg,
 		// FPM Metrics
@@ -102,6 +167,18 @@ func NewPrometheusCollector(cfg *config.Config) *PrometheusCollector {
 		processesCpuDesc:        prometheus.NewDesc("phpfpm_processes_cpu_avg", "Average CPU usage across all processes in the pool.", labels, nil),
 		processesMemoryDesc:     prometheus.NewDesc("phpfpm_processes_memory_avg", "Average memory usage across all processes in the pool.", labels, nil),
 		memoryPeakDesc:          prometheus.NewDesc("phpfpm_memory_peak", "Peak memory usage of the pool.", labels, nil),
+		scrapeAgeDesc:           prometheus.NewDesc("phpfpm_scrape_age_seconds", "Seconds since the pool's metrics were last collected.", labels, nil),
+		scrapeErrorDesc:         prometheus.NewDesc("phpfpm_scrape_error", "Whether the last scrape of the socket failed at the given stage (dial, request, parse, config).", []string{"socket", "stage", "namespace", "pod"}, nil),
+		scrapeFailuresDesc:      prometheus.NewDesc("phpfpm_scrape_failures", "The number of failures scraping from PHP-FPM, by stage.", []string{"socket", "stage", "namespace", "pod"}, nil),
+		masterRestartsDesc:      prometheus.NewDesc("phpfpm_master_restarts_total", "Restarts of the pool's master detected by the exporter, by what changed (start_time, master_pid).", []string{"pool", "socket", "reason", "namespace", "pod"}, nil),
+		statusUnavailableDesc:   prometheus.NewDesc("phpfpm_pool_status_unavailable", "Pools that are not scraped because they have no status page, by reason (no_status_path).", []string{"pool", "socket", "reason", "namespace", "pod"}, nil),
+		configReloadDesc:        prometheus.NewDesc("phpfpm_config_reload_timestamp_seconds", "Unix time the pool's master last started or reloaded its configuration.", labels, nil),
+		pingSuccessDesc:         prometheus.NewDesc("phpfpm_ping_success", "Whether the pool answered its ping.path with ping.response on the last poll (1 for yes, 0 for no).", labels, nil),
+		probeErrorDesc:          prometheus.NewDesc("phpfpm_probe_error", "Whether the probe script failed at the given stage (install, request, parse) on the last poll.", []string{"pool", "socket", "probe", "stage", "namespace", "pod"}, nil),
+
+		// Capacity planning
+		recommendedMaxChildrenDesc: prometheus.NewDesc("phpfpm_recommended_max_children", "Recommended pm.max_children from the memory limit, the pools sharing it and the p95 worker RSS.", labels, nil),
+		memoryHeadroomDesc:         prometheus.NewDesc("phpfpm_memory_headroom_bytes", "Memory left in the pool's share of the memory limit with pm.max_children workers at p95 RSS; negative when it can be exceeded.", labels, nil),
 
 		// Opcache metrics
 		opcacheEnabledDesc:         prometheus.NewDesc("phpfpm_opcache_enabled", "Whether opcache is enabled.", labels, nil),
@@ -117,6 +194,47 @@ func NewPrometheusCollector(cfg *config.Config) *PrometheusCollector {
 		opcacheHashRestartsDesc:    prometheus.NewDesc("phpfpm_opcache_hash_restarts_total", "Number of hash restarts in opcache.", labels, nil),
 		opcacheManualRestartsDesc:  prometheus.NewDesc("phpfpm_opcache_manual_restarts_total", "Number of manual restarts in opcache.", labels, nil),
 		opcacheHitRateDesc:         prometheus.NewDesc("phpfpm_opcache_hit_rate", "Opcache hit rate.", labels, nil),
+		opcacheCacheFullDesc:       prometheus.NewDesc("phpfpm_opcache_cache_full", "Whether opcache memory or keys are exhausted.", labels, nil),
+		opcacheRestartPendingDesc:  prometheus.NewDesc("phpfpm_opcache_restart_pending", "Whether an opcache restart is pending.", labels, nil),
+		opcacheCachedKeysDesc:      prometheus.NewDesc("phpfpm_opcache_cached_keys", "Number of keys in the opcache hash table.", labels, nil),
+		opcacheMaxCachedKeysDesc:   prometheus.NewDesc("phpfpm_opcache_max_cached_keys", "Maximum number of keys in the opcache hash table.", labels, nil),
+		opcacheRestartAgeDesc:      prometheus.NewDesc("phpfpm_opcache_seconds_since_restart", "Seconds since opcache was last restarted, or started.", labels, nil),
+		opcacheInternedSizeDesc:    prometheus.NewDesc("phpfpm_opcache_interned_strings_buffer_bytes", "Size of the interned strings buffer in bytes.", labels, nil),
+		opcacheInternedUsedDesc:    prometheus.NewDesc("phpfpm_opcache_interned_strings_used_bytes", "Used interned strings buffer in bytes.", labels, nil),
+		opcacheInternedFreeDesc:    prometheus.NewDesc("phpfpm_opcache_interned_strings_free_bytes", "Free interned strings buffer in bytes.", labels, nil),
+		opcacheInternedCountDesc:   prometheus.NewDesc("phpfpm_opcache_interned_strings", "Number of interned strings.", labels, nil),
+		opcacheJITEnabledDesc:      prometheus.NewDesc("phpfpm_opcache_jit_enabled", "Whether the opcache JIT is enabled.", labels, nil),
+		opcacheJITBufferSizeDesc:   prometheus.NewDesc("phpfpm_opcache_jit_buffer_bytes", "Size of the JIT buffer in bytes.", labels, nil),
+		opcacheJITBufferFreeDesc:   prometheus.NewDesc("phpfpm_opcache_jit_buffer_free_bytes", "Free JIT buffer in bytes.", labels, nil),
+		opcachePreloadScriptsDesc:  prometheus.NewDesc("phpfpm_opcache_preload_scripts", "Number of scripts preloaded by opcache.preload.", labels, nil),
+		opcachePreloadMemoryDesc:   prometheus.NewDesc("phpfpm_opcache_preload_memory_bytes", "Memory used by preloaded code in bytes.", labels, nil),
+
+		apcuLoadedDesc:        prometheus.NewDesc("phpfpm_apcu_loaded", "Whether the APCu extension is loaded in the pool.", labels, nil),
+		apcuEnabledDesc:       prometheus.NewDesc("phpfpm_apcu_enabled", "Whether APCu is enabled in the pool.", labels, nil),
+		apcuHitsDesc:          prometheus.NewDesc("phpfpm_apcu_hits_total", "Total number of APCu hits.", labels, nil),
+		apcuMissesDesc:        prometheus.NewDesc("phpfpm_apcu_misses_total", "Total number of APCu misses.", labels, nil),
+		apcuInsertsDesc:       prometheus.NewDesc("phpfpm_apcu_inserts_total", "Total number of APCu inserts.", labels, nil),
+		apcuEntriesDesc:       prometheus.NewDesc("phpfpm_apcu_entries", "Number of entries in the APCu cache.", labels, nil),
+		apcuExpungesDesc:      prometheus.NewDesc("phpfpm_apcu_expunges_total", "Number of times the APCu cache was expunged.", labels, nil),
+		apcuMemSizeDesc:       prometheus.NewDesc("phpfpm_apcu_used_memory_bytes", "Memory used by APCu entries in bytes.", labels, nil),
+		apcuSegmentsDesc:      prometheus.NewDesc("phpfpm_apcu_segments", "Number of APCu shared memory segments.", labels, nil),
+		apcuSegmentSizeDesc:   prometheus.NewDesc("phpfpm_apcu_segment_size_bytes", "Size of each APCu shared memory segment in bytes.", labels, nil),
+		apcuAvailMemoryDesc:   prometheus.NewDesc("phpfpm_apcu_available_memory_bytes", "Free APCu shared memory in bytes.", labels, nil),
+		apcuFragmentationDesc: prometheus.NewDesc("phpfpm_apcu_fragmentation_ratio", "Share of free APCu memory in blocks smaller than 5 MiB.", labels, nil),
+
+		realpathCacheUsedDesc:    prometheus.NewDesc("phpfpm_realpath_cache_used_bytes", "Realpath cache in use by a worker, in bytes.", labels, nil),
+		realpathCacheLimitDesc:   prometheus.NewDesc("phpfpm_realpath_cache_limit_bytes", "The realpath_cache_size setting in bytes.", labels, nil),
+		realpathCacheEntriesDesc: prometheus.NewDesc("phpfpm_realpath_cache_entries", "Paths in the realpath cache of a worker.", labels, nil),
+		gcRunsDesc:               prometheus.NewDesc("phpfpm_gc_runs", "Garbage collector runs in a worker since it started.", labels, nil),
+		gcCollectedDesc:          prometheus.NewDesc("phpfpm_gc_collected", "Cycles collected in a worker since it started.", labels, nil),
+		gcThresholdDesc:          prometheus.NewDesc("phpfpm_gc_threshold", "Roots that trigger the next garbage collector run in a worker.", labels, nil),
+		gcRootsDesc:              prometheus.NewDesc("phpfpm_gc_roots", "Possible roots in the garbage collector buffer of a worker.", labels, nil),
+
+		phpIniValueDesc: prometheus.NewDesc("php_ini_value", "Effective numeric php.ini value in the pool's workers, with sizes in bytes and booleans as 0 or 1.", []string{"pool", "socket", "directive", "namespace", "pod"}, nil),
+		phpIniInfoDesc:  prometheus.NewDesc("php_ini_info", "Effective php.ini value in the pool's workers that is not numeric.", []string{"pool", "socket", "directive", "value", "namespace", "pod"}, nil),
+
+		phpInfoDesc:            prometheus.NewDesc("php_info", "PHP version and SAPI of the pool, always 1. The SAPI is empty when read from the binary.", []string{"pool", "socket", "version", "sapi", "namespace", "pod"}, nil),
+		phpExtensionLoadedDesc: prometheus.NewDesc("php_extension_loaded", "PHP extension loaded in the pool, always 1.", []string{"pool", "socket", "extension", "namespace", "pod"}, nil),
 
 		// Pool config metrics
 		pmMaxChildrenConfigDesc:           prometheus.NewDesc("phpfpm_pm_max_children_config", "PHP-FPM pool config: max children. Maximum child processes, limits concurrency and memory use.", labels, nil),
@@ -138,6 +256,8 @@ func NewPrometheusCollector(cfg *config.Config) *PrometheusCollector {
 
 		// Laravel Metrics
 		laravelInfoDesc: prometheus.NewDesc("laravel_app_info", "Basic information about Laravel site", []string{"site", "version", "php_version", "environment", "debug_mode"}, nil),
+
+		workerStats: newWorkerStats(),
 	}
 }
 
@@ -158,6 +278,18 @@ func (pc *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.processesCpuDesc
 	ch <- pc.processesMemoryDesc
 	ch <- pc.memoryPeakDesc
+	ch <- pc.scrapeAgeDesc
+	ch <- pc.scrapeErrorDesc
+	ch <- pc.scrapeFailuresDesc
+	ch <- pc.masterRestartsDesc
+	ch <- pc.statusUnavailableDesc
+	ch <- pc.configReloadDesc
+	ch <- pc.pingSuccessDesc
+	ch <- pc.probeErrorDesc
+
+	// Capacity planning
+	ch <- pc.recommendedMaxChildrenDesc
+	ch <- pc.memoryHeadroomDesc
 
 	// Opcache metrics
 	ch <- pc.opcacheEnabledDesc
@@ -173,6 +305,43 @@ func (pc *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.opcacheHashRestartsDesc
 	ch <- pc.opcacheManualRestartsDesc
 	ch <- pc.opcacheHitRateDesc
+	ch <- pc.opcacheCacheFullDesc
+	ch <- pc.opcacheRestartPendingDesc
+	ch <- pc.opcacheCachedKeysDesc
+	ch <- pc.opcacheMaxCachedKeysDesc
+	ch <- pc.opcacheRestartAgeDesc
+	ch <- pc.opcacheInternedSizeDesc
+	ch <- pc.opcacheInternedUsedDesc
+	ch <- pc.opcacheInternedFreeDesc
+	ch <- pc.opcacheInternedCountDesc
+	ch <- pc.opcacheJITEnabledDesc
+	ch <- pc.opcacheJITBufferSizeDesc
+	ch <- pc.opcacheJITBufferFreeDesc
+	ch <- pc.opcachePreloadScriptsDesc
+	ch <- pc.opcachePreloadMemoryDesc
+	ch <- pc.apcuLoadedDesc
+	ch <- pc.apcuEnabledDesc
+	ch <- pc.apcuHitsDesc
+	ch <- pc.apcuMissesDesc
+	ch <- pc.apcuInsertsDesc
+	ch <- pc.apcuEntriesDesc
+	ch <- pc.apcuExpungesDesc
+	ch <- pc.apcuMemSizeDesc
+	ch <- pc.apcuSegmentsDesc
+	ch <- pc.apcuSegmentSizeDesc
+	ch <- pc.apcuAvailMemoryDesc
+	ch <- pc.apcuFragmentationDesc
+	ch <- pc.realpathCacheUsedDesc
+	ch <- pc.realpathCacheLimitDesc
+	ch <- pc.realpathCacheEntriesDesc
+	ch <- pc.gcRunsDesc
+	ch <- pc.gcCollectedDesc
+	ch <- pc.gcThresholdDesc
+	ch <- pc.gcRootsDesc
+	ch <- pc.phpIniValueDesc
+	ch <- pc.phpIniInfoDesc
+	ch <- pc.phpInfoDesc
+	ch <- pc.phpExtensionLoadedDesc
 
 	// FPM Config
 	ch <- pc.pmMaxChildrenConfigDesc
@@ -193,6 +362,14 @@ func (pc *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.memoryLimitMBDesc
 
 	ch <- pc.laravelInfoDesc
+
+	// Worker /proc metrics
+	for _, stat := range pc.workerStats {
+		ch <- stat.desc
+		if pc.cfg.PHPFpm.ProcessDetail && stat.pidDesc != nil {
+			ch <- stat.pidDesc
+		}
+	}
 }
 
 func parseConfigValue(val string) (float64, bool) {
@@ -207,19 +384,46 @@ func parseConfigValue(val string) (float64, bool) {
 	return f, true
 }
 
-func (pc *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+// UseSnapshots makes Collect serve the latest snapshot of a background
+// collector instead of scraping PHP-FPM and Laravel on every request.
+func (pc *PrometheusCollector) UseSnapshots(c *metrics.Collector) {
+	pc.snapshots = c
+}
+
+func (pc *PrometheusCollector) getMetrics() (*metrics.Metrics, error) {
+	if pc.target != nil {
+		return pc.target, nil
+	}
+	if pc.snapshots != nil {
+		return pc.snapshots.Snapshot(), nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	m, err := metrics.GetMetrics(ctx, pc.cfg)
+	return metrics.GetMetrics(ctx, pc.cfg)
+}
+
+// exports reports whether the counters of socket belong in the output. A
+// /probe response only carries those of its target.
+func (pc *PrometheusCollector) exports(m *metrics.Metrics, socket string) bool {
+	if pc.target == nil {
+		return true
+	}
+	_, ok := m.Fpm[socket]
+	return ok
+}
+
+func (pc *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	m, err := pc.getMetrics()
 	if err != nil {
-		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "unknown", "unknown")
-		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc("phpfpm_scrape_failures", "The number of failures scraping from PHP-FPM.", nil, nil),
-			prometheus.CounterValue, 1)
+		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "unknown", "unknown", "", "")
 		return
 	}
 
+	// Pools found in Kubernetes are told apart by their pod
+	pods := podRefs(m.Fpm)
+
 	if m.Server != nil {
 		nodeType := string(m.Server.NodeType)
 		ch <- prometheus.MustNewConstMetric(pc.systemInfoDesc, prometheus.GaugeValue, 1, nodeType, m.Server.OS, m.Server.Architecture)
@@ -381,126 +585,217 @@ func (pc *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 
+	for key, count := range phpfpm.ScrapeFailures() {
+		if !pc.exports(m, key.Socket) {
+			continue
+		}
+		ref := pods[key.Socket]
+		socket := key.Socket
+		if socket == "" {
+			socket = "unknown"
+		}
+		ch <- prometheus.MustNewConstMetric(pc.scrapeFailuresDesc, prometheus.CounterValue, float64(count), socket, key.Stage, ref.namespace, ref.pod)
+	}
+
+	for key, count := range phpfpm.MasterRestarts() {
+		if !pc.exports(m, key.Socket) {
+			continue
+		}
+		ref := pods[key.Socket]
+		ch <- prometheus.MustNewConstMetric(pc.masterRestartsDesc, prometheus.CounterValue, float64(count), key.Pool, key.Socket, key.Reason, ref.namespace, ref.pod)
+	}
+
 	if m.Fpm == nil {
-		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "unknown", "unknown")
+		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "unknown", "unknown", "", "")
 		return
 	}
 	if len(m.Fpm) == 0 {
-		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "none", "none")
+		ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, "none", "none", "", "")
 		return
 	}
+	if m.Server != nil {
+		for _, plan := range phpfpm.PlanCapacity(m.Server.MemoryLimitMB, m.Fpm) {
+			if plan.Recommended == 0 {
+				continue
+			}
+			ref := pods[plan.Socket]
+			ch <- prometheus.MustNewConstMetric(pc.recommendedMaxChildrenDesc, prometheus.GaugeValue, float64(plan.Recommended), plan.Pool, plan.Socket, ref.namespace, ref.pod)
+			if plan.HeadroomKnown {
+				ch <- prometheus.MustNewConstMetric(pc.memoryHeadroomDesc, prometheus.GaugeValue, float64(plan.Headroom), plan.Pool, plan.Socket, ref.namespace, ref.pod)
+			}
+		}
+	}
+
 	for socket, pools := range m.Fpm {
+		ref := pods[socket]
 		if socket == "" {
 			socket = "unknown"
 		}
 
+		for _, stage := range phpfpm.ScrapeStages {
+			_, failed := pools.Errors[stage]
+			ch <- prometheus.MustNewConstMetric(pc.scrapeErrorDesc, prometheus.GaugeValue, boolToFloat(failed), socket, stage, ref.namespace, ref.pod)
+		}
+
+		// A failed scrape has no pool data, but the pool must stay visible
+		if len(pools.Pools) == 0 {
+			poolName := pools.Name
+			if poolName == "" {
+				poolName = "unknown"
+			}
+			if pools.Ping != nil {
+				ch <- prometheus.MustNewConstMetric(pc.pingSuccessDesc, prometheus.GaugeValue, boolToFloat(pools.Ping.Success), poolName, socket, ref.namespace, ref.pod)
+			}
+			// Not down, only invisible; phpfpm_up would page for it
+			if pools.StatusUnavailable != "" {
+				ch <- prometheus.MustNewConstMetric(pc.statusUnavailableDesc, prometheus.GaugeValue, 1, poolName, socket, pools.StatusUnavailable, ref.namespace, ref.pod)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, 0, poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.scrapeAgeDesc, prometheus.GaugeValue, time.Since(pools.Timestamp).Seconds(), poolName, socket, ref.namespace, ref.pod)
+			continue
+		}
+
 		for poolName, pool := range pools.Pools {
 			up := 1.0
 
-			ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, up, poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.acceptedConnectionsDesc, prometheus.CounterValue, float64(pool.AcceptedConnections), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.startSinceDesc, prometheus.GaugeValue, float64(pool.StartSince), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.listenQueueDesc, prometheus.GaugeValue, float64(pool.ListenQueue), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.maxListenQueueDesc, prometheus.GaugeValue, float64(pool.MaxListenQueue), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.listenQueueLengthDesc, prometheus.GaugeValue, float64(pool.ListenQueueLength), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.idleProcessesDesc, prometheus.GaugeValue, float64(pool.IdleProcesses), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.activeProcessesDesc, prometheus.GaugeValue, float64(pool.ActiveProcesses), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.totalProcessesDesc, prometheus.GaugeValue, float64(pool.TotalProcesses), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.maxActiveProcessesDesc, prometheus.GaugeValue, float64(pool.MaxActiveProcesses), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.maxChildrenReachedDesc, prometheus.CounterValue, float64(pool.MaxChildrenReached), poolName, socket)
-			ch <- prometheus.MustNewConstMetric(pc.slowRequestsDesc, prometheus.CounterValue, float64(pool.SlowRequests), poolName, socket)
+			ch <- prometheus.MustNewConstMetric(pc.upDesc, prometheus.GaugeValue, up, poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.scrapeAgeDesc, prometheus.GaugeValue, time.Since(pools.Timestamp).Seconds(), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.acceptedConnectionsDesc, prometheus.CounterValue, float64(pool.AcceptedConnections), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.startSinceDesc, prometheus.GaugeValue, float64(pool.StartSince), poolName, socket, ref.namespace, ref.pod)
+			if pool.StartTime > 0 {
+				ch <- prometheus.MustNewConstMetric(pc.configReloadDesc, prometheus.GaugeValue, float64(pool.StartTime), poolName, socket, ref.namespace, ref.pod)
+			}
+			if pool.Ping != nil {
+				ch <- prometheus.MustNewConstMetric(pc.pingSuccessDesc, prometheus.GaugeValue, boolToFloat(pool.Ping.Success), poolName, socket, ref.namespace, ref.pod)
+			}
+			if pool.ProbeErrors != nil {
+				for _, probe := range phpfpm.ProbeNames {
+					for _, stage := range phpfpm.ProbeStages {
+						ch <- prometheus.MustNewConstMetric(pc.probeErrorDesc, prometheus.GaugeValue, boolToFloat(pool.ProbeErrors[probe] == stage), poolName, socket, probe, stage, ref.namespace, ref.pod)
+					}
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(pc.listenQueueDesc, prometheus.GaugeValue, float64(pool.ListenQueue), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.maxListenQueueDesc, prometheus.GaugeValue, float64(pool.MaxListenQueue), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.listenQueueLengthDesc, prometheus.GaugeValue, float64(pool.ListenQueueLength), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.idleProcessesDesc, prometheus.GaugeValue, float64(pool.IdleProcesses), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.activeProcessesDesc, prometheus.GaugeValue, float64(pool.ActiveProcesses), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.totalProcessesDesc, prometheus.GaugeValue, float64(pool.TotalProcesses), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.maxActiveProcessesDesc, prometheus.GaugeValue, float64(pool.MaxActiveProcesses), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.maxChildrenReachedDesc, prometheus.CounterValue, float64(pool.MaxChildrenReached), poolName, socket, ref.namespace, ref.pod)
+			ch <- prometheus.MustNewConstMetric(pc.slowRequestsDesc, prometheus.CounterValue, float64(pool.SlowRequests), poolName, socket, ref.namespace, ref.pod)
 
 			// --- New pool metrics ---
-			ch <- prometheus.MustNewConstMetric(pc.memoryPeakDesc, prometheus.GaugeValue, float64(pool.MemoryPeak), poolName, socket)
+			ch <- prometheus.MustNewConstMetric(pc.memoryPeakDesc, prometheus.GaugeValue, float64(pool.MemoryPeak), poolName, socket, ref.namespace, ref.pod)
 			if pool.ProcessesCpu != nil {
-				ch <- prometheus.MustNewConstMetric(pc.processesCpuDesc, prometheus.GaugeValue, *pool.ProcessesCpu, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.processesCpuDesc, prometheus.GaugeValue, *pool.ProcessesCpu, poolName, socket, ref.namespace, ref.pod)
 			}
 			if pool.ProcessesMemory != nil {
-				ch <- prometheus.MustNewConstMetric(pc.processesMemoryDesc, prometheus.GaugeValue, *pool.ProcessesMemory, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.processesMemoryDesc, prometheus.GaugeValue, *pool.ProcessesMemory, poolName, socket, ref.namespace, ref.pod)
 			}
 
 			// --- Per-process metrics ---
 			for _, proc := range pool.Processes {
-				labels := []string{poolName, socket, strconv.Itoa(proc.PID)}
+				labels := []string{poolName, socket, strconv.Itoa(proc.PID), ref.namespace, ref.pod}
 
 				// Process state as labeled metric (e.g. Idle, Running)
 				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc("phpfpm_process_state", "The state of the process (Idle, Running, ...).", []string{"pool", "socket", "pid", "state"}, nil),
-					prometheus.GaugeValue, 1, poolName, socket, strconv.Itoa(proc.PID), proc.State)
+					prometheus.NewDesc("phpfpm_process_state", "The state of the process (Idle, Running, ...).", []string{"pool", "socket", "pid", "state", "namespace", "pod"}, nil),
+					prometheus.GaugeValue, 1, poolName, socket, strconv.Itoa(proc.PID), proc.State, ref.namespace, ref.pod)
 
 				// Process request count
 				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc("phpfpm_process_requests", "The number of requests the process has served.", []string{"pool", "socket", "pid"}, nil),
+					prometheus.NewDesc("phpfpm_process_requests", "The number of requests the process has served.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
 					prometheus.CounterValue, float64(proc.Requests), labels...)
 
 				// Last request duration
 				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc("phpfpm_process_request_duration", "The duration in microseconds of the last request.", []string{"pool", "socket", "pid"}, nil),
+					prometheus.NewDesc("phpfpm_process_request_duration", "The duration in microseconds of the last request.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
 					prometheus.GaugeValue, float64(proc.RequestDuration), labels...)
 
 				// Last request memory
 				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc("phpfpm_process_last_request_memory", "The max amount of memory the last request consumed.", []string{"pool", "socket", "pid"}, nil),
+					prometheus.NewDesc("phpfpm_process_last_request_memory", "The max amount of memory the last request consumed.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
 					prometheus.GaugeValue, float64(proc.LastRequestMemory), labels...)
 
 				// Last request CPU
 				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc("phpfpm_process_last_request_cpu", "The %cpu the last request consumed.", []string{"pool", "socket", "pid"}, nil),
+					prometheus.NewDesc("phpfpm_process_last_request_cpu", "The %cpu the last request consumed.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
 					prometheus.GaugeValue, proc.LastRequestCPU, labels...)
+
+				// Current RSS, only known when the worker is visible in /proc
+				if proc.Proc != nil {
+					ch <- prometheus.MustNewConstMetric(
+						prometheus.NewDesc("phpfpm_process_current_rss", "The resident set size of the process in bytes.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
+						prometheus.GaugeValue, float64(proc.CurrentRSS), labels...)
+				}
 			}
 
+			collectWorkerStats(ch, pc.workerStats, poolName, socket, ref, pool, pc.cfg.PHPFpm.ProcessDetail)
+
 			// Opcache metrics
-			ch <- prometheus.MustNewConstMetric(pc.opcacheEnabledDesc, prometheus.GaugeValue, boolToFloat(pool.OpcacheStatus.Enabled), poolName, socket)
+			ch <- prometheus.MustNewConstMetric(pc.opcacheEnabledDesc, prometheus.GaugeValue, boolToFloat(pool.OpcacheStatus.Enabled), poolName, socket, ref.namespace, ref.pod)
 			if pool.OpcacheStatus.Enabled {
-				ch <- prometheus.MustNewConstMetric(pc.opcacheUsedMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.UsedMemory), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheFreeMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.FreeMemory), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheWastedMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.WastedMemory), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheWastedPercentDesc, prometheus.GaugeValue, pool.OpcacheStatus.MemoryUsage.CurrentWastedPct, poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheCachedScriptsDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.Statistics.NumCachedScripts), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheHitsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.Hits), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheMissesDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.Misses), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheBlacklistMissesDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.BlacklistMisses), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheOomRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.OomRestarts), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheHashRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.HashRestarts), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheManualRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.ManualRestarts), poolName, socket)
-				ch <- prometheus.MustNewConstMetric(pc.opcacheHitRateDesc, prometheus.GaugeValue, pool.OpcacheStatus.Statistics.HitRate, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheUsedMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.UsedMemory), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheFreeMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.FreeMemory), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheWastedMemoryDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.MemoryUsage.WastedMemory), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheWastedPercentDesc, prometheus.GaugeValue, pool.OpcacheStatus.MemoryUsage.CurrentWastedPct, poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheCachedScriptsDesc, prometheus.GaugeValue, float64(pool.OpcacheStatus.Statistics.NumCachedScripts), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheHitsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.Hits), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheMissesDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.Misses), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheBlacklistMissesDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.BlacklistMisses), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheOomRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.OomRestarts), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheHashRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.HashRestarts), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheManualRestartsDesc, prometheus.CounterValue, float64(pool.OpcacheStatus.Statistics.ManualRestarts), poolName, socket, ref.namespace, ref.pod)
+				ch <- prometheus.MustNewConstMetric(pc.opcacheHitRateDesc, prometheus.GaugeValue, pool.OpcacheStatus.Statistics.HitRate, poolName, socket, ref.namespace, ref.pod)
+				pc.collectOpcacheDetail(ch, pool.OpcacheStatus, poolName, socket, ref, time.Now())
 			}
 
+			if pool.Apcu != nil {
+				pc.collectApcu(ch, pool.Apcu, poolName, socket, ref)
+			}
+			if pool.Runtime != nil {
+				pc.collectRuntime(ch, pool.Runtime, poolName, socket, ref)
+			}
+			pc.collectIni(ch, pool.Ini, poolName, socket, ref)
+			pc.collectPHPInfo(ch, pool.PhpInfo, poolName, socket, ref)
+
 			// Pool config metrics
 			cfg := pool.Config
 
 			if v, ok := parseConfigValue(cfg["pm.max_children"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmMaxChildrenConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmMaxChildrenConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.start_servers"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmStartServersConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmStartServersConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.min_spare_servers"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmMinSpareServersConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmMinSpareServersConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.max_spare_servers"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmMaxSpareServersConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmMaxSpareServersConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.max_requests"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmMaxRequestsConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmMaxRequestsConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.max_spawn_rate"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmMaxSpawnRateConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmMaxSpawnRateConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["pm.process_idle_timeout"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.pmProcessIdleTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.pmProcessIdleTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["request_slowlog_timeout"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.requestSlowlogTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.requestSlowlogTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["request_terminate_timeout"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.requestTerminateTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.requestTerminateTimeoutConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["rlimit_core"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.rlimitCoreConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.rlimitCoreConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 			if v, ok := parseConfigValue(cfg["rlimit_files"]); ok {
-				ch <- prometheus.MustNewConstMetric(pc.rlimitFilesConfigDesc, prometheus.GaugeValue, v, poolName, socket)
+				ch <- prometheus.MustNewConstMetric(pc.rlimitFilesConfigDesc, prometheus.GaugeValue, v, poolName, socket, ref.namespace, ref.pod)
 			}
 		}
 	}
@@ -514,24 +809,95 @@ func boolToFloat(b bool) float64 {
 }
 
 func StartPrometheusServer(cfg *config.Config) {
-	mux := http.NewServeMux()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := metrics.NewCollector(cfg, cfg.PHPFpm.PollInterval)
+	requests := NewRequestHistograms()
+	source.AddPoolListener(requests.Observe)
+	source.AddPoolRemovedListener(requests.Forget)
+
+	pings := NewPingHistograms()
+	source.AddPoolListener(pings.Observe)
+	source.AddPoolRemovedListener(pings.Forget)
+
+	saturation := NewSaturationCollector()
+	source.AddPoolListener(saturation.Observe)
+	source.AddPoolRemovedListener(saturation.Forget)
 
 	registry := prometheus.NewRegistry()
+
+	if cfg.PHPFpm.Routes.Enabled {
+		routes, err := NewRouteMetrics(cfg.PHPFpm.Routes)
+		if err != nil {
+			logging.L().Error("PHPeek Route metrics disabled", slog.Any("err", err))
+		} else {
+			source.AddPoolListener(routes.Observe)
+			source.AddPoolRemovedListener(routes.Forget)
+			registry.MustRegister(routes)
+		}
+	}
+
+	var slowlog *fpmlog.SlowlogMonitor
+	if cfg.PHPFpm.Logs.Slowlog {
+		slowlog = fpmlog.NewSlowlogMonitor(cfg.PHPFpm.Logs.SlowlogRecent)
+		source.AddPoolListener(slowlog.Observe)
+		source.AddPoolRemovedListener(slowlog.Forget)
+		registry.MustRegister(NewSlowlogCollector(slowlog))
+	}
+
+	podDiscovery := false
+	if cfg.PHPFpm.Enabled && cfg.PHPFpm.Kubernetes.Enabled {
+		pods, err := kubernetes.NewDiscoverer(cfg.PHPFpm.Kubernetes)
+		if err != nil {
+			logging.L().Error("PHPeek Kubernetes discovery disabled", slog.Any("err", err))
+		} else {
+			source.SetPodDiscovery(pods.Discover)
+			podDiscovery = true
+		}
+	}
+
+	if cfg.PHPFpm.Enabled && (cfg.PHPFpm.Autodiscover || podDiscovery) {
+		registry.MustRegister(NewDiscoveryCollector(source))
+	}
+
+	if cfg.PHPFpm.Logs.ErrorLog {
+		errorLog := fpmlog.NewErrorLogMonitor()
+		source.AddPoolListener(errorLog.Observe)
+		source.AddPoolRemovedListener(errorLog.Forget)
+		registry.MustRegister(NewErrorLogCollector(errorLog))
+	}
+
+	source.Start(ctx)
+	defer source.Stop()
+
+	mux := http.NewServeMux()
+
+	if slowlog != nil {
+		mux.HandleFunc("/slowlog", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(slowlog.Recent())
+		})
+	}
+
 	collector := NewPrometheusCollector(cfg)
-	registry.MustRegister(collector)
+	collector.UseSnapshots(source)
+	registry.MustRegister(collector, requests, pings, saturation, NewConnectionCollector())
 
 	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
+	if cfg.Monitor.Probe.Enabled {
+		probe, err := NewProbeHandler(cfg)
+		if err != nil {
+			logging.L().Error("PHPeek /probe disabled", slog.Any("err", err))
+		} else {
+			mux.Handle("/probe", probe)
+		}
+	}
+
 	if cfg.Monitor.EnableJson {
 		mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
-			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-			defer cancel()
-
-			m, err := metrics.GetMetrics(ctx, cfg)
-			if err != nil {
-				http.Error(w, "failed to get metrics: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
+			m := source.Snapshot()
 
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(m)
@@ -548,3 +914,103 @@ func StartPrometheusServer(cfg *config.Config) {
 		logging.L().Error("PHPeek Failed to start Prometheus server", slog.Any("err", err))
 	}
 }
+
+// collectOpcacheDetail emits the opcache buffers, keys and restart age.
+// JIT and preload metrics are only emitted when PHP reports them.
+func (pc *PrometheusCollector) collectOpcacheDetail(ch chan<- prometheus.Metric, status phpfpm.OpcacheStatus, poolName, socket string, ref podRef, now time.Time) {
+	ch <- prometheus.MustNewConstMetric(pc.opcacheCacheFullDesc, prometheus.GaugeValue, boolToFloat(status.CacheFull), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheRestartPendingDesc, prometheus.GaugeValue, boolToFloat(status.RestartPending), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheCachedKeysDesc, prometheus.GaugeValue, float64(status.Statistics.NumCachedKeys), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheMaxCachedKeysDesc, prometheus.GaugeValue, float64(status.Statistics.MaxCachedKeys), poolName, socket, ref.namespace, ref.pod)
+	if age, ok := status.SecondsSinceRestart(now); ok {
+		ch <- prometheus.MustNewConstMetric(pc.opcacheRestartAgeDesc, prometheus.GaugeValue, age, poolName, socket, ref.namespace, ref.pod)
+	}
+
+	ch <- prometheus.MustNewConstMetric(pc.opcacheInternedSizeDesc, prometheus.GaugeValue, float64(status.InternedStrings.BufferSize), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheInternedUsedDesc, prometheus.GaugeValue, float64(status.InternedStrings.UsedMemory), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheInternedFreeDesc, prometheus.GaugeValue, float64(status.InternedStrings.FreeMemory), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.opcacheInternedCountDesc, prometheus.GaugeValue, float64(status.InternedStrings.NumberOfStrings), poolName, socket, ref.namespace, ref.pod)
+
+	if status.JIT != nil {
+		ch <- prometheus.MustNewConstMetric(pc.opcacheJITEnabledDesc, prometheus.GaugeValue, boolToFloat(status.JIT.Enabled && status.JIT.On), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.opcacheJITBufferSizeDesc, prometheus.GaugeValue, float64(status.JIT.BufferSize), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.opcacheJITBufferFreeDesc, prometheus.GaugeValue, float64(status.JIT.BufferFree), poolName, socket, ref.namespace, ref.pod)
+	}
+
+	if status.Preload != nil {
+		ch <- prometheus.MustNewConstMetric(pc.opcachePreloadScriptsDesc, prometheus.GaugeValue, float64(status.Preload.Scripts), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.opcachePreloadMemoryDesc, prometheus.GaugeValue, float64(status.Preload.MemoryConsumption), poolName, socket, ref.namespace, ref.pod)
+	}
+}
+
+// collectApcu emits the APCu cache of a pool; only loaded and enabled are
+// reported when the extension is missing or disabled.
+func (pc *PrometheusCollector) collectApcu(ch chan<- prometheus.Metric, apcu *phpfpm.ApcuStatus, poolName, socket string, ref podRef) {
+	ch <- prometheus.MustNewConstMetric(pc.apcuLoadedDesc, prometheus.GaugeValue, boolToFloat(apcu.Loaded), poolName, socket, ref.namespace, ref.pod)
+	if !apcu.Loaded {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(pc.apcuEnabledDesc, prometheus.GaugeValue, boolToFloat(apcu.Enabled), poolName, socket, ref.namespace, ref.pod)
+	if !apcu.Enabled {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(pc.apcuHitsDesc, prometheus.CounterValue, float64(apcu.Hits), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuMissesDesc, prometheus.CounterValue, float64(apcu.Misses), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuInsertsDesc, prometheus.CounterValue, float64(apcu.Inserts), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuEntriesDesc, prometheus.GaugeValue, float64(apcu.Entries), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuExpungesDesc, prometheus.CounterValue, float64(apcu.Expunges), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuMemSizeDesc, prometheus.GaugeValue, float64(apcu.MemSize), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuSegmentsDesc, prometheus.GaugeValue, float64(apcu.Segments), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuSegmentSizeDesc, prometheus.GaugeValue, float64(apcu.SegmentSize), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuAvailMemoryDesc, prometheus.GaugeValue, float64(apcu.AvailableMemory), poolName, socket, ref.namespace, ref.pod)
+	ch <- prometheus.MustNewConstMetric(pc.apcuFragmentationDesc, prometheus.GaugeValue, apcu.Fragmentation, poolName, socket, ref.namespace, ref.pod)
+}
+
+// collectRuntime emits the realpath cache and garbage collector state of the
+// worker that served the runtime probe. They are gauges: the next poll may be
+// served by another worker.
+func (pc *PrometheusCollector) collectRuntime(ch chan<- prometheus.Metric, rt *phpfpm.RuntimeStatus, poolName, socket string, ref podRef) {
+	ch <- prometheus.MustNewConstMetric(pc.realpathCacheUsedDesc, prometheus.GaugeValue, float64(rt.RealpathCacheUsed), poolName, socket, ref.namespace, ref.pod)
+	if limit, ok := rt.RealpathCacheLimitBytes(); ok {
+		ch <- prometheus.MustNewConstMetric(pc.realpathCacheLimitDesc, prometheus.GaugeValue, limit, poolName, socket, ref.namespace, ref.pod)
+	}
+	ch <- prometheus.MustNewConstMetric(pc.realpathCacheEntriesDesc, prometheus.GaugeValue, float64(rt.RealpathCacheEntries), poolName, socket, ref.namespace, ref.pod)
+
+	if rt.GC != nil {
+		ch <- prometheus.MustNewConstMetric(pc.gcRunsDesc, prometheus.GaugeValue, float64(rt.GC.Runs), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.gcCollectedDesc, prometheus.GaugeValue, float64(rt.GC.Collected), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.gcThresholdDesc, prometheus.GaugeValue, float64(rt.GC.Threshold), poolName, socket, ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(pc.gcRootsDesc, prometheus.GaugeValue, float64(rt.GC.Roots), poolName, socket, ref.namespace, ref.pod)
+	}
+}
+
+// collectPHPInfo emits the version and extensions of the pool, nothing when
+// neither the runtime probe nor the binary could be read.
+func (pc *PrometheusCollector) collectPHPInfo(ch chan<- prometheus.Metric, info phpfpm.Info, poolName, socket string, ref podRef) {
+	if info.Version == "" {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(pc.phpInfoDesc, prometheus.GaugeValue, 1, poolName, socket, info.ShortVersion(), info.Sapi, ref.namespace, ref.pod)
+
+	// The binary lists Zend extensions such as opcache a second time
+	seen := make(map[string]bool, len(info.Extensions))
+	for _, ext := range info.Extensions {
+		if seen[ext] {
+			continue
+		}
+		seen[ext] = true
+		ch <- prometheus.MustNewConstMetric(pc.phpExtensionLoadedDesc, prometheus.GaugeValue, 1, poolName, socket, ext, ref.namespace, ref.pod)
+	}
+}
+
+// collectIni emits numeric ini values as gauges and the rest as info metrics.
+func (pc *PrometheusCollector) collectIni(ch chan<- prometheus.Metric, ini map[string]string, poolName, socket string, ref podRef) {
+	for directive, value := range ini {
+		if v, ok := phpfpm.ParseIniNumber(value); ok {
+			ch <- prometheus.MustNewConstMetric(pc.phpIniValueDesc, prometheus.GaugeValue, v, poolName, socket, directive, ref.namespace, ref.pod)
+		} else {
+			ch <- prometheus.MustNewConstMetric(pc.phpIniInfoDesc, prometheus.GaugeValue, 1, poolName, socket, directive, value, ref.namespace, ref.pod)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
 	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/metrics"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	dto "github.com/prometheus/client_model/go"
@@ -303,6 +305,8 @@ func TestPrometheusCollector_MetricNames(t *testing.T) {
 		"phpfpm_up",
 		"phpfpm_accepted_connections",
 		"phpfpm_start_since",
+		"phpfpm_master_restarts_total",
+		"phpfpm_config_reload_timestamp_seconds",
 		"phpfpm_listen_queue",
 		"phpfpm_idle_processes",
 		"phpfpm_active_processes",
@@ -310,6 +314,9 @@ func TestPrometheusCollector_MetricNames(t *testing.T) {
 		"phpfpm_opcache_enabled",
 		"phpfpm_opcache_used_memory_bytes",
 		"phpfpm_opcache_hits_total",
+		"phpfpm_recommended_max_children",
+		"phpfpm_memory_headroom_bytes",
+		"phpfpm_worker_rss_bytes",
 		"system_info",
 		"system_cpu_limit",
 		"laravel_app_info",
@@ -634,3 +641,518 @@ func TestPrometheusCollector_Collect_ErrorRecovery(t *testing.T) {
 		}
 	}
 }
+
+func TestPrometheusCollector_UseSnapshots(t *testing.T) {
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Socket:       "unix:///nonexistent/socket",
+					StatusSocket: "unix:///nonexistent/socket",
+					StatusPath:   "/status",
+				},
+			},
+		},
+	}
+
+	collector := NewPrometheusCollector(cfg)
+	source := metrics.NewCollector(cfg, time.Second)
+	collector.UseSnapshots(source)
+
+	if collector.snapshots != source {
+		t.Fatalf("Expected collector to read from the attached snapshot source")
+	}
+
+	// Nothing has been collected yet, so scraping must not touch the socket
+	// and should return immediately with no pools.
+	start := time.Now()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected snapshot scrape to be fast, took %v", time.Since(start))
+	}
+
+	for _, mf := range metricFamilies {
+		if mf.GetName() == "phpfpm_up" {
+			for _, metric := range mf.GetMetric() {
+				if metric.GetGauge().GetValue() != 0 {
+					t.Errorf("Expected phpfpm_up to be 0 before any pool was scraped")
+				}
+			}
+		}
+	}
+}
+
+func TestPrometheusCollector_Collect_FailedPool(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Name:         "www",
+					Socket:       "unix:///nonexistent/failed-pool.sock",
+					StatusSocket: "unix:///nonexistent/failed-pool.sock",
+					StatusPath:   "/status",
+				},
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewPrometheusCollector(cfg))
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	for _, mf := range metricFamilies {
+		families[mf.GetName()] = mf
+	}
+
+	labelsOf := func(m *dto.Metric) map[string]string {
+		out := make(map[string]string)
+		for _, lp := range m.GetLabel() {
+			out[lp.GetName()] = lp.GetValue()
+		}
+		return out
+	}
+
+	up, ok := families["phpfpm_up"]
+	if !ok || len(up.GetMetric()) != 1 {
+		t.Fatalf("Expected a single phpfpm_up series for the failed pool")
+	}
+	if labels := labelsOf(up.GetMetric()[0]); labels["pool"] != "www" || labels["socket"] != "unix:///nonexistent/failed-pool.sock" {
+		t.Errorf("Expected phpfpm_up labelled with the configured pool, got %v", labels)
+	}
+	if up.GetMetric()[0].GetGauge().GetValue() != 0 {
+		t.Errorf("Expected phpfpm_up to be 0 for the failed pool")
+	}
+
+	scrapeErrors, ok := families["phpfpm_scrape_error"]
+	if !ok {
+		t.Fatalf("Expected phpfpm_scrape_error to be exported")
+	}
+	for _, m := range scrapeErrors.GetMetric() {
+		stage := labelsOf(m)["stage"]
+		expected := 0.0
+		if stage == "dial" {
+			expected = 1
+		}
+		if m.GetGauge().GetValue() != expected {
+			t.Errorf("Expected phpfpm_scrape_error{stage=%q} to be %v, got %v", stage, expected, m.GetGauge().GetValue())
+		}
+	}
+
+	failures, ok := families["phpfpm_scrape_failures"]
+	if !ok {
+		t.Fatalf("Expected phpfpm_scrape_failures to be exported")
+	}
+	found := false
+	for _, m := range failures.GetMetric() {
+		labels := labelsOf(m)
+		if labels["socket"] == "unix:///nonexistent/failed-pool.sock" && labels["stage"] == "dial" {
+			found = true
+			if m.GetCounter().GetValue() < 1 {
+				t.Errorf("Expected at least one counted dial failure")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected a dial failure counter for the failed pool")
+	}
+}
+
+func TestPrometheusCollector_Collect_StatusUnavailable(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	cfg := &config.Config{
+		PHPFpm: config.FPMConfig{
+			Enabled: true,
+			Pools: []config.FPMPoolConfig{
+				{
+					Name:         "cron",
+					Socket:       "unix:///nonexistent/no-status.sock",
+					StatusSocket: "unix:///nonexistent/no-status.sock",
+					Discovered:   true,
+				},
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewPrometheusCollector(cfg))
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	for _, mf := range metricFamilies {
+		families[mf.GetName()] = mf
+	}
+
+	unavailable, ok := families["phpfpm_pool_status_unavailable"]
+	if !ok || len(unavailable.GetMetric()) != 1 {
+		t.Fatalf("Expected a single phpfpm_pool_status_unavailable series")
+	}
+	labels := make(map[string]string)
+	for _, lp := range unavailable.GetMetric()[0].GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if labels["pool"] != "cron" || labels["socket"] != "unix:///nonexistent/no-status.sock" || labels["reason"] != "no_status_path" {
+		t.Errorf("Expected the pool and its reason, got %v", labels)
+	}
+
+	// The pool is not down, so it must not look like it
+	if _, ok := families["phpfpm_up"]; ok {
+		t.Error("Expected no phpfpm_up for a pool without a status page")
+	}
+}
+
+func TestPrometheusCollector_CollectOpcacheDetail(t *testing.T) {
+	pc := NewPrometheusCollector(&config.Config{})
+	status := phpfpm.OpcacheStatus{
+		Enabled:         true,
+		InternedStrings: phpfpm.InternedStrings{BufferSize: 8 << 20, UsedMemory: 2 << 20, FreeMemory: 6 << 20, NumberOfStrings: 100},
+		Statistics:      phpfpm.Stats{NumCachedKeys: 5, MaxCachedKeys: 16229, StartTime: 1700000000},
+	}
+
+	collect := func(status phpfpm.OpcacheStatus) map[string]float64 {
+		ch := make(chan prometheus.Metric, 100)
+		pc.collectOpcacheDetail(ch, status, "www", "unix:///run/php-fpm.sock", podRef{}, time.Unix(1700000060, 0))
+		close(ch)
+
+		values := make(map[string]float64)
+		for m := range ch {
+			metricDTO := &dto.Metric{}
+			if err := m.Write(metricDTO); err != nil {
+				t.Fatalf("Failed to write metric to DTO: %v", err)
+			}
+			values[metricName(m.Desc())] = metricDTO.GetGauge().GetValue()
+		}
+		return values
+	}
+
+	values := collect(status)
+	expected := map[string]float64{
+		"phpfpm_opcache_max_cached_keys":             16229,
+		"phpfpm_opcache_cached_keys":                 5,
+		"phpfpm_opcache_seconds_since_restart":       60,
+		"phpfpm_opcache_interned_strings_used_bytes": 2 << 20,
+		"phpfpm_opcache_interned_strings":            100,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, values[name])
+		}
+	}
+	for _, name := range []string{"phpfpm_opcache_jit_buffer_bytes", "phpfpm_opcache_preload_scripts"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("Expected no %s without JIT or preload status", name)
+		}
+	}
+
+	status.JIT = &phpfpm.JIT{Enabled: true, On: true, BufferSize: 64 << 20, BufferFree: 60 << 20}
+	status.Preload = &phpfpm.PreloadStats{Scripts: 3, MemoryConsumption: 1 << 20}
+	values = collect(status)
+	if values["phpfpm_opcache_jit_enabled"] != 1 || values["phpfpm_opcache_jit_buffer_free_bytes"] != 60<<20 {
+		t.Errorf("Unexpected JIT metrics: %v", values)
+	}
+	if values["phpfpm_opcache_preload_scripts"] != 3 || values["phpfpm_opcache_preload_memory_bytes"] != 1<<20 {
+		t.Errorf("Unexpected preload metrics: %v", values)
+	}
+}
+
+func TestPrometheusCollector_CollectIni(t *testing.T) {
+	pc := NewPrometheusCollector(&config.Config{})
+
+	ch := make(chan prometheus.Metric, 10)
+	pc.collectIni(ch, map[string]string{
+		"memory_limit":                "256M",
+		"opcache.validate_timestamps": "",
+		"opcache.jit":                 "tracing",
+	}, "www", "unix:///run/php-fpm.sock", podRef{})
+	close(ch)
+
+	values := make(map[string]float64)
+	infos := make(map[string]string)
+	for m := range ch {
+		metricDTO := &dto.Metric{}
+		if err := m.Write(metricDTO); err != nil {
+			t.Fatalf("Failed to write metric to DTO: %v", err)
+		}
+		labels := make(map[string]string)
+		for _, lp := range metricDTO.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+
+		switch metricName(m.Desc()) {
+		case "php_ini_value":
+			values[labels["directive"]] = metricDTO.GetGauge().GetValue()
+		case "php_ini_info":
+			infos[labels["directive"]] = labels["value"]
+		}
+	}
+
+	if values["memory_limit"] != 256<<20 {
+		t.Errorf("Expected memory_limit of 256 MiB, got %v", values["memory_limit"])
+	}
+	if v, ok := values["opcache.validate_timestamps"]; !ok || v != 0 {
+		t.Errorf("Expected opcache.validate_timestamps to be 0, got %v (%v)", v, ok)
+	}
+	if infos["opcache.jit"] != "tracing" {
+		t.Errorf("Expected opcache.jit as info metric, got %v", infos)
+	}
+	if _, ok := values["opcache.jit"]; ok {
+		t.Errorf("Expected opcache.jit not to be exported as a value")
+	}
+}
+
+func TestPrometheusCollector_CollectApcu(t *testing.T) {
+	pc := NewPrometheusCollector(&config.Config{})
+
+	collect := func(apcu *phpfpm.ApcuStatus) map[string]float64 {
+		ch := make(chan prometheus.Metric, 20)
+		pc.collectApcu(ch, apcu, "www", "unix:///run/php-fpm.sock", podRef{})
+		close(ch)
+
+		values := make(map[string]float64)
+		for m := range ch {
+			metricDTO := &dto.Metric{}
+			if err := m.Write(metricDTO); err != nil {
+				t.Fatalf("Failed to write metric to DTO: %v", err)
+			}
+			if metricDTO.GetCounter() != nil {
+				values[metricName(m.Desc())] = metricDTO.GetCounter().GetValue()
+			} else {
+				values[metricName(m.Desc())] = metricDTO.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	values := collect(&phpfpm.ApcuStatus{})
+	if len(values) != 1 || values["phpfpm_apcu_loaded"] != 0 {
+		t.Errorf("Expected only phpfpm_apcu_loaded = 0 without the extension, got %v", values)
+	}
+
+	values = collect(&phpfpm.ApcuStatus{Loaded: true, Enabled: true, Hits: 900, Misses: 100, AvailableMemory: 1 << 20, Fragmentation: 0.25})
+	expected := map[string]float64{
+		"phpfpm_apcu_loaded":                 1,
+		"phpfpm_apcu_enabled":                1,
+		"phpfpm_apcu_hits_total":             900,
+		"phpfpm_apcu_misses_total":           100,
+		"phpfpm_apcu_available_memory_bytes": 1 << 20,
+		"phpfpm_apcu_fragmentation_ratio":    0.25,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+func TestPrometheusCollector_CollectRuntime(t *testing.T) {
+	pc := NewPrometheusCollector(&config.Config{})
+
+	ch := make(chan prometheus.Metric, 20)
+	pc.collectRuntime(ch, &phpfpm.RuntimeStatus{
+		RealpathCacheUsed:    51200,
+		RealpathCacheLimit:   "4096K",
+		RealpathCacheEntries: 120,
+		GC:                   &phpfpm.GCStatus{Runs: 3, Collected: 40, Threshold: 10001, Roots: 12},
+	}, "www", "unix:///run/php-fpm.sock", podRef{})
+	close(ch)
+
+	values := make(map[string]float64)
+	for m := range ch {
+		metricDTO := &dto.Metric{}
+		if err := m.Write(metricDTO); err != nil {
+			t.Fatalf("Failed to write metric to DTO: %v", err)
+		}
+		values[metricName(m.Desc())] = metricDTO.GetGauge().GetValue()
+	}
+
+	expected := map[string]float64{
+		"phpfpm_realpath_cache_used_bytes":  51200,
+		"phpfpm_realpath_cache_limit_bytes": 4096 * 1024,
+		"phpfpm_realpath_cache_entries":     120,
+		"phpfpm_gc_runs":                    3,
+		"phpfpm_gc_collected":               40,
+		"phpfpm_gc_threshold":               10001,
+		"phpfpm_gc_roots":                   12,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+func TestPrometheusCollector_CollectPHPInfo(t *testing.T) {
+	pc := NewPrometheusCollector(&config.Config{})
+
+	ch := make(chan prometheus.Metric, 20)
+	pc.collectPHPInfo(ch, phpfpm.Info{
+		Version:    "PHP 8.3.4 (cli) (built: Mar 12 2024 10:00:00) (NTS)",
+		Extensions: []string{"Core", "json", "Zend OPcache", "Zend OPcache"},
+	}, "www", "unix:///run/php-fpm.sock", podRef{})
+	pc.collectPHPInfo(ch, phpfpm.Info{}, "down", "unix:///run/down.sock", podRef{})
+	close(ch)
+
+	var versions []string
+	extensions := make(map[string]int)
+	for m := range ch {
+		metricDTO := &dto.Metric{}
+		if err := m.Write(metricDTO); err != nil {
+			t.Fatalf("Failed to write metric to DTO: %v", err)
+		}
+		labels := make(map[string]string)
+		for _, lp := range metricDTO.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["pool"] != "www" {
+			t.Errorf("Expected no metrics for a pool without PHP info, got %v", labels)
+		}
+
+		switch metricName(m.Desc()) {
+		case "php_info":
+			versions = append(versions, labels["version"]+"/"+labels["sapi"])
+		case "php_extension_loaded":
+			extensions[labels["extension"]]++
+		}
+	}
+
+	if len(versions) != 1 || versions[0] != "8.3.4/" {
+		t.Errorf("Expected a single php_info for 8.3.4, got %v", versions)
+	}
+	if len(extensions) != 3 || extensions["Zend OPcache"] != 1 {
+		t.Errorf("Expected each extension once, got %v", extensions)
+	}
+}
+
+func TestPrometheusCollector_Collect_PingSuccess(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	pc := NewPrometheusCollector(&config.Config{PHPFpm: config.FPMConfig{Enabled: true}})
+	pc.target = &metrics.Metrics{
+		Timestamp: time.Now(),
+		Fpm: map[string]*phpfpm.Result{
+			"unix:///run/php/www.sock": {
+				Timestamp: time.Now(),
+				Pools:     map[string]phpfpm.Pool{"www": {Name: "www", Ping: &phpfpm.PingResult{Success: true}}},
+			},
+			"unix:///run/php/api.sock": {
+				Timestamp: time.Now(),
+				Pools:     map[string]phpfpm.Pool{"api": {Name: "api", Ping: &phpfpm.PingResult{Error: "unexpected status 404"}}},
+			},
+			"unix:///run/php/cron.sock": {
+				Timestamp: time.Now(),
+				Pools:     map[string]phpfpm.Pool{"cron": {Name: "cron"}},
+			},
+			"unix:///run/php/jobs.sock": {
+				Timestamp: time.Now(),
+				Name:      "jobs",
+				Errors:    map[string]string{phpfpm.StageDial: "failed to dial FastCGI"},
+				Ping:      &phpfpm.PingResult{Error: "failed to dial FastCGI"},
+			},
+		},
+		Errors: make(map[string]string),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(pc)
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	got := make(map[string]float64)
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "phpfpm_ping_success" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "pool" {
+					got[lp.GetValue()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	if len(got) != 3 || got["www"] != 1 || got["api"] != 0 || got["jobs"] != 0 {
+		t.Errorf("Expected www up, api and the failed jobs down, and no series for a pool without ping.path, got %v", got)
+	}
+}
+
+func TestPrometheusCollector_Collect_ProbeErrors(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	pc := NewPrometheusCollector(&config.Config{PHPFpm: config.FPMConfig{Enabled: true}})
+	pc.target = &metrics.Metrics{
+		Timestamp: time.Now(),
+		Fpm: map[string]*phpfpm.Result{
+			"unix:///run/php/www.sock": {
+				Timestamp: time.Now(),
+				Pools:     map[string]phpfpm.Pool{"www": {Name: "www", ProbeErrors: map[string]string{"opcache": phpfpm.ProbeStageInstall}}},
+			},
+			"unix:///run/php/api.sock": {
+				Timestamp: time.Now(),
+				Pools:     map[string]phpfpm.Pool{"api": {Name: "api"}}, // probes skipped
+			},
+		},
+		Errors: make(map[string]string),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(pc)
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	failed := make(map[string]float64)
+	var series int
+	for _, mf := range metricFamilies {
+		if mf.GetName() != "phpfpm_probe_error" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			series++
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["pool"] != "www" {
+				t.Errorf("Expected no probe errors for a pool with probes skipped, got %v", labels)
+			}
+			if m.GetGauge().GetValue() != 0 {
+				failed[labels["probe"]+"/"+labels["stage"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	if want := len(phpfpm.ProbeNames) * len(phpfpm.ProbeStages); series != want {
+		t.Errorf("Expected %d series, got %d", want, series)
+	}
+	if len(failed) != 1 || failed["opcache/install"] != 1 {
+		t.Errorf("Expected only opcache to fail at install, got %v", failed)
+	}
+}
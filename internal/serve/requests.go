@@ -0,0 +1,120 @@
+package serve
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestHistograms turns the completed requests seen across polls into
+// per-pool histograms of duration, peak memory and CPU.
+type RequestHistograms struct {
+	tracker  *phpfpm.RequestTracker
+	duration *prometheus.HistogramVec
+	memory   *prometheus.HistogramVec
+	cpu      *prometheus.HistogramVec
+
+	mu    sync.Mutex
+	pools map[string]map[string]struct{} // socket -> pool names with series
+}
+
+func NewRequestHistograms() *RequestHistograms {
+	labels := []string{"pool", "socket"}
+
+	return &RequestHistograms{
+		tracker: phpfpm.NewRequestTracker(),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "phpfpm_request_duration_seconds",
+			Help:                            "Duration of completed PHP-FPM requests, sampled from the worker process list.",
+			Buckets:                         prometheus.DefBuckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, labels),
+		memory: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "phpfpm_request_memory_bytes",
+			Help:                            "Peak memory of completed PHP-FPM requests, sampled from the worker process list.",
+			Buckets:                         prometheus.ExponentialBuckets(1<<20, 2, 10),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, labels),
+		cpu: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "phpfpm_request_cpu_percent",
+			Help:                            "CPU usage of completed PHP-FPM requests, sampled from the worker process list.",
+			Buckets:                         prometheus.LinearBuckets(10, 10, 10),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  160,
+			NativeHistogramMinResetDuration: time.Hour,
+		}, labels),
+		pools: make(map[string]map[string]struct{}),
+	}
+}
+
+// Observe feeds the requests completed since the previous poll of socket.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (h *RequestHistograms) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	for name, pool := range result.Pools {
+		h.track(socket, name)
+
+		for _, req := range h.tracker.Observe(socket+"|"+name, pool) {
+			h.duration.WithLabelValues(name, socket).Observe(req.Duration.Seconds())
+			h.memory.WithLabelValues(name, socket).Observe(req.Memory)
+			h.cpu.WithLabelValues(name, socket).Observe(req.CPU)
+		}
+	}
+}
+
+// track remembers which pools a socket reported so series of a renamed pool
+// are dropped instead of being exported forever.
+func (h *RequestHistograms) track(socket, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names, ok := h.pools[socket]
+	if !ok {
+		names = make(map[string]struct{})
+		h.pools[socket] = names
+	}
+	for old := range names {
+		if old != name {
+			h.duration.DeleteLabelValues(old, socket)
+			h.memory.DeleteLabelValues(old, socket)
+			h.cpu.DeleteLabelValues(old, socket)
+			delete(names, old)
+		}
+	}
+	names[name] = struct{}{}
+}
+
+// Forget drops the series and request state of a socket that is no longer
+// collected. It matches metrics.PoolRemovedListener.
+func (h *RequestHistograms) Forget(socket string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	labels := prometheus.Labels{"socket": socket}
+	h.duration.DeletePartialMatch(labels)
+	h.memory.DeletePartialMatch(labels)
+	h.cpu.DeletePartialMatch(labels)
+	h.tracker.Forget(socket + "|")
+	delete(h.pools, socket)
+}
+
+func (h *RequestHistograms) Describe(ch chan<- *prometheus.Desc) {
+	h.duration.Describe(ch)
+	h.memory.Describe(ch)
+	h.cpu.Describe(ch)
+}
+
+func (h *RequestHistograms) Collect(ch chan<- prometheus.Metric) {
+	h.duration.Collect(ch)
+	h.memory.Collect(ch)
+	h.cpu.Collect(ch)
+}
@@ -0,0 +1,137 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func requestResult(name string, requests int64, duration int64) *phpfpm.Result {
+	return &phpfpm.Result{
+		Pools: map[string]phpfpm.Pool{
+			name: {
+				Name: name,
+				Path: "/status",
+				Processes: []phpfpm.PoolProcess{
+					{
+						PID: 42, State: "Idle", Requests: requests, RequestURI: "/index.php",
+						RequestDuration: duration, LastRequestMemory: 4194304, LastRequestCPU: 25,
+					},
+				},
+			},
+		},
+	}
+}
+
+func gatherHistograms(t *testing.T, h *RequestHistograms) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+func TestRequestHistograms_Observe(t *testing.T) {
+	h := NewRequestHistograms()
+	socket := "unix:///run/php-fpm.sock"
+
+	h.Observe(socket, requestResult("www", 1, 100000))
+	h.Observe(socket, requestResult("www", 2, 500000))
+	// Nil results come from failed scrapes and must be ignored
+	h.Observe(socket, nil)
+
+	families := gatherHistograms(t, h)
+
+	tests := []struct {
+		name string
+		sum  float64
+	}{
+		{"phpfpm_request_duration_seconds", 0.5},
+		{"phpfpm_request_memory_bytes", 4194304},
+		{"phpfpm_request_cpu_percent", 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mf, ok := families[tt.name]
+			if !ok {
+				t.Fatalf("Expected metric family %s", tt.name)
+			}
+			if len(mf.GetMetric()) != 1 {
+				t.Fatalf("Expected 1 series, got %d", len(mf.GetMetric()))
+			}
+
+			hist := mf.GetMetric()[0].GetHistogram()
+			if hist.GetSampleCount() != 1 {
+				t.Errorf("Expected 1 sample, got %d", hist.GetSampleCount())
+			}
+			if hist.GetSampleSum() != tt.sum {
+				t.Errorf("Expected sum %v, got %v", tt.sum, hist.GetSampleSum())
+			}
+			// Native histograms expose a schema alongside the classic buckets
+			if hist.Schema == nil {
+				t.Errorf("Expected native histogram schema to be set")
+			}
+
+			labels := make(map[string]string)
+			for _, lp := range mf.GetMetric()[0].GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["pool"] != "www" || labels["socket"] != socket {
+				t.Errorf("Unexpected labels: %v", labels)
+			}
+		})
+	}
+}
+
+func TestRequestHistograms_RenamedPoolDropsSeries(t *testing.T) {
+	h := NewRequestHistograms()
+	socket := "unix:///run/php-fpm.sock"
+
+	h.Observe(socket, requestResult("old", 1, 100000))
+	h.Observe(socket, requestResult("old", 2, 100000))
+	h.Observe(socket, requestResult("new", 3, 100000))
+
+	families := gatherHistograms(t, h)
+	for _, m := range families["phpfpm_request_duration_seconds"].GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == "pool" && lp.GetValue() == "old" {
+				t.Errorf("Expected series of renamed pool to be removed")
+			}
+		}
+	}
+}
+
+func TestRequestHistograms_Forget(t *testing.T) {
+	h := NewRequestHistograms()
+
+	h.Observe("unix:///run/a.sock", requestResult("www", 1, 100000))
+	h.Observe("unix:///run/a.sock", requestResult("www", 2, 100000))
+	h.Observe("unix:///run/b.sock", requestResult("www", 1, 100000))
+	h.Observe("unix:///run/b.sock", requestResult("www", 2, 100000))
+
+	h.Forget("unix:///run/a.sock")
+
+	for _, m := range gatherHistograms(t, h)["phpfpm_request_duration_seconds"].GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == "socket" && lp.GetValue() == "unix:///run/a.sock" {
+				t.Errorf("Expected series of the removed socket to be dropped")
+			}
+		}
+	}
+	if n := len(gatherHistograms(t, h)["phpfpm_request_duration_seconds"].GetMetric()); n != 1 {
+		t.Errorf("Expected the other socket's series to be kept, got %d", n)
+	}
+}
@@ -0,0 +1,194 @@
+package serve
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OtherRoute collects requests once a pool has reached its route limit.
+const OtherRoute = "other"
+
+// OtherMethod collects requests with a method outside of standardMethods,
+// which a client can make up freely.
+const OtherMethod = "OTHER"
+
+var standardMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type poolRoutes struct {
+	known  map[routeKey]struct{}
+	active map[routeKey]int
+}
+
+// RouteMetrics breaks requests down by method and normalized route, so busy
+// endpoints can be spotted from the worker process list.
+type RouteMetrics struct {
+	normalizer *phpfpm.RouteNormalizer
+	maxRoutes  int
+	tracker    *phpfpm.RequestTracker
+
+	requests   *prometheus.CounterVec
+	duration   *prometheus.SummaryVec
+	activeDesc *prometheus.Desc
+
+	mu    sync.Mutex
+	pools map[[2]string]*poolRoutes // {pool, socket}
+}
+
+func NewRouteMetrics(cfg config.RoutesConfig) (*RouteMetrics, error) {
+	normalizer, err := phpfpm.NewRouteNormalizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []string{"pool", "socket", "method", "route"}
+
+	return &RouteMetrics{
+		normalizer: normalizer,
+		maxRoutes:  cfg.MaxRoutes,
+		tracker:    phpfpm.NewRequestTracker(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "phpfpm_route_requests_total",
+			Help: "Completed PHP-FPM requests by route, sampled from the worker process list.",
+		}, labels),
+		duration: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name:       "phpfpm_route_request_duration_seconds",
+			Help:       "Duration of completed PHP-FPM requests by route, sampled from the worker process list.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     10 * time.Minute,
+		}, labels),
+		activeDesc: prometheus.NewDesc("phpfpm_route_active_workers", "Workers currently serving a request, by route.", labels, nil),
+		pools:      make(map[[2]string]*poolRoutes),
+	}, nil
+}
+
+// Observe records the completed and in-flight requests of a poll.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (r *RouteMetrics) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	for name, pool := range result.Pools {
+		completed := r.tracker.Observe(socket+"|"+name, pool)
+
+		r.mu.Lock()
+		r.track(socket, name)
+		routes := r.poolRoutes(name, socket)
+
+		for _, req := range completed {
+			key := r.key(routes, req.Method, req.URI, req.Script)
+			r.requests.WithLabelValues(name, socket, key.method, key.route).Inc()
+			r.duration.WithLabelValues(name, socket, key.method, key.route).Observe(req.Duration.Seconds())
+		}
+
+		routes.active = make(map[routeKey]int)
+		for _, proc := range pool.Processes {
+			if strings.EqualFold(proc.State, "idle") || phpfpm.IsExporterRequest(proc, pool.Path, pool.Config["ping.path"]) {
+				continue
+			}
+			routes.active[r.key(routes, proc.RequestMethod, proc.RequestURI, proc.Script)]++
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Forget drops the series and routes of a socket that is no longer collected.
+// It matches metrics.PoolRemovedListener.
+func (r *RouteMetrics) Forget(socket string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	labels := prometheus.Labels{"socket": socket}
+	r.requests.DeletePartialMatch(labels)
+	r.duration.DeletePartialMatch(labels)
+	r.tracker.Forget(socket + "|")
+	for id := range r.pools {
+		if id[1] == socket {
+			delete(r.pools, id)
+		}
+	}
+}
+
+// track drops the series and routes of the pools socket reported before, so
+// those of a renamed pool are not exported forever. Must be called with r.mu
+// held.
+func (r *RouteMetrics) track(socket, name string) {
+	for id := range r.pools {
+		if id[1] != socket || id[0] == name {
+			continue
+		}
+		labels := prometheus.Labels{"pool": id[0], "socket": socket}
+		r.requests.DeletePartialMatch(labels)
+		r.duration.DeletePartialMatch(labels)
+		r.tracker.Forget(socket + "|" + id[0])
+		delete(r.pools, id)
+	}
+}
+
+func (r *RouteMetrics) poolRoutes(name, socket string) *poolRoutes {
+	id := [2]string{name, socket}
+	routes, ok := r.pools[id]
+	if !ok {
+		routes = &poolRoutes{
+			known:  make(map[routeKey]struct{}),
+			active: make(map[routeKey]int),
+		}
+		r.pools[id] = routes
+	}
+	return routes
+}
+
+// key normalizes a request and folds it into OtherRoute once the pool has
+// seen maxRoutes distinct routes. Must be called with r.mu held.
+func (r *RouteMetrics) key(routes *poolRoutes, method, uri, script string) routeKey {
+	method = strings.ToUpper(method)
+	switch {
+	case method == "":
+		method = "UNKNOWN"
+	case !standardMethods[method]:
+		method = OtherMethod
+	}
+
+	key := routeKey{method: method, route: r.normalizer.Route(uri, script)}
+	if _, ok := routes.known[key]; ok {
+		return key
+	}
+	if r.maxRoutes > 0 && len(routes.known) >= r.maxRoutes {
+		return routeKey{method: method, route: OtherRoute}
+	}
+
+	routes.known[key] = struct{}{}
+	return key
+}
+
+func (r *RouteMetrics) Describe(ch chan<- *prometheus.Desc) {
+	r.requests.Describe(ch)
+	r.duration.Describe(ch)
+	ch <- r.activeDesc
+}
+
+func (r *RouteMetrics) Collect(ch chan<- prometheus.Metric) {
+	r.requests.Collect(ch)
+	r.duration.Collect(ch)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, routes := range r.pools {
+		for key, n := range routes.active {
+			ch <- prometheus.MustNewConstMetric(r.activeDesc, prometheus.GaugeValue, float64(n), id[0], id[1], key.method, key.route)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func routesResult(procs ...phpfpm.PoolProcess) *phpfpm.Result {
+	return &phpfpm.Result{
+		Pools: map[string]phpfpm.Pool{
+			"www": {Name: "www", Path: "/status", Processes: procs},
+		},
+	}
+}
+
+// routeSeries gathers a metric family and indexes its series by method and route.
+func routeSeries(t *testing.T, c prometheus.Collector, name string) map[[2]string]*dto.Metric {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	series := make(map[[2]string]*dto.Metric)
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			series[[2]string{labels["method"], labels["route"]}] = m
+		}
+	}
+	return series
+}
+
+func TestRouteMetrics_Observe(t *testing.T) {
+	r, err := NewRouteMetrics(config.RoutesConfig{MaxRoutes: 10, StripQuery: true, CollapseIDs: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	socket := "unix:///run/php-fpm.sock"
+
+	r.Observe(socket, routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 1},
+		phpfpm.PoolProcess{PID: 2, State: "Idle", Requests: 1},
+	))
+	r.Observe(socket, routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 2, RequestMethod: "get", RequestURI: "/users/1?x=1", RequestDuration: 200000},
+		phpfpm.PoolProcess{PID: 2, State: "Idle", Requests: 2, RequestMethod: "GET", RequestURI: "/users/2", RequestDuration: 400000},
+		phpfpm.PoolProcess{PID: 3, State: "Running", Requests: 1, RequestMethod: "POST", RequestURI: "/orders"},
+		// The exporter's own status request must not show up as active
+		phpfpm.PoolProcess{PID: 4, State: "Running", Requests: 1, RequestMethod: "GET", RequestURI: "/status?json&full"},
+	))
+
+	requests := routeSeries(t, r, "phpfpm_route_requests_total")
+	if m, ok := requests[[2]string{"GET", "/users/:id"}]; !ok || m.GetCounter().GetValue() != 2 {
+		t.Errorf("Expected 2 requests for GET /users/:id, got %v", requests)
+	}
+
+	durations := routeSeries(t, r, "phpfpm_route_request_duration_seconds")
+	if m, ok := durations[[2]string{"GET", "/users/:id"}]; !ok || m.GetSummary().GetSampleSum() < 0.599 {
+		t.Errorf("Expected duration sum 0.6 for GET /users/:id, got %v", durations)
+	}
+
+	active := routeSeries(t, r, "phpfpm_route_active_workers")
+	if len(active) != 1 {
+		t.Fatalf("Expected 1 active route, got %v", active)
+	}
+	if m, ok := active[[2]string{"POST", "/orders"}]; !ok || m.GetGauge().GetValue() != 1 {
+		t.Errorf("Expected 1 active worker for POST /orders, got %v", active)
+	}
+}
+
+func TestRouteMetrics_CardinalityCap(t *testing.T) {
+	r, err := NewRouteMetrics(config.RoutesConfig{MaxRoutes: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r.Observe("sock", routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Running", RequestMethod: "GET", RequestURI: "/a"},
+		phpfpm.PoolProcess{PID: 2, State: "Running", RequestMethod: "GET", RequestURI: "/b"},
+		phpfpm.PoolProcess{PID: 3, State: "Running", RequestMethod: "GET", RequestURI: "/c"},
+		phpfpm.PoolProcess{PID: 4, State: "Running", RequestMethod: "GET", RequestURI: "/d"},
+	))
+
+	active := routeSeries(t, r, "phpfpm_route_active_workers")
+	if len(active) != 3 {
+		t.Errorf("Expected 2 routes plus %q, got %v", OtherRoute, active)
+	}
+	if m, ok := active[[2]string{"GET", OtherRoute}]; !ok || m.GetGauge().GetValue() != 2 {
+		t.Errorf("Expected 2 workers folded into %q, got %v", OtherRoute, active)
+	}
+
+	// Known routes keep their own series once the cap is reached
+	r.Observe("sock", routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Running", RequestMethod: "GET", RequestURI: "/a"},
+	))
+	active = routeSeries(t, r, "phpfpm_route_active_workers")
+	if _, ok := active[[2]string{"GET", "/a"}]; !ok || len(active) != 1 {
+		t.Errorf("Expected only GET /a to be active, got %v", active)
+	}
+}
+
+func TestNewRouteMetrics_InvalidRule(t *testing.T) {
+	_, err := NewRouteMetrics(config.RoutesConfig{Rules: []config.RouteRule{{Match: "["}}})
+	if err == nil {
+		t.Errorf("Expected error for invalid route rule")
+	}
+}
+
+func TestRouteMetrics_Forget(t *testing.T) {
+	r, err := NewRouteMetrics(config.RoutesConfig{MaxRoutes: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	socket := "unix:///run/php-fpm.sock"
+
+	r.Observe(socket, routesResult(phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 1}))
+	r.Observe(socket, routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 2, RequestMethod: "GET", RequestURI: "/users"},
+		phpfpm.PoolProcess{PID: 2, State: "Running", Requests: 1, RequestMethod: "POST", RequestURI: "/orders"},
+	))
+	r.Forget(socket)
+
+	for _, name := range []string{"phpfpm_route_requests_total", "phpfpm_route_request_duration_seconds", "phpfpm_route_active_workers"} {
+		if series := routeSeries(t, r, name); len(series) != 0 {
+			t.Errorf("Expected %s of the removed socket to be dropped, got %v", name, series)
+		}
+	}
+}
+
+func TestRouteMetrics_OtherMethod(t *testing.T) {
+	r, err := NewRouteMetrics(config.RoutesConfig{MaxRoutes: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r.Observe("sock", routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Running", RequestMethod: "get", RequestURI: "/a"},
+		phpfpm.PoolProcess{PID: 2, State: "Running", RequestMethod: "PROPFIND", RequestURI: "/a"},
+		phpfpm.PoolProcess{PID: 3, State: "Running", RequestMethod: "X-RANDOM-1234", RequestURI: "/a"},
+	))
+
+	active := routeSeries(t, r, "phpfpm_route_active_workers")
+	if len(active) != 2 || active[[2]string{"GET", "/a"}] == nil {
+		t.Fatalf("Expected GET and %s series, got %v", OtherMethod, active)
+	}
+	if m := active[[2]string{OtherMethod, "/a"}]; m == nil || m.GetGauge().GetValue() != 2 {
+		t.Errorf("Expected 2 workers with non-standard methods under %s, got %v", OtherMethod, active)
+	}
+}
+
+func TestRouteMetrics_RenamedPoolDropsSeries(t *testing.T) {
+	r, err := NewRouteMetrics(config.RoutesConfig{MaxRoutes: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	socket := "unix:///run/php-fpm.sock"
+
+	r.Observe(socket, routesResult(phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 1}))
+	r.Observe(socket, routesResult(
+		phpfpm.PoolProcess{PID: 1, State: "Idle", Requests: 2, RequestMethod: "GET", RequestURI: "/users"},
+		phpfpm.PoolProcess{PID: 2, State: "Running", Requests: 1, RequestMethod: "POST", RequestURI: "/orders"},
+	))
+
+	renamed := routesResult(phpfpm.PoolProcess{PID: 3, State: "Running", RequestMethod: "GET", RequestURI: "/health"})
+	renamed.Pools["api"] = renamed.Pools["www"]
+	delete(renamed.Pools, "www")
+	r.Observe(socket, renamed)
+
+	for _, name := range []string{"phpfpm_route_requests_total", "phpfpm_route_request_duration_seconds"} {
+		if series := routeSeries(t, r, name); len(series) != 0 {
+			t.Errorf("Expected %s of the renamed pool to be dropped, got %v", name, series)
+		}
+	}
+	if active := routeSeries(t, r, "phpfpm_route_active_workers"); len(active) != 1 || active[[2]string{"GET", "/health"}] == nil {
+		t.Errorf("Expected only the new pool's route to be active, got %v", active)
+	}
+}
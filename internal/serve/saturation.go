@@ -0,0 +1,135 @@
+package serve
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type saturationSample struct {
+	pool       string
+	socket     string
+	saturation phpfpm.Saturation
+	// down marks a pool whose scrape failed; only its score of 0 is exported.
+	down bool
+}
+
+// SaturationCollector exports utilization, queue pressure, the
+// max_children_reached rate and the health score of each pool.
+type SaturationCollector struct {
+	tracker *phpfpm.SaturationTracker
+
+	utilizationDesc     *prometheus.Desc
+	queuePressureDesc   *prometheus.Desc
+	maxChildrenRateDesc *prometheus.Desc
+	healthScoreDesc     *prometheus.Desc
+	healthPenaltyDesc   *prometheus.Desc
+
+	mu     sync.Mutex
+	latest map[string][]saturationSample // by socket
+}
+
+func NewSaturationCollector() *SaturationCollector {
+	labels := []string{"pool", "socket"}
+
+	return &SaturationCollector{
+		tracker:             phpfpm.NewSaturationTracker(),
+		utilizationDesc:     prometheus.NewDesc("phpfpm_utilization_ratio", "Busy workers divided by pm.max_children, excluding the exporter's own request.", labels, nil),
+		queuePressureDesc:   prometheus.NewDesc("phpfpm_listen_queue_pressure_ratio", "Pending connections divided by the listen queue length.", labels, nil),
+		maxChildrenRateDesc: prometheus.NewDesc("phpfpm_max_children_reached_rate", "Times per second pm.max_children was reached over the last minute.", labels, nil),
+		healthScoreDesc:     prometheus.NewDesc("phpfpm_health_score", "Pool health from 0 to 100, lowered by utilization, queue pressure and max_children hits.", labels, nil),
+		healthPenaltyDesc:   prometheus.NewDesc("phpfpm_health_penalty", "Points the factor takes off the health score.", []string{"pool", "socket", "factor"}, nil),
+		latest:              make(map[string][]saturationSample),
+	}
+}
+
+// Observe computes the saturation of each pool in result.
+// It matches metrics.PoolListener so it can be attached to the collector.
+func (c *SaturationCollector) Observe(socket string, result *phpfpm.Result) {
+	if result == nil {
+		return
+	}
+
+	at := result.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	samples := make([]saturationSample, 0, len(result.Pools))
+	for name, pool := range result.Pools {
+		samples = append(samples, saturationSample{
+			pool:       name,
+			socket:     socket,
+			saturation: c.tracker.Observe(socket+"|"+name, pool, at),
+		})
+	}
+	if len(samples) == 0 {
+		c.tracker.Forget(socket + "|")
+
+		// A pool that is down scores 0 rather than disappearing from
+		// health alerts; one without a status page has no values at all
+		if result.StatusUnavailable == "" {
+			name := result.Name
+			if name == "" {
+				name = "unknown"
+			}
+			samples = append(samples, saturationSample{pool: name, socket: socket, down: true})
+		}
+	}
+
+	c.mu.Lock()
+	c.latest[socket] = samples
+	c.mu.Unlock()
+}
+
+// Forget drops the values of a socket that is no longer collected.
+// It matches metrics.PoolRemovedListener.
+func (c *SaturationCollector) Forget(socket string) {
+	c.tracker.Forget(socket + "|")
+
+	c.mu.Lock()
+	delete(c.latest, socket)
+	c.mu.Unlock()
+}
+
+func (c *SaturationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.utilizationDesc
+	ch <- c.queuePressureDesc
+	ch <- c.maxChildrenRateDesc
+	ch <- c.healthScoreDesc
+	ch <- c.healthPenaltyDesc
+}
+
+func (c *SaturationCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, samples := range c.latest {
+		for _, sample := range samples {
+			s := sample.saturation
+			labels := []string{sample.pool, sample.socket}
+
+			if sample.down {
+				ch <- prometheus.MustNewConstMetric(c.healthScoreDesc, prometheus.GaugeValue, 0, labels...)
+				continue
+			}
+
+			if s.UtilizationKnown {
+				ch <- prometheus.MustNewConstMetric(c.utilizationDesc, prometheus.GaugeValue, s.Utilization, labels...)
+			}
+			if s.QueuePressureKnown {
+				ch <- prometheus.MustNewConstMetric(c.queuePressureDesc, prometheus.GaugeValue, s.QueuePressure, labels...)
+			}
+			if s.MaxChildrenRateKnown {
+				ch <- prometheus.MustNewConstMetric(c.maxChildrenRateDesc, prometheus.GaugeValue, s.MaxChildrenRate, labels...)
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.healthScoreDesc, prometheus.GaugeValue, s.Score, labels...)
+			for _, factor := range phpfpm.HealthFactors {
+				ch <- prometheus.MustNewConstMetric(c.healthPenaltyDesc, prometheus.GaugeValue, s.Penalties[factor], sample.pool, sample.socket, factor)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package serve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSaturationCollector_Observe(t *testing.T) {
+	c := NewSaturationCollector()
+	socket := "unix:///run/php-fpm.sock"
+
+	c.Observe(socket, &phpfpm.Result{
+		Timestamp: time.Now(),
+		Pools: map[string]phpfpm.Pool{
+			"www": {
+				Config:            map[string]string{"pm.max_children": "10"},
+				ActiveProcesses:   5,
+				ListenQueueLength: 128,
+			},
+		},
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	penalties := 0
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			values[mf.GetName()] = m.GetGauge().GetValue()
+		}
+		if mf.GetName() == "phpfpm_health_penalty" {
+			penalties = len(mf.GetMetric())
+		}
+	}
+
+	if values["phpfpm_utilization_ratio"] != 0.5 {
+		t.Errorf("Expected utilization 0.5, got %v", values["phpfpm_utilization_ratio"])
+	}
+	if values["phpfpm_listen_queue_pressure_ratio"] != 0 {
+		t.Errorf("Expected queue pressure 0, got %v", values["phpfpm_listen_queue_pressure_ratio"])
+	}
+	if values["phpfpm_health_score"] != 100 {
+		t.Errorf("Expected health score 100, got %v", values["phpfpm_health_score"])
+	}
+	if penalties != len(phpfpm.HealthFactors) {
+		t.Errorf("Expected a penalty per factor, got %d", penalties)
+	}
+	// The first poll has no previous counter to compute a rate from
+	if _, ok := values["phpfpm_max_children_reached_rate"]; ok {
+		t.Errorf("Expected no max_children rate on the first poll")
+	}
+
+	// A failed scrape leaves only a score of 0 for the pool
+	c.Observe(socket, &phpfpm.Result{Name: "www"})
+	families, err = registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "phpfpm_health_score" {
+		t.Fatalf("Expected only the health score after a failed scrape, got %v", families)
+	}
+	m := families[0].GetMetric()
+	if len(m) != 1 || m[0].GetGauge().GetValue() != 0 {
+		t.Errorf("Expected a health score of 0 for a down pool, got %v", m)
+	}
+	for _, l := range m[0].GetLabel() {
+		if l.GetName() == "pool" && l.GetValue() != "www" {
+			t.Errorf("Expected the down pool to keep its name, got %q", l.GetValue())
+		}
+	}
+
+	// A pool without a status page is not down, it has no values
+	c.Observe(socket, &phpfpm.Result{Name: "www", StatusUnavailable: phpfpm.StatusNoPath})
+	families, err = registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("Expected no metrics for a pool without a status page, got %d families", len(families))
+	}
+}
+
+func TestSaturationCollector_Forget(t *testing.T) {
+	c := NewSaturationCollector()
+	socket := "unix:///run/php-fpm.sock"
+
+	c.Observe(socket, &phpfpm.Result{
+		Timestamp: time.Now(),
+		Pools:     map[string]phpfpm.Pool{"www": {Config: map[string]string{"pm.max_children": "10"}}},
+	})
+	c.Forget(socket)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("Expected the removed socket's values to be dropped, got %v", families)
+	}
+}
@@ -0,0 +1,29 @@
+package serve
+
+import (
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fpmlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SlowlogCollector exports the slowlog entry counters of a SlowlogMonitor.
+type SlowlogCollector struct {
+	monitor     *fpmlog.SlowlogMonitor
+	entriesDesc *prometheus.Desc
+}
+
+func NewSlowlogCollector(monitor *fpmlog.SlowlogMonitor) *SlowlogCollector {
+	return &SlowlogCollector{
+		monitor:     monitor,
+		entriesDesc: prometheus.NewDesc("phpfpm_slowlog_entries_total", "Number of slowlog entries, by script and the frame the request was stuck in.", []string{"pool", "script", "top_frame"}, nil),
+	}
+}
+
+func (c *SlowlogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entriesDesc
+}
+
+func (c *SlowlogCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, n := range c.monitor.Counts() {
+		ch <- prometheus.MustNewConstMetric(c.entriesDesc, prometheus.CounterValue, float64(n), key.Pool, key.Script, key.TopFrame)
+	}
+}
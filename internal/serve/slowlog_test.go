@@ -0,0 +1,57 @@
+package serve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/config"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/fpmlog"
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSlowlogCollector_Collect(t *testing.T) {
+	// Initialize logging to prevent panic
+	logging.Init(config.LoggingBlock{Level: "error", Format: "text"})
+
+	path := filepath.Join(t.TempDir(), "slow.log")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to create slowlog: %v", err)
+	}
+
+	monitor := fpmlog.NewSlowlogMonitor(10)
+	monitor.Poll(path)
+
+	entry := "[16-Oct-2026 10:00:00]  [pool www] pid 7\n" +
+		"script_filename = /var/www/index.php\n" +
+		"[0x0000000000000001] sleep() /var/www/index.php:3\n\n"
+	if err := os.WriteFile(path, []byte(entry+entry), 0644); err != nil {
+		t.Fatalf("Failed to write slowlog: %v", err)
+	}
+	monitor.Poll(path)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewSlowlogCollector(monitor))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "phpfpm_slowlog_entries_total" {
+		t.Fatalf("Expected phpfpm_slowlog_entries_total, got %v", families)
+	}
+
+	metric := families[0].GetMetric()[0]
+	if metric.GetCounter().GetValue() != 2 {
+		t.Errorf("Expected 2 entries, got %v", metric.GetCounter().GetValue())
+	}
+
+	labels := make(map[string]string)
+	for _, lp := range metric.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if labels["pool"] != "www" || labels["script"] != "/var/www/index.php" || labels["top_frame"] != "sleep() /var/www/index.php:3" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+}
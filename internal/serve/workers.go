@@ -0,0 +1,89 @@
+package serve
+
+import (
+	"strconv"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// workerStat is one /proc value of a worker, exported as a per-pool
+// aggregate and optionally per PID.
+type workerStat struct {
+	desc    *prometheus.Desc
+	pidDesc *prometheus.Desc
+	value   func(*phpfpm.ProcStats) (float64, bool)
+}
+
+func newWorkerStats() []workerStat {
+	stat := func(name, help string, value func(*phpfpm.ProcStats) (float64, bool)) workerStat {
+		return workerStat{
+			desc:    prometheus.NewDesc("phpfpm_worker_"+name, help+" across the pool's workers (sum, avg, max).", []string{"pool", "socket", "aggregate", "namespace", "pod"}, nil),
+			pidDesc: prometheus.NewDesc("phpfpm_process_"+name, help+" of the worker.", []string{"pool", "socket", "pid", "namespace", "pod"}, nil),
+			value:   value,
+		}
+	}
+	always := func(f func(*phpfpm.ProcStats) float64) func(*phpfpm.ProcStats) (float64, bool) {
+		return func(s *phpfpm.ProcStats) (float64, bool) { return f(s), true }
+	}
+	optional := func(f func(*phpfpm.ProcStats) *int64) func(*phpfpm.ProcStats) (float64, bool) {
+		return func(s *phpfpm.ProcStats) (float64, bool) {
+			if v := f(s); v != nil {
+				return float64(*v), true
+			}
+			return 0, false
+		}
+	}
+
+	// Per-PID RSS is already exported as phpfpm_process_current_rss
+	rss := stat("rss_bytes", "Resident set size", always(func(s *phpfpm.ProcStats) float64 { return float64(s.RSS) }))
+	rss.pidDesc = nil
+
+	return []workerStat{
+		rss,
+		stat("pss_bytes", "Proportional set size", optional(func(s *phpfpm.ProcStats) *int64 { return s.PSS })),
+		stat("swap_bytes", "Swapped out memory", always(func(s *phpfpm.ProcStats) float64 { return float64(s.Swap) })),
+		stat("open_fds", "Open file descriptors", optional(func(s *phpfpm.ProcStats) *int64 { return s.OpenFDs })),
+		stat("voluntary_ctx_switches", "Voluntary context switches", always(func(s *phpfpm.ProcStats) float64 { return float64(s.VoluntaryCtxSwitches) })),
+		stat("involuntary_ctx_switches", "Involuntary context switches", always(func(s *phpfpm.ProcStats) float64 { return float64(s.InvoluntaryCtxSwitches) })),
+		stat("cpu_seconds", "User and system CPU time", always(func(s *phpfpm.ProcStats) float64 { return s.CPUSeconds })),
+		stat("read_bytes", "Bytes read from storage", optional(func(s *phpfpm.ProcStats) *int64 { return s.ReadBytes })),
+		stat("write_bytes", "Bytes written to storage", optional(func(s *phpfpm.ProcStats) *int64 { return s.WriteBytes })),
+	}
+}
+
+// collectWorkerStats emits the /proc aggregates of a pool, and per-PID values
+// when perPID is set. Workers whose stats could not be read are left out.
+func collectWorkerStats(ch chan<- prometheus.Metric, stats []workerStat, poolName, socket string, ref podRef, pool phpfpm.Pool, perPID bool) {
+	for _, stat := range stats {
+		var sum, max float64
+		var count int
+
+		for _, proc := range pool.Processes {
+			if proc.Proc == nil {
+				continue
+			}
+			v, ok := stat.value(proc.Proc)
+			if !ok {
+				continue
+			}
+
+			sum += v
+			if count == 0 || v > max {
+				max = v
+			}
+			count++
+
+			if perPID && stat.pidDesc != nil {
+				ch <- prometheus.MustNewConstMetric(stat.pidDesc, prometheus.GaugeValue, v, poolName, socket, strconv.Itoa(proc.PID), ref.namespace, ref.pod)
+			}
+		}
+
+		if count == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(stat.desc, prometheus.GaugeValue, sum, poolName, socket, "sum", ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(stat.desc, prometheus.GaugeValue, sum/float64(count), poolName, socket, "avg", ref.namespace, ref.pod)
+		ch <- prometheus.MustNewConstMetric(stat.desc, prometheus.GaugeValue, max, poolName, socket, "max", ref.namespace, ref.pod)
+	}
+}
@@ -0,0 +1,106 @@
+package serve
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophpeek/phpeek-fpm-exporter/internal/phpfpm"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// metricName extracts fqName from a Desc, which has no accessor for it.
+func metricName(d *prometheus.Desc) string {
+	s := d.String()
+	start := strings.Index(s, `fqName: "`) + len(`fqName: "`)
+	end := strings.Index(s[start:], `"`)
+	return s[start : start+end]
+}
+
+// collectWorkerMetrics runs collectWorkerStats and indexes the values by
+// metric name and the aggregate or pid label.
+func collectWorkerMetrics(t *testing.T, pool phpfpm.Pool, perPID bool) map[string]map[string]float64 {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric, 100)
+	collectWorkerStats(ch, newWorkerStats(), "www", "sock", podRef{}, pool, perPID)
+	close(ch)
+
+	out := make(map[string]map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("Failed to write metric: %v", err)
+		}
+
+		name := metricName(m.Desc())
+		if out[name] == nil {
+			out[name] = make(map[string]float64)
+		}
+		for _, lp := range pb.GetLabel() {
+			if lp.GetName() == "aggregate" || lp.GetName() == "pid" {
+				out[name][lp.GetValue()] = pb.GetGauge().GetValue()
+			}
+		}
+	}
+	return out
+}
+
+func TestCollectWorkerStats_Aggregates(t *testing.T) {
+	pool := phpfpm.Pool{
+		Processes: []phpfpm.PoolProcess{
+			{PID: 1, Proc: &phpfpm.ProcStats{RSS: 100, OpenFDs: int64Ptr(10)}},
+			{PID: 2, Proc: &phpfpm.ProcStats{RSS: 300}},
+			// Not visible in /proc
+			{PID: 3},
+		},
+	}
+
+	metrics := collectWorkerMetrics(t, pool, false)
+
+	rss := metrics["phpfpm_worker_rss_bytes"]
+	if rss["sum"] != 400 || rss["avg"] != 200 || rss["max"] != 300 {
+		t.Errorf("Expected rss sum/avg/max 400/200/300, got %v", rss)
+	}
+
+	// Only workers with readable fds count towards the average
+	fds := metrics["phpfpm_worker_open_fds"]
+	if fds["sum"] != 10 || fds["avg"] != 10 || fds["max"] != 10 {
+		t.Errorf("Expected open fds 10/10/10, got %v", fds)
+	}
+
+	if _, ok := metrics["phpfpm_worker_pss_bytes"]; ok {
+		t.Errorf("Expected no PSS aggregate when no worker reports it")
+	}
+
+	for name := range metrics {
+		if strings.HasPrefix(name, "phpfpm_process_") {
+			t.Errorf("Expected no per-PID metrics without process detail, got %s", name)
+		}
+	}
+}
+
+func TestCollectWorkerStats_PerPID(t *testing.T) {
+	pool := phpfpm.Pool{
+		Processes: []phpfpm.PoolProcess{
+			{PID: 1, Proc: &phpfpm.ProcStats{RSS: 100, Swap: 5}},
+			{PID: 2, Proc: &phpfpm.ProcStats{RSS: 300, Swap: 7}},
+		},
+	}
+
+	metrics := collectWorkerMetrics(t, pool, true)
+
+	swap := metrics["phpfpm_process_swap_bytes"]
+	if swap["1"] != 5 || swap["2"] != 7 {
+		t.Errorf("Expected per-PID swap 5 and 7, got %v", swap)
+	}
+
+	// RSS per PID is exported as phpfpm_process_current_rss by the main collector
+	if _, ok := metrics["phpfpm_process_rss_bytes"]; ok {
+		t.Errorf("Expected no phpfpm_process_rss_bytes")
+	}
+}